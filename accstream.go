@@ -0,0 +1,244 @@
+package rz2
+
+import (
+	"math"
+)
+
+const (
+	gapMargin  = 0.5     // packets later than gapMargin of the packet duration than expected are after a gap [packet]
+	jumpMargin = 60000.0 // gaps longer than jumpMargin are regarded as jumps of the clock [ms]
+)
+
+// Gap is a discontinuity of an acc02 stream
+type Gap struct {
+	Start   float64 // time of the last sample before the gap [ms]
+	End     float64 // time of the first sample after the gap [ms]
+	Missing int     // estimated number of missing samples
+	Jump    bool    // the clock of the device jumped (went backward or far forward)
+}
+
+// AccSegment is a continuous part of an acc02 stream
+type AccSegment struct {
+	Time  []float64 // unix time [ms]
+	Value [3][]float64
+	first int // index of the first stored sample in the segment
+	count int // number of samples in the segment including discarded ones
+	// line fitted to send_times of packets: time of the i-th sample = t0 + a + b*i
+	t0               int64
+	packets          int
+	sx, sy, sxx, sxy float64
+}
+
+// Len returns the number of stored samples
+func (seg *AccSegment) Len() int {
+	return len(seg.Value[0])
+}
+
+// fit returns a and b of the line fitted to send_times
+// b is dt when the segment has only one packet
+func (seg *AccSegment) fit(dt float64) (float64, float64) {
+	n := float64(seg.packets)
+	if seg.packets < 2 {
+		return seg.sy/n - dt*seg.sx/n, dt
+	}
+	den := n*seg.sxx - seg.sx*seg.sx
+	if den == 0 {
+		return seg.sy/n - dt*seg.sx/n, dt
+	}
+	b := (n*seg.sxy - seg.sx*seg.sy) / den
+	a := (seg.sy - b*seg.sx) / n
+	return a, b
+}
+
+func (seg *AccSegment) addPacket(send_time int64, last int) {
+	x := float64(last)
+	y := float64(send_time - seg.t0)
+	seg.packets++
+	seg.sx += x
+	seg.sy += y
+	seg.sxx += x * x
+	seg.sxy += x * y
+}
+
+// AccStream reconstructs sample times of acc02 packets of a device
+// Sample times are fitted to send_times of packets in each continuous segment
+// and a new segment starts at a dropped packet or a jump of the clock
+type AccStream struct {
+	nominal  float64 // nominal sampling rate [Hz]
+	rate     float64 // estimated sampling rate [Hz]
+	segments []*AccSegment
+	gaps     []Gap
+}
+
+// NewAccStream returns an AccStream of nominal sampling rate [Hz] (0 for the rate of acc02)
+func NewAccStream(rate float64) *AccStream {
+	if !(rate > 0) {
+		rate = accRate
+	}
+	return &AccStream{
+		nominal: rate,
+		rate:    rate,
+	}
+}
+
+// Rate returns the estimated sampling rate [Hz]
+func (s *AccStream) Rate() float64 {
+	return s.rate
+}
+
+// Gaps returns detected gaps
+func (s *AccStream) Gaps() []Gap {
+	return s.gaps
+}
+
+// Segments returns continuous segments with sample times fitted to all of their packets
+func (s *AccStream) Segments() []*AccSegment {
+	for _, seg := range s.segments {
+		a, b := seg.fit(1000.0 / s.rate)
+		for i := range seg.Time {
+			seg.Time[i] = float64(seg.t0) + a + b*float64(seg.first+i)
+		}
+	}
+	return s.segments
+}
+
+// Discard discards stored samples and gaps keeping the estimation of the current segment
+// It keeps memory usage constant when the stream is used only for times returned by Add
+func (s *AccStream) Discard() {
+	if len(s.segments) == 0 {
+		return
+	}
+	seg := s.segments[len(s.segments)-1]
+	seg.first = seg.count
+	seg.Time = nil
+	seg.Value = [3][]float64{}
+	s.segments = s.segments[len(s.segments)-1:]
+	s.gaps = nil
+}
+
+// Add adds samples of a packet sent at send_time
+// It returns sample times estimated from packets so far and the gap before the packet if any
+func (s *AccStream) Add(send_time int64, values [][3]float64) ([]float64, *Gap) {
+	n := len(values)
+	if n == 0 {
+		return nil, nil
+	}
+	var gap *Gap
+	var seg *AccSegment
+	if len(s.segments) > 0 {
+		seg = s.segments[len(s.segments)-1]
+		a, b := seg.fit(1000.0 / s.rate)
+		last := seg.count - 1
+		expected := float64(seg.t0) + a + b*float64(last+n)
+		late := float64(send_time) - expected
+		if late > gapMargin*float64(n)*b || late < -gapMargin*float64(n)*b {
+			prev := float64(seg.t0) + a + b*float64(last)
+			gap = &Gap{
+				Start: prev,
+				End:   float64(send_time) - b*float64(n-1),
+			}
+			if late < 0 || late > jumpMargin {
+				gap.Jump = true
+			} else {
+				gap.Missing = int(math.Round(late / b))
+			}
+			s.gaps = append(s.gaps, *gap)
+			seg = nil
+		}
+	}
+	if seg == nil {
+		seg = &AccSegment{t0: send_time}
+		s.segments = append(s.segments, seg)
+	}
+	start := seg.count
+	for _, v := range values {
+		for d := 0; d < 3; d++ {
+			seg.Value[d] = append(seg.Value[d], v[d])
+		}
+	}
+	seg.count += n
+	seg.addPacket(send_time, seg.count-1)
+	a, b := seg.fit(1000.0 / s.rate)
+	// trust the rate of a segment longer than a second
+	if seg.packets >= 2 && b > 0 && float64(seg.count)*b >= 1000.0 {
+		r := 1000.0 / b
+		if r > s.nominal/2 && r < s.nominal*2 {
+			s.rate = r
+		}
+	}
+	rtn := make([]float64, n)
+	for i := range rtn {
+		rtn[i] = float64(seg.t0) + a + b*float64(start+i)
+	}
+	seg.Time = append(seg.Time, rtn...)
+	return rtn, gap
+}
+
+// AddSeries adds x/y/z samples of a decoded acc02 message
+func (s *AccStream) AddSeries(se *Series) ([]float64, *Gap) {
+	values := make([][3]float64, 0, len(se.Samples))
+	for _, smp := range se.Samples {
+		if len(smp.Values) < 3 {
+			continue
+		}
+		values = append(values, [3]float64{smp.Values[0], smp.Values[1], smp.Values[2]})
+	}
+	return s.Add(se.SendTime, values)
+}
+
+// Resample returns segments resampled at uniform times of rate [Hz] by linear interpolation
+// Each segment is resampled separately and gaps lie between the returned segments,
+// so that a jump of the clock doesn't fill its span with samples
+func (s *AccStream) Resample(rate float64) []AccSegment {
+	rtn := make([]AccSegment, 0)
+	if !(rate > 0) {
+		return rtn
+	}
+	dt := 1000.0 / rate
+	for _, seg := range s.Segments() {
+		if seg.Len() == 0 {
+			continue
+		}
+		if r := seg.resample(dt); r.Len() > 0 {
+			rtn = append(rtn, r)
+		}
+	}
+	return rtn
+}
+
+// resample returns values of the segment at multiples of dt [ms]
+func (seg *AccSegment) resample(dt float64) AccSegment {
+	var rtn AccSegment
+	n := len(seg.Time)
+	if n == 1 {
+		if math.Mod(seg.Time[0], dt) == 0 {
+			rtn.Time = append(rtn.Time, seg.Time[0])
+			for d := 0; d < 3; d++ {
+				rtn.Value[d] = append(rtn.Value[d], seg.Value[d][0])
+			}
+		}
+		return rtn
+	}
+	start := math.Ceil(seg.Time[0]/dt) * dt
+	size := int(math.Floor((seg.Time[n-1]-start)/dt)) + 1
+	if size <= 0 {
+		return rtn
+	}
+	rtn.Time = make([]float64, size)
+	for d := 0; d < 3; d++ {
+		rtn.Value[d] = make([]float64, size)
+	}
+	k := 0
+	for i := range rtn.Time {
+		tau := start + float64(i)*dt
+		for k+2 < n && seg.Time[k+1] < tau {
+			k++
+		}
+		r := (tau - seg.Time[k]) / (seg.Time[k+1] - seg.Time[k])
+		rtn.Time[i] = tau
+		for d := 0; d < 3; d++ {
+			rtn.Value[d][i] = seg.Value[d][k] + (seg.Value[d][k+1]-seg.Value[d][k])*r
+		}
+	}
+	return rtn
+}
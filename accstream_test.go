@@ -0,0 +1,46 @@
+package rz2
+
+import (
+	"math"
+	"testing"
+)
+
+// testAccStream adds packets of 25 samples of a ramp sent every 200 ms from t0
+func testAccStream(s *AccStream, t0 int64, packets int) {
+	for p := 0; p < packets; p++ {
+		values := make([][3]float64, 25)
+		for i := range values {
+			v := float64(25*p + i)
+			values[i] = [3]float64{v, -v, 1}
+		}
+		s.Add(t0+int64(200*p)+192, values)
+	}
+}
+
+func TestAccStreamResampleJump(t *testing.T) {
+	s := NewAccStream(0)
+	testAccStream(s, goldenTime, 50)
+	// the clock jumped a day forward
+	testAccStream(s, goldenTime+86400000, 50)
+	if len(s.Gaps()) != 1 || !s.Gaps()[0].Jump {
+		t.Fatalf("gaps: %v", s.Gaps())
+	}
+	segs := s.Resample(125)
+	if len(segs) != 2 {
+		t.Fatalf("segments: %d", len(segs))
+	}
+	for _, seg := range segs {
+		if seg.Len() < 1240 || seg.Len() > 1250 {
+			t.Errorf("samples: %d", seg.Len())
+		}
+		for i := 1; i < seg.Len(); i++ {
+			if math.Abs(seg.Time[i]-seg.Time[i-1]-8) > 1e-6 {
+				t.Fatalf("time: %g, %g", seg.Time[i-1], seg.Time[i])
+			}
+			// values of a ramp are interpolated to a ramp
+			if dx := seg.Value[0][i] - seg.Value[0][i-1]; math.Abs(dx-1) > 1e-6 || math.IsNaN(seg.Value[1][i]) {
+				t.Fatalf("value: %g, %g", seg.Value[0][i-1], seg.Value[0][i])
+			}
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"io"
 	"math"
 	"math/cmplx"
+	"strconv"
+	"strings"
 
 	"github.com/mjibson/go-dsp/fft"
 )
@@ -24,8 +26,66 @@ var (
 
 const factor = 980.665 / 256000.0
 
+// AccRange is a measurement range of ADXL355 [g]
+// The zero value means ±2g, which is the default after reset
+type AccRange int
+
+const (
+	Range2g AccRange = 2
+	Range4g AccRange = 4
+	Range8g AccRange = 8
+)
+
+// ParseAccRange parses a range such as "8", "8g" or "±8g"
+func ParseAccRange(s string) (AccRange, error) {
+	v, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(s, "±"), "g"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid range: %s", s)
+	}
+	r := AccRange(v)
+	if !r.Valid() {
+		return 0, fmt.Errorf("invalid range: %s", s)
+	}
+	return r, nil
+}
+
+// Valid reports whether r is a range of ADXL355
+func (r AccRange) Valid() bool {
+	switch r {
+	case 0, Range2g, Range4g, Range8g:
+		return true
+	}
+	return false
+}
+
+// LSB returns the sensitivity [LSB/g]
+func (r AccRange) LSB() float64 {
+	if r == 0 {
+		r = Range2g
+	}
+	return 512000.0 / float64(r)
+}
+
+// Factor returns acceleration of 1 LSB [gal]
+func (r AccRange) Factor() float64 {
+	return 980.665 / r.LSB()
+}
+
+func (r AccRange) String() string {
+	if r == 0 {
+		r = Range2g
+	}
+	return fmt.Sprintf("±%dg", int(r))
+}
+
 // convertAcc converts ADXL355's binary data to acceleration (acc01)
 func ConvertAcc(b []byte) []float64 {
+	return ConvertAccWithRange(b, Range2g)
+}
+
+// ConvertAccWithRange converts binary data of acc01 measured in the range r
+func ConvertAccWithRange(b []byte, r AccRange) []float64 {
+	factor := r.Factor()
 	size := len(b) / 3
 	rtn := make([]float64, size)
 	for i := 0; i < size; i++ {
@@ -41,19 +101,67 @@ func ConvertAcc(b []byte) []float64 {
 }
 
 func ConvertAccPacketWithTime(b []byte) (int64, []float64, int, error) {
-	if len(b) <= 12 {
-		return 0, nil, 0, fmt.Errorf("not enough data")
+	return ConvertAccPacketWithTimeInto(nil, b, Range2g)
+}
+
+// ConvertAccPacketWithTimeInto is ConvertAccPacketWithTime which decodes data measured in the range r into buf
+func ConvertAccPacketWithTimeInto(buf []float64, b []byte, r AccRange) (int64, []float64, int, error) {
+	err := checkLength("acc02", b, 13)
+	if err != nil {
+		return 0, buf[:0], 0, err
 	}
-	var send_time int64
-	buf := bytes.NewReader(b[:8])
-	binary.Read(buf, binary.BigEndian, &send_time)
-	data, xind, err := ConvertAccPacket(b[12:])
+	send_time := int64(binary.BigEndian.Uint64(b[:8]))
+	data, xind, err := ConvertAccPacketInto(buf, b[12:], r)
 	return send_time, data, xind, err
 }
 
+// EncodeAccPacket converts acceleration to binary data of a packet (acc02)
+// acc is a sequence of x/y/z values whose first x value is at xind, as returned by ConvertAccPacketWithTime
+func EncodeAccPacket(send_time int64, acc []float64, xind int) ([]byte, error) {
+	return EncodeAccPacketWithRange(send_time, acc, xind, Range2g)
+}
+
+// EncodeAccPacketWithRange is EncodeAccPacket of a sensor in the range r
+func EncodeAccPacketWithRange(send_time int64, acc []float64, xind int, rng AccRange) ([]byte, error) {
+	factor := rng.Factor()
+	if len(acc) >= math.MaxInt16 {
+		return nil, fmt.Errorf("acc02: too many values: %d", len(acc))
+	}
+	buf := new(bytes.Buffer)
+	buf.Grow(16 + 3*len(acc))
+	err := writeHeader(buf, send_time, int32(4+3*len(acc)))
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, int32(len(acc)))
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range acc {
+		r := math.Round(v / factor)
+		if !(r > -float64(pow19) && r < float64(pow19)) {
+			return nil, fmt.Errorf("acc02: value overflow: %f", v)
+		}
+		tmp := int(r) & (pow20 - 1)
+		b := []byte{byte(tmp >> 12), byte(tmp >> 4), byte(tmp&0xf) << 4}
+		if (i-xind)%3 == 0 {
+			b[2] |= 0x1
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
 // ConvertAcc converts ADXL355's binary data to acceleration (acc02)
 func ConvertAccPacket(b []byte) ([]float64, int, error) {
-	rtn := make([]float64, 0)
+	return ConvertAccPacketInto(nil, b, Range2g)
+}
+
+// ConvertAccPacketInto is ConvertAccPacket which decodes data measured in the range r into buf
+// buf is reused from its start and grown if necessary, so that decoding a stream of packets doesn't allocate
+func ConvertAccPacketInto(buf []float64, b []byte, r AccRange) ([]float64, int, error) {
+	factor := r.Factor()
+	rtn := buf[:0]
 	packet := 0
 	xind := 0
 	currentxind := 0
@@ -63,33 +171,24 @@ func ConvertAccPacket(b []byte) ([]float64, int, error) {
 			break
 		}
 		// read packet size
-		var size int32
-		buf := bytes.NewReader(b[ind : ind+4])
-		binary.Read(buf, binary.BigEndian, &size)
+		size := int32(binary.BigEndian.Uint32(b[ind : ind+4]))
 		if size >= math.MaxInt16 || size < 0 {
-			return rtn, xind, fmt.Errorf("size overflow: %d", size)
+			return rtn, xind, &DataSizeError{Name: "acc02", Size: int(size)}
 		}
 		ind += 4
-		if len(b) < ind+3*int(size) {
-			return rtn, xind, fmt.Errorf("not enough size: %d < %d", len(b), ind+3*int(size))
+		err := checkLength("acc02", b, ind+3*int(size))
+		if err != nil {
+			return rtn, xind, err
 		}
-		// read packet content
+		// x axis is flagged in one of the first three values
 		var tmpxind int
-		tmpdata := make([]float64, size)
-		for i := 0; i < int(size); i++ {
-			tmp := int(b[ind+3*i]) * 4096
-			tmp += int(b[ind+3*i+1]) * 16
-			tmp += int(b[ind+3*i+2]) / 16
-			if tmp > pow19 {
-				tmp -= pow20
-			}
-			tmpdata[i] = float64(tmp) * factor
-			if i < 3 && b[ind+3*i+2]&0x1 != 0 {
+		for i := 0; i < int(size) && i < 3; i++ {
+			if b[ind+3*i+2]&0x1 != 0 {
 				tmpxind = i
 			}
 		}
+		start := 0
 		if packet == 0 {
-			rtn = append(rtn, tmpdata...)
 			xind = tmpxind
 			currentxind = (xind + (3 - int(size)%3)) % 3
 		} else {
@@ -97,8 +196,20 @@ func ConvertAccPacket(b []byte) ([]float64, int, error) {
 			if dxind < 0 {
 				dxind += 3
 			}
-			rtn = append(rtn, tmpdata[dxind:]...)
-			currentxind = (currentxind + (3 - (len(tmpdata)-dxind)%3)) % 3
+			if dxind > int(size) {
+				return rtn, xind, &DataSizeError{Name: "acc02", Size: int(size)}
+			}
+			start = dxind
+			currentxind = (currentxind + (3 - (int(size)-dxind)%3)) % 3
+		}
+		// read packet content
+		for i := start; i < int(size); i++ {
+			p := b[ind+3*i : ind+3*i+3]
+			tmp := int(p[0])<<12 | int(p[1])<<4 | int(p[2])>>4
+			if tmp > pow19 {
+				tmp -= pow20
+			}
+			rtn = append(rtn, float64(tmp)*factor)
 		}
 		packet++
 		ind += int(size) * 3
@@ -218,16 +329,20 @@ func EncodeSpectrum(data [][]float64) ([]byte, error) {
 
 // DecodeSpectrum converts binary data to FFT-ed data
 func DecodeSpectrum(b []byte) (int16, float32, [][]float32, error) {
-	if len(b) < 6 {
-		return 0, 0, nil, fmt.Errorf("not enough length")
+	err := checkLength("spectrum", b, 6)
+	if err != nil {
+		return 0, 0, nil, err
 	}
 	var size int16
 	var df float32
 	buf := bytes.NewReader(b)
-	err := binary.Read(buf, endian, &size)
+	err = binary.Read(buf, endian, &size)
 	if err != nil {
 		return 0, 0, nil, err
 	}
+	if size < 0 {
+		return 0, 0, nil, &DataSizeError{Name: "spectrum", Size: int(size)}
+	}
 	err = binary.Read(buf, endian, &df)
 	if err != nil {
 		return 0, 0, nil, err
@@ -253,6 +368,8 @@ type AccSensor struct {
 	ns         int
 	ew         int
 	ud         int
+	accrange   AccRange
+	calib      *Calibration
 }
 
 func NewAccSensor(num int, address string, ns, ew, ud int) *AccSensor {
@@ -267,6 +384,53 @@ func NewAccSensor(num int, address string, ns, ew, ud int) *AccSensor {
 	}
 }
 
+// SetRange sets the measurement range of the sensor
+func (s *AccSensor) SetRange(r AccRange) error {
+	if !r.Valid() {
+		return fmt.Errorf("invalid range: %d", int(r))
+	}
+	s.accrange = r
+	return nil
+}
+
+func (s *AccSensor) Range() AccRange {
+	return s.accrange
+}
+
+// SetCalibration sets calibration of the sensor (nil for none)
+func (s *AccSensor) SetCalibration(c *Calibration) error {
+	if c != nil {
+		tmp := *c
+		tmp.normalize()
+		err := tmp.Validate()
+		if err != nil {
+			return err
+		}
+		c = &tmp
+	}
+	s.calib = c
+	return nil
+}
+
+// SetDevice sets the range and the calibration of the sensor from settings of d
+func (s *AccSensor) SetDevice(d Device) error {
+	err := s.SetRange(d.AccRange)
+	if err != nil {
+		return err
+	}
+	return s.SetCalibration(d.Calibration)
+}
+
+// Convert converts binary data of acc02 sent by the sensor and calibrates it
+func (s *AccSensor) Convert(b []byte) (int64, []float64, int, error) {
+	send_time, acc, xind, err := ConvertAccPacketWithTimeInto(nil, b, s.accrange)
+	if err != nil {
+		return send_time, acc, xind, err
+	}
+	s.calib.ApplyPacket(acc, xind)
+	return send_time, acc, xind, nil
+}
+
 func (s *AccSensor) Initialize() {
 	s.buffer = make([]float64, bufsize*3)
 	s.count = 0
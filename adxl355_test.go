@@ -0,0 +1,29 @@
+package rz2
+
+import "testing"
+
+func BenchmarkConvertAccPacket(b *testing.B) {
+	payload := testAccPayload(b, goldenTime, 75, 0)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _, _, err := ConvertAccPacketWithTime(payload)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConvertAccPacketInto(b *testing.B) {
+	payload := testAccPayload(b, goldenTime, 75, 0)
+	buf := make([]float64, 0, 75)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	var err error
+	for i := 0; i < b.N; i++ {
+		_, buf, _, err = ConvertAccPacketWithTimeInto(buf, payload, Range2g)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -34,9 +34,14 @@ func DecodeAmg(b []byte) ([]float32, error) {
 	return rtn, nil
 }
 
-func ConvertAmg(b []byte) []float64 {
+// ConvertAmg converts AMG88's register values (thermistor and 64 pixels) to temperature
+func ConvertAmg(b []byte) ([]float64, error) {
+	err := checkLength("amg88", b, 130)
+	if err != nil {
+		return nil, err
+	}
 	convert := func(b1, b2 byte) int {
-		return int(((0x07 & b2) << 8) | (0xff & b1))
+		return int(0x07&b2)<<8 | int(b1)
 	}
 	rtn := make([]float64, 65)
 	rtn[0] = float64(convert(b[0], b[1])) * 0.0625
@@ -51,5 +56,5 @@ func ConvertAmg(b []byte) []float64 {
 			}
 		}
 	}
-	return rtn
+	return rtn, nil
 }
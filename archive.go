@@ -0,0 +1,508 @@
+package rz2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Topic extensions of derived archives
+const (
+	ExtDecimated10 = "acd10" // acceleration decimated to 10 Hz
+	ExtDecimated1  = "acd01" // acceleration decimated to 1 Hz
+	ExtAccStats    = "acs01" // min/max/RMS of acceleration per second
+)
+
+const (
+	accRate      = 125.0 // nominal sampling rate of acc02 [Hz]
+	archiveChunk = 60000 // duration of a derived record [ms]
+)
+
+// WriteServerRecord writes r in RecFormat as rz2rec does so that ReadServerRecord reads it back as it is
+func WriteServerRecord(w io.Writer, r ServerRecord) error {
+	buf := new(bytes.Buffer)
+	topic := SiteTopic(r.Site, r.Topic)
+	buf.Grow(8 + len(topic) + 1 + 4 + len(r.Content))
+	err := binary.Write(buf, RecFormat.Time, r.ServerTime)
+	if err != nil {
+		return err
+	}
+	buf.WriteString(topic)
+	buf.WriteByte(byte(0))
+	err = binary.Write(buf, RecFormat.Size, int32(len(r.Content)))
+	if err != nil {
+		return err
+	}
+	buf.Write(r.Content)
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// LowpassFIR returns coefficients of a Hamming-windowed sinc low-pass filter
+// cutoff is normalized by the sampling rate (0 < cutoff < 0.5)
+func LowpassFIR(ntap int, cutoff float64) []float64 {
+	if ntap%2 == 0 {
+		ntap++
+	}
+	rtn := make([]float64, ntap)
+	half := ntap / 2
+	sum := 0.0
+	for i := 0; i < ntap; i++ {
+		n := float64(i - half)
+		var v float64
+		if i == half {
+			v = 2 * cutoff
+		} else {
+			v = math.Sin(2*math.Pi*cutoff*n) / (math.Pi * n)
+		}
+		v *= 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(ntap-1))
+		rtn[i] = v
+		sum += v
+	}
+	for i := range rtn {
+		rtn[i] /= sum
+	}
+	return rtn
+}
+
+// Decimate resamples x sampled at t [ms] to rate [Hz] with an anti-alias FIR filter
+// Passband edge is 0.3*rate and stopband edge is the output Nyquist frequency 0.5*rate,
+// and output times are aligned to multiples of the output period
+func Decimate(t, x []float64, rate float64) ([]float64, []float64) {
+	n := len(t)
+	if n < 2 || t[n-1] <= t[0] {
+		return nil, nil
+	}
+	fs := 1000.0 * float64(n-1) / (t[n-1] - t[0])
+	ntap := int(math.Ceil(3.3 * fs / (0.2 * rate)))
+	if ntap < 3 {
+		ntap = 3
+	}
+	h := LowpassFIR(ntap, 0.4*rate/fs)
+	half := len(h) / 2
+	filtered := func(k int) float64 {
+		v := 0.0
+		for j, c := range h {
+			ind := k + half - j
+			if ind < 0 {
+				ind = 0
+			} else if ind >= n {
+				ind = n - 1
+			}
+			v += c * x[ind]
+		}
+		return v
+	}
+	period := 1000.0 / rate
+	ot := make([]float64, 0, int((t[n-1]-t[0])/period)+1)
+	ox := make([]float64, 0, cap(ot))
+	k := 0
+	for tau := math.Ceil(t[0]/period) * period; tau <= t[n-1]; tau += period {
+		for k < n-2 && t[k+1] <= tau {
+			k++
+		}
+		f0 := filtered(k)
+		f1 := filtered(k + 1)
+		r := (tau - t[k]) / (t[k+1] - t[k])
+		ot = append(ot, tau)
+		ox = append(ox, f0+(f1-f0)*r)
+	}
+	return ot, ox
+}
+
+// accSegment is a continuous part of acc02 data of a topic
+type accSegment struct {
+	site       string
+	topic      string
+	servertime int64
+	time       []float64
+	value      [3][]float64
+}
+
+// accSegments splits acc02 records into continuous segments per topic
+// Sample times are reconstructed by AccStream
+func accSegments(records []ServerRecord) []*accSegment {
+	topics := make([]string, 0)
+	streams := make(map[string]*AccStream)
+	servertimes := make(map[string][]int64)
+	for _, rec := range records {
+		lis := strings.Split(rec.Topic, "/")
+		if len(lis) < 3 || lis[2] != "acc02" {
+			continue
+		}
+		device, _ := LookupDevice(lis[0])
+		send_time, acc, xind, err := ConvertAccPacketWithTimeInto(nil, rec.Content, device.AccRange)
+		if err != nil {
+			continue
+		}
+		device.Calibration.ApplyPacket(acc, xind)
+		size := (len(acc) - xind) / 3
+		if size == 0 {
+			continue
+		}
+		// the same device seen via two sites is a different stream
+		key := SiteTopic(rec.Site, rec.Topic)
+		stream, ok := streams[key]
+		if !ok {
+			stream = NewAccStream(accRate)
+			streams[key] = stream
+			topics = append(topics, key)
+		}
+		values := make([][3]float64, size)
+		for i := 0; i < size; i++ {
+			values[i] = [3]float64{acc[xind+3*i], acc[xind+3*i+1], acc[xind+3*i+2]}
+		}
+		stream.Add(send_time, values)
+		st := servertimes[key]
+		if len(st) < len(stream.segments) {
+			st = append(st, 0)
+		}
+		st[len(st)-1] = rec.ServerTime
+		servertimes[key] = st
+	}
+	rtn := make([]*accSegment, 0)
+	for _, key := range topics {
+		site, topic := SplitSite(key)
+		for i, seg := range streams[key].Segments() {
+			rtn = append(rtn, &accSegment{
+				site:       site,
+				topic:      topic,
+				servertime: servertimes[key][i],
+				time:       seg.Time,
+				value:      seg.Value,
+			})
+		}
+	}
+	return rtn
+}
+
+func derivedTopic(topic, ext string) string {
+	lis := strings.Split(topic, "/")
+	lis[len(lis)-1] = ext
+	return strings.Join(lis, "/")
+}
+
+// EncodeDecimated converts decimated acceleration starting at start [ms] to binary data
+// send_time(8) | data_size(4) | start_time(8) | rate(4) | x, y, z(4 each) * n
+func EncodeDecimated(start int64, rate float64, data [][]float64) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Grow(24 + 12*len(data))
+	end := start
+	if len(data) > 0 {
+		end = start + int64(math.Round(float64(len(data)-1)*1000.0/rate))
+	}
+	err := binary.Write(buf, binary.BigEndian, end)
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, int32(12+12*len(data)))
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, start)
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, float32(rate))
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range data {
+		for d := 0; d < 3; d++ {
+			err = binary.Write(buf, binary.BigEndian, float32(v[d]))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// ConvertDecimated converts binary data of acd10 and acd01 to times [ms] and acceleration
+func ConvertDecimated(b []byte) ([]int64, [][]float64, error) {
+	err := checkLength("decimated", b, 24)
+	if err != nil {
+		return nil, nil, err
+	}
+	databytes := int(int32(binary.BigEndian.Uint32(b[8:12])))
+	if databytes < 12 || (databytes-12)%12 != 0 {
+		return nil, nil, &DataSizeError{Name: "decimated", Size: databytes}
+	}
+	err = checkLength("decimated", b, 12+databytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	start := int64(binary.BigEndian.Uint64(b[12:20]))
+	rate := float64(math.Float32frombits(binary.BigEndian.Uint32(b[20:24])))
+	if !(rate > 0) {
+		return nil, nil, fmt.Errorf("invalid rate: %f", rate)
+	}
+	n := (databytes - 12) / 12
+	mtime := make([]int64, n)
+	data := make([][]float64, n)
+	for i := 0; i < n; i++ {
+		mtime[i] = start + int64(math.Round(float64(i)*1000.0/rate))
+		tmp := make([]float64, 3)
+		for d := 0; d < 3; d++ {
+			tmp[d] = float64(math.Float32frombits(binary.BigEndian.Uint32(b[24+12*i+4*d:])))
+		}
+		data[i] = tmp
+	}
+	return mtime, data, nil
+}
+
+// AccStats holds min, max and RMS of each direction in a second
+// RMS is taken around the average in the second, so that gravity does not dominate
+type AccStats struct {
+	Time int64
+	Min  [3]float64
+	Max  [3]float64
+	RMS  [3]float64
+}
+
+func accStatsPerSecond(seg *accSegment) []AccStats {
+	rtn := make([]AccStats, 0)
+	i := 0
+	n := len(seg.time)
+	for i < n {
+		sec := math.Floor(seg.time[i]/1000.0) * 1000.0
+		j := i
+		for j < n && seg.time[j] < sec+1000.0 {
+			j++
+		}
+		st := AccStats{Time: int64(sec)}
+		for d := 0; d < 3; d++ {
+			vals := seg.value[d][i:j]
+			min := vals[0]
+			max := vals[0]
+			ave := 0.0
+			for _, v := range vals {
+				if v < min {
+					min = v
+				}
+				if v > max {
+					max = v
+				}
+				ave += v
+			}
+			ave /= float64(len(vals))
+			sum := 0.0
+			for _, v := range vals {
+				sum += (v - ave) * (v - ave)
+			}
+			st.Min[d] = min
+			st.Max[d] = max
+			st.RMS[d] = math.Sqrt(sum / float64(len(vals)))
+		}
+		rtn = append(rtn, st)
+		i = j
+	}
+	return rtn
+}
+
+// EncodeAccStats converts per-second statistics to binary data
+// send_time(8) | data_size(4) | (time(8) | min, max, rms of x, y, z(4 each)) * n
+func EncodeAccStats(stats []AccStats) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Grow(12 + 44*len(stats))
+	var end int64
+	if len(stats) > 0 {
+		end = stats[len(stats)-1].Time
+	}
+	err := binary.Write(buf, binary.BigEndian, end)
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, int32(44*len(stats)))
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range stats {
+		err = binary.Write(buf, binary.BigEndian, st.Time)
+		if err != nil {
+			return nil, err
+		}
+		for d := 0; d < 3; d++ {
+			for _, v := range []float64{st.Min[d], st.Max[d], st.RMS[d]} {
+				err = binary.Write(buf, binary.BigEndian, float32(v))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// ConvertAccStats converts binary data of acs01 to per-second statistics
+func ConvertAccStats(b []byte) ([]AccStats, error) {
+	err := checkLength(ExtAccStats, b, 12)
+	if err != nil {
+		return nil, err
+	}
+	databytes := int(int32(binary.BigEndian.Uint32(b[8:12])))
+	if databytes < 0 || databytes%44 != 0 {
+		return nil, &DataSizeError{Name: ExtAccStats, Size: databytes}
+	}
+	err = checkLength(ExtAccStats, b, 12+databytes)
+	if err != nil {
+		return nil, err
+	}
+	n := databytes / 44
+	rtn := make([]AccStats, n)
+	for i := 0; i < n; i++ {
+		ind := 12 + 44*i
+		rtn[i].Time = int64(binary.BigEndian.Uint64(b[ind : ind+8]))
+		for d := 0; d < 3; d++ {
+			rtn[i].Min[d] = float64(math.Float32frombits(binary.BigEndian.Uint32(b[ind+8+12*d:])))
+			rtn[i].Max[d] = float64(math.Float32frombits(binary.BigEndian.Uint32(b[ind+12+12*d:])))
+			rtn[i].RMS[d] = float64(math.Float32frombits(binary.BigEndian.Uint32(b[ind+16+12*d:])))
+		}
+	}
+	return rtn, nil
+}
+
+func decimatedRecords(seg *accSegment, ext string, t []float64, x [3][]float64, rate float64) ([]ServerRecord, error) {
+	rtn := make([]ServerRecord, 0)
+	topic := derivedTopic(seg.topic, ext)
+	i := 0
+	for i < len(t) {
+		j := i
+		for j < len(t) && t[j] < t[i]+archiveChunk {
+			j++
+		}
+		data := make([][]float64, j-i)
+		for k := i; k < j; k++ {
+			data[k-i] = []float64{x[0][k], x[1][k], x[2][k]}
+		}
+		b, err := EncodeDecimated(int64(t[i]), rate, data)
+		if err != nil {
+			return nil, err
+		}
+		rtn = append(rtn, ServerRecord{ServerTime: seg.servertime, Site: seg.site, Topic: topic, Content: b})
+		i = j
+	}
+	return rtn, nil
+}
+
+func decimateSegment(seg *accSegment, rate float64) ([]float64, [3][]float64) {
+	var t []float64
+	var x [3][]float64
+	for d := 0; d < 3; d++ {
+		t, x[d] = Decimate(seg.time, seg.value[d], rate)
+	}
+	return t, x
+}
+
+// ArchiveRecords derives acd10, acd01 and acs01 records from acc02 records
+// acd01 is decimated from acd10 in cascade
+func ArchiveRecords(records []ServerRecord) ([]ServerRecord, error) {
+	rtn := make([]ServerRecord, 0)
+	for _, seg := range accSegments(records) {
+		t10, x10 := decimateSegment(seg, 10.0)
+		recs, err := decimatedRecords(seg, ExtDecimated10, t10, x10, 10.0)
+		if err != nil {
+			return nil, err
+		}
+		rtn = append(rtn, recs...)
+		seg10 := &accSegment{site: seg.site, topic: seg.topic, servertime: seg.servertime, time: t10, value: x10}
+		t1, x1 := decimateSegment(seg10, 1.0)
+		recs, err = decimatedRecords(seg, ExtDecimated1, t1, x1, 1.0)
+		if err != nil {
+			return nil, err
+		}
+		rtn = append(rtn, recs...)
+		stats := accStatsPerSecond(seg)
+		for i := 0; i < len(stats); i += archiveChunk / 1000 {
+			j := i + archiveChunk/1000
+			if j > len(stats) {
+				j = len(stats)
+			}
+			b, err := EncodeAccStats(stats[i:j])
+			if err != nil {
+				return nil, err
+			}
+			rtn = append(rtn, ServerRecord{ServerTime: seg.servertime, Site: seg.site, Topic: derivedTopic(seg.topic, ExtAccStats), Content: b})
+		}
+	}
+	return rtn, nil
+}
+
+// isArchivedRaw reports whether records of ext are copied to archives as they are
+// High-rate data are replaced by derived records or dropped
+func isArchivedRaw(ext string) bool {
+	switch ext {
+	case "acc01", "acc02", "str01":
+		return false
+	default:
+		return true
+	}
+}
+
+// ArchiveFile writes the derived archive of raw file src to dst
+// Low-rate records are copied as they are, followed by derived records
+func ArchiveFile(src, dst string) error {
+	records, err := ReadServerRecord(src)
+	if err != nil && len(records) == 0 {
+		return err
+	}
+	archived := make([]ServerRecord, 0)
+	for _, rec := range records {
+		lis := strings.Split(rec.Topic, "/")
+		if len(lis) >= 3 && !isArchivedRaw(lis[2]) {
+			continue
+		}
+		archived = append(archived, rec)
+	}
+	derived, err := ArchiveRecords(records)
+	if err != nil {
+		return err
+	}
+	archived = append(archived, derived...)
+	err = os.MkdirAll(filepath.Dir(dst), 0755)
+	if err != nil {
+		return err
+	}
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	for _, rec := range archived {
+		err := WriteServerRecord(w, rec)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ArchivePath returns the path of the archive of raw file fn in recdir
+func ArchivePath(recdir, archivedir, fn string) (string, error) {
+	rel, err := filepath.Rel(recdir, fn)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(archivedir, rel), nil
+}
+
+// FindDatFile returns fn if it exists, otherwise its archive
+// The second value reports whether the archive is returned
+func FindDatFile(recdir, archivedir, fn string) (string, bool, error) {
+	if _, err := os.Stat(fn); err == nil {
+		return fn, false, nil
+	}
+	p, err := ArchivePath(recdir, archivedir, fn)
+	if err != nil {
+		return "", false, err
+	}
+	if _, err := os.Stat(p); err != nil {
+		return "", false, err
+	}
+	return p, true, nil
+}
@@ -0,0 +1,154 @@
+package rz2
+
+import (
+	"fmt"
+	"math"
+)
+
+// Calibration converts measured acceleration to acceleration in the building axes
+// a = Rotation * (Gain * (m - Offset))
+// Gain and Rotation which are not given (all zero) mean 1 and the identity matrix
+type Calibration struct {
+	Offset   [3]float64    `toml:"offset"`   // [gal]
+	Gain     [3]float64    `toml:"gain"`     // per axis
+	Rotation [3][3]float64 `toml:"rotation"` // rotation and sign of axes
+}
+
+// Identity returns a calibration which doesn't change acceleration
+func Identity() *Calibration {
+	c := &Calibration{}
+	c.normalize()
+	return c
+}
+
+// RotationZ returns the matrix which rotates axes by deg [°] around z (vertical) axis
+// It converts values of a sensor rotated by deg counterclockwise to the building grid
+func RotationZ(deg float64) [3][3]float64 {
+	s, c := math.Sincos(deg * math.Pi / 180.0)
+	return [3][3]float64{
+		{c, -s, 0},
+		{s, c, 0},
+		{0, 0, 1},
+	}
+}
+
+// UpsideDown returns the matrix of a sensor mounted upside down (turned over around x axis)
+func UpsideDown() [3][3]float64 {
+	return [3][3]float64{
+		{1, 0, 0},
+		{0, -1, 0},
+		{0, 0, -1},
+	}
+}
+
+// normalize sets Gain and Rotation which are not given to their defaults
+func (c *Calibration) normalize() {
+	if c.Gain == [3]float64{} {
+		c.Gain = [3]float64{1, 1, 1}
+	}
+	if c.Rotation == [3][3]float64{} {
+		c.Rotation = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	}
+}
+
+// Validate checks that the calibration is invertible
+func (c *Calibration) Validate() error {
+	for i := 0; i < 3; i++ {
+		if c.Gain[i] == 0 || math.IsNaN(c.Gain[i]) || math.IsInf(c.Gain[i], 0) {
+			return fmt.Errorf("invalid gain: %v", c.Gain)
+		}
+		if math.IsNaN(c.Offset[i]) || math.IsInf(c.Offset[i], 0) {
+			return fmt.Errorf("invalid offset: %v", c.Offset)
+		}
+	}
+	d := det3(c.Rotation)
+	if d == 0 || math.IsNaN(d) || math.IsInf(d, 0) {
+		return fmt.Errorf("singular rotation: %v", c.Rotation)
+	}
+	return nil
+}
+
+// Apply returns calibrated acceleration of a measured x/y/z value
+func (c *Calibration) Apply(m [3]float64) [3]float64 {
+	if c == nil {
+		return m
+	}
+	var g [3]float64
+	for i := 0; i < 3; i++ {
+		g[i] = c.Gain[i] * (m[i] - c.Offset[i])
+	}
+	var rtn [3]float64
+	for i := 0; i < 3; i++ {
+		rtn[i] = c.Rotation[i][0]*g[0] + c.Rotation[i][1]*g[1] + c.Rotation[i][2]*g[2]
+	}
+	return rtn
+}
+
+// ApplyPacket calibrates complete x/y/z triplets of acc from xind in place
+// Values before xind and an incomplete triplet at the end are left as they are
+func (c *Calibration) ApplyPacket(acc []float64, xind int) {
+	if c == nil {
+		return
+	}
+	for i := xind; i+3 <= len(acc); i += 3 {
+		v := c.Apply([3]float64{acc[i], acc[i+1], acc[i+2]})
+		copy(acc[i:i+3], v[:])
+	}
+}
+
+// Measured returns the measured value which is calibrated to a
+func (c *Calibration) Measured(a [3]float64) ([3]float64, error) {
+	if c == nil {
+		return a, nil
+	}
+	inv, err := inv3(c.Rotation)
+	if err != nil {
+		return a, err
+	}
+	var rtn [3]float64
+	for i := 0; i < 3; i++ {
+		rtn[i] = (inv[i][0]*a[0]+inv[i][1]*a[1]+inv[i][2]*a[2])/c.Gain[i] + c.Offset[i]
+	}
+	return rtn, nil
+}
+
+// EstimateOffset returns the offset with which mean of a sensor at rest is calibrated to gravity (0, 0, 1g)
+func (c *Calibration) EstimateOffset(mean [3]float64) ([3]float64, error) {
+	if c == nil {
+		c = Identity()
+	}
+	tmp := *c
+	tmp.Offset = [3]float64{}
+	zero, err := tmp.Measured([3]float64{0, 0, 980.665})
+	if err != nil {
+		return c.Offset, err
+	}
+	var rtn [3]float64
+	for i := 0; i < 3; i++ {
+		rtn[i] = mean[i] - zero[i]
+	}
+	return rtn, nil
+}
+
+func det3(m [3][3]float64) float64 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+func inv3(m [3][3]float64) ([3][3]float64, error) {
+	d := det3(m)
+	if d == 0 {
+		return m, fmt.Errorf("singular matrix: %v", m)
+	}
+	var rtn [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			// cofactor of m[j][i]
+			r0, r1 := (j+1)%3, (j+2)%3
+			c0, c1 := (i+1)%3, (i+2)%3
+			rtn[i][j] = (m[r0][c0]*m[r1][c1] - m[r0][c1]*m[r1][c0]) / d
+		}
+	}
+	return rtn, nil
+}
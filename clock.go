@@ -0,0 +1,213 @@
+package rz2
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	clockWindow     = 60000 // window of minimum delay [ms]
+	clockStepMargin = 100.0 // changes of minimum delay larger than clockStepMargin are steps of the device clock [ms]
+)
+
+// ClockSample is a pair of device time and server time of a message
+type ClockSample struct {
+	SendTime   int64 // unix time of the device [ms]
+	ServerTime int64 // unix time of the recorder [ms]
+}
+
+// Delay returns server time minus send_time [ms]
+// It is the offset of the clocks plus the latency of the message
+func (c ClockSample) Delay() float64 {
+	return float64(c.ServerTime - c.SendTime)
+}
+
+// hasSendTime reports whether payloads of ext start with send_time
+func hasSendTime(ext string) bool {
+	switch ext {
+	case "acc02", "str01", "sht31", "ill01", "ir01", "gill01", "gps01", "csv01", "clk01":
+		return true
+	default:
+		return false
+	}
+}
+
+// NewClockSample returns ClockSample of a record whose payload carries send_time
+func NewClockSample(rec ServerRecord) (ClockSample, bool) {
+	if !hasSendTime(rec.Topic[strings.LastIndex(rec.Topic, "/")+1:]) {
+		return ClockSample{}, false
+	}
+	send_time, _, err := readHeader("", rec.Content)
+	if err != nil || send_time <= 0 {
+		return ClockSample{}, false
+	}
+	return ClockSample{SendTime: send_time, ServerTime: rec.ServerTime}, true
+}
+
+// ClockModel is the offset of server time from send_time between steps
+// offset(t) = Offset + Drift*1e-6*(t-Start)
+type ClockModel struct {
+	Start  int64   // send_time of the first sample [ms]
+	End    int64   // send_time of the last sample [ms]
+	Offset float64 // [ms]
+	Drift  float64 // [ppm]
+}
+
+// At returns the offset at send_time [ms]
+func (m ClockModel) At(send_time int64) float64 {
+	return m.Offset + m.Drift*1e-6*float64(send_time-m.Start)
+}
+
+// ClockStep is a step of the device clock
+type ClockStep struct {
+	Time int64   // send_time after the step [ms]
+	Size float64 // change of the device clock [ms]
+}
+
+// ClockReport is the synchronization quality of a device
+type ClockReport struct {
+	Samples int
+	Models  []ClockModel
+	Steps   []ClockStep
+	// latency of messages [ms]
+	LatencyMean   float64
+	LatencyMedian float64
+	Latency95     float64
+	LatencyMax    float64
+}
+
+// Model returns the model of the segment containing send_time
+func (r *ClockReport) Model(send_time int64) (ClockModel, bool) {
+	if len(r.Models) == 0 {
+		return ClockModel{}, false
+	}
+	for i, m := range r.Models {
+		if i == len(r.Models)-1 || send_time < r.Models[i+1].Start {
+			return m, true
+		}
+	}
+	return r.Models[len(r.Models)-1], true
+}
+
+// Correct returns send_time converted to server time
+func (r *ClockReport) Correct(send_time int64) int64 {
+	m, ok := r.Model(send_time)
+	if !ok {
+		return send_time
+	}
+	return send_time + int64(math.Round(m.At(send_time)))
+}
+
+// CorrectRecord returns a copy of rec whose send_time (and start_time of str01) is converted to server time
+func (r *ClockReport) CorrectRecord(rec ServerRecord) ServerRecord {
+	ext := rec.Topic[strings.LastIndex(rec.Topic, "/")+1:]
+	if !hasSendTime(ext) || len(rec.Content) < 12 {
+		return rec
+	}
+	content := make([]byte, len(rec.Content))
+	copy(content, rec.Content)
+	send_time := int64(binary.BigEndian.Uint64(content[:8]))
+	delta := r.Correct(send_time) - send_time
+	binary.BigEndian.PutUint64(content[:8], uint64(send_time+delta))
+	if ext == "str01" && len(content) >= 20 {
+		start_time := int64(binary.BigEndian.Uint64(content[12:20]))
+		binary.BigEndian.PutUint64(content[12:20], uint64(start_time+delta))
+	}
+	return ServerRecord{ServerTime: rec.ServerTime, Site: rec.Site, Topic: rec.Topic, Content: content}
+}
+
+// EstimateClock estimates offset, drift, steps and latency of a device clock
+// The offset follows the minimum delay in each window of clockWindow, which is the least affected by latency
+func EstimateClock(samples []ClockSample) ClockReport {
+	rtn := ClockReport{Samples: len(samples)}
+	if len(samples) == 0 {
+		return rtn
+	}
+	sorted := make([]ClockSample, len(samples))
+	copy(sorted, samples)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].SendTime < sorted[j].SendTime
+	})
+	// minimum delay per window
+	type point struct {
+		t int64
+		d float64
+	}
+	points := make([]point, 0)
+	for i := 0; i < len(sorted); {
+		j := i
+		p := point{sorted[i].SendTime, sorted[i].Delay()}
+		for j < len(sorted) && sorted[j].SendTime < sorted[i].SendTime+clockWindow {
+			if d := sorted[j].Delay(); d < p.d {
+				p = point{sorted[j].SendTime, d}
+			}
+			j++
+		}
+		points = append(points, p)
+		i = j
+	}
+	// split at steps and fit a line to each part
+	fit := func(ps []point, start, end int64) ClockModel {
+		m := ClockModel{Start: start, End: end}
+		n := float64(len(ps))
+		var st, sd, stt, std float64
+		for _, p := range ps {
+			t := float64(p.t - start)
+			st += t
+			sd += p.d
+			stt += t * t
+			std += t * p.d
+		}
+		den := n*stt - st*st
+		if len(ps) < 2 || den == 0 {
+			m.Offset = sd / n
+			return m
+		}
+		b := (n*std - st*sd) / den
+		m.Offset = (sd - b*st) / n
+		m.Drift = b * 1e6
+		return m
+	}
+	first := 0
+	start := sorted[0].SendTime
+	for k := 1; k <= len(points); k++ {
+		if k < len(points) && math.Abs(points[k].d-points[k-1].d) <= clockStepMargin {
+			continue
+		}
+		var end int64
+		if k < len(points) {
+			// the step is somewhere between the windows
+			end = points[k].t - 1
+			for _, s := range sorted {
+				if s.SendTime > points[k-1].t && s.Delay() < points[k].d+clockStepMargin && s.Delay() > points[k].d-clockStepMargin {
+					end = s.SendTime - 1
+					break
+				}
+			}
+		} else {
+			end = sorted[len(sorted)-1].SendTime
+		}
+		rtn.Models = append(rtn.Models, fit(points[first:k], start, end))
+		if k < len(points) {
+			// server time doesn't step, so that a decrease of delay is an advance of the device clock
+			rtn.Steps = append(rtn.Steps, ClockStep{Time: end + 1, Size: points[k-1].d - points[k].d})
+			start = end + 1
+		}
+		first = k
+	}
+	// latency above the offset
+	latency := make([]float64, len(sorted))
+	for i, s := range sorted {
+		m, _ := rtn.Model(s.SendTime)
+		latency[i] = s.Delay() - m.At(s.SendTime)
+		rtn.LatencyMean += latency[i]
+	}
+	rtn.LatencyMean /= float64(len(latency))
+	sort.Float64s(latency)
+	rtn.LatencyMedian = latency[len(latency)/2]
+	rtn.Latency95 = latency[int(0.95*float64(len(latency)-1))]
+	rtn.LatencyMax = latency[len(latency)-1]
+	return rtn
+}
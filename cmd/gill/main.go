@@ -2,15 +2,13 @@ package main
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/binary"
 	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"strings"
-	"strconv"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -95,46 +93,18 @@ func getMacAddress() (string, error) {
 	return netInterface.HardwareAddr.String(), nil
 }
 
-func parseMessage(message string) ([]byte, error) {
-	if len(message) < 22 {
-		return nil, fmt.Errorf("not enough message length")
-	}
-	buf := new(bytes.Buffer)
-	ct := time.Now().UnixMilli()
-	err := binary.Write(buf, binary.BigEndian, ct)
-	if err != nil {
-		return nil, err
-	}
-	var size int32 = 16
-	err = binary.Write(buf, binary.BigEndian, size)
-	if err != nil {
-		return nil, err
-	}
-	lis := strings.Split(message, ",")
-	angle, err := strconv.ParseFloat(lis[1], 64)
-	if err != nil {
-		return nil, err
-	}
-	err = binary.Write(buf, binary.BigEndian, angle)
-	if err != nil {
-		return nil, err
-	}
-	speed, err := strconv.ParseFloat(lis[2], 64)
-	if err != nil {
-		return nil, err
-	}
-	err = binary.Write(buf, binary.BigEndian, speed)
-	if err != nil {
-		return nil, err
-	}
-	return buf.Bytes(), nil
-}
-
 func main() {
 	server := flag.String("server", "", "server url:port")
 	conffn := flag.String("config", "", "config file")
+	interval := flag.Int("interval", 1, "publish interval [s]")
+	stale := flag.Int("stale", 5, "time without valid readings until the sensor is stale [s]")
+	queuedir := flag.String("queue", "", "directory of the queue of unsent payloads (default: homedir)")
+	queuesize := flag.Int64("queuesize", 16, "maximum size of the queue [MiB]")
 	flag.Parse()
 
+	if *interval <= 0 || *stale <= 0 || *queuesize <= 0 {
+		log.Fatal("interval, stale and queuesize must be positive")
+	}
 	if *conffn != "" {
 		err := defaultconfig.ReadConfig(*conffn)
 		if err != nil {
@@ -160,9 +130,15 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	mqtttopic := fmt.Sprintf("%s/01/gill01", macaddress)
+	mqtttopic := rz2.NewTopic(macaddress, 1, "gill01").String()
 	fmt.Println(mqtttopic)
 
+	if *queuedir == "" {
+		*queuedir = defaultconfig.Homedir
+	}
+	forwarder := rz2.NewForwarder(client, *queuedir, *queuesize<<20)
+	go forwarder.Run()
+
 	portName, err := getPortInfo()
 	if err != nil {
 		log.Fatal(err)
@@ -176,35 +152,57 @@ func main() {
 		log.Fatal(err)
 	}
 
-	ticker := time.NewTicker(time.Second)
+	ticker := time.NewTicker(time.Duration(*interval) * time.Second)
 
-	currentmessage := ""
+	averager := rz2.NewGillAverager(int64(*stale) * 1000)
+	var averagerlock sync.Mutex
 	go func() {
 		for {
 			select {
 			case <-ticker.C:
-				b, err := parseMessage(currentmessage)
+				now := time.Now().UnixMilli()
+				averagerlock.Lock()
+				stale := averager.Stale(now)
+				angle, speed, health := averager.Flush(now)
+				averagerlock.Unlock()
+				if stale {
+					fmt.Printf("stale: no valid reading for %d ms\n", health.Age)
+				}
+				if health.Status != 0 {
+					fmt.Printf("status %02X: %s\n", health.Status, rz2.GillStatusText(int(health.Status)))
+				}
+				b, err := rz2.EncodeGillHealth(now, angle, speed, health)
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				queued, err := forwarder.Publish(mqtttopic, now, b)
+				fmt.Printf("%.1f[°] %.2f[m/s] n= %d errors= %d\n", angle, speed, health.Count, health.Errors)
 				if err != nil {
 					fmt.Println(err)
 				}
-				if !client.IsConnected() {
-					for {
-						if client.IsConnected() {
-							break
-						}
-						token := client.Connect()
-						token.WaitTimeout(time.Second * 5)
-					}
+				if queued {
+					fmt.Println(forwarder)
 				}
-				token := client.Publish(mqtttopic, 0, false, b)
-				fmt.Println(b)
-				token.Wait()
 			}
 		}
 	}()
 
 	scanner := bufio.NewScanner(port)
 	for scanner.Scan() {
-		currentmessage = scanner.Text()
+		r, err := rz2.ParseGill(scanner.Text())
+		averagerlock.Lock()
+		if err != nil {
+			averager.Error()
+		} else {
+			averager.Add(time.Now().UnixMilli(), r)
+		}
+		averagerlock.Unlock()
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
 	}
 }
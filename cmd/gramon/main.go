@@ -1,8 +1,6 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -43,6 +41,18 @@ func (stat *Status) Set(tree *toml.Tree, key string) error {
 		return err
 	}
 	stat.direction = int(dir)
+	ch, err := rz2.ParseChannel(stat.num)
+	if err != nil {
+		return err
+	}
+	err = rz2.NewTopic(stat.mac, ch, stat.ext).Validate()
+	if err != nil {
+		return err
+	}
+	// measurement range of acc sensor (optional)
+	if r, ok := tree.Get(fmt.Sprintf("%s.range", key)).(int64); ok {
+		return rz2.RegisterDevice(rz2.Device{MacAddress: stat.mac, AccRange: rz2.AccRange(r)})
+	}
 	return nil
 }
 
@@ -251,6 +261,7 @@ type GraphClient struct {
 	lastmtime       int64
 	bufferlastmtime int64
 	offsetmtime     int64
+	stream          *rz2.AccStream
 	verticalAxis    *Axis
 }
 
@@ -281,7 +292,7 @@ func NewGraphClient(status *Status) *GraphClient {
 	modebutton.SetSelected(status.mode)
 	gc := &GraphClient{
 		Status:     status,
-		unit:       unittext(status.ext),
+		unit:       unittext(status.ext, status.direction),
 		macentry:   macentry,
 		numentry:   numentry,
 		extentry:   extentry,
@@ -291,6 +302,7 @@ func NewGraphClient(status *Status) *GraphClient {
 		yvalue:     make([]float64, status.size),
 		xbuffer:    make([]float64, status.size),
 		ybuffer:    make([]float64, status.size),
+		stream:     rz2.NewAccStream(0),
 		verticalAxis: &Axis{
 			ndiv:  4,
 			scale: 0.1,
@@ -304,30 +316,31 @@ func NewGraphClient(status *Status) *GraphClient {
 	return gc
 }
 
-func unittext(ext string) string {
-	switch ext {
-	case "acc02":
-		return "gal"
-	case "str01":
-		return "με"
-	case "ill01":
-		return "lx"
-	case "gill01":
-		return "m/s"
-	case "sht31":
-		return "'C"
-	default:
+func unittext(ext string, direction int) string {
+	d, ok := rz2.LookupDecoder(ext)
+	if !ok {
+		return ""
+	}
+	channels := d.Channels()
+	if direction < 0 || direction >= len(channels) {
 		return ""
 	}
+	return channels[direction].Unit
 }
 
+// GetTopic returns the topic of the graph
+// A channel which is not of two digits ("1") is used as it is, as gramon did before ParseChannel
 func (gc *GraphClient) GetTopic() string {
-	return fmt.Sprintf("%s/%s/%s", gc.mac, gc.num, gc.ext)
+	ch, err := rz2.ParseChannel(gc.num)
+	if err != nil {
+		return fmt.Sprintf("%s/%s/%s", gc.mac, gc.num, gc.ext)
+	}
+	return rz2.NewTopic(gc.mac, ch, gc.ext).String()
 }
 
 func (gc *GraphClient) SetSubscribe(client mqtt.Client) {
 	client.Subscribe(gc.GetTopic(), 2, nil)
-	client.Subscribe(fmt.Sprintf("%s/01/info", gc.mac), 2, nil)
+	client.Subscribe(rz2.InfoTopic(gc.mac).String(), 2, nil)
 }
 
 func (gc *GraphClient) SetInfo() error {
@@ -335,11 +348,19 @@ func (gc *GraphClient) SetInfo() error {
 	if err != nil {
 		return err
 	}
+	ch, err := rz2.ParseChannel(gc.numentry.Text())
+	if err != nil {
+		return err
+	}
+	err = rz2.NewTopic(gc.macentry.Text(), ch, gc.extentry.Text()).Validate()
+	if err != nil {
+		return err
+	}
 	gc.direction = int(dir)
 	gc.mac = gc.macentry.Text()
 	gc.num = gc.numentry.Text()
 	gc.ext = gc.extentry.Text()
-	gc.unit = unittext(gc.ext)
+	gc.unit = unittext(gc.ext, gc.direction)
 	gc.mode = gc.modebutton.Selected()
 	log.Printf("%s: set topic %s/%s/%s, direction %d, %s mode\n", gc.name, gc.mac, gc.num, gc.ext, gc.direction, modestring[gc.mode])
 	return nil
@@ -352,141 +373,64 @@ func (gc *GraphClient) ClearData() {
 	gc.ybuffer = make([]float64, gc.size)
 	gc.lastmtime = 0
 	gc.bufferlastmtime = 0
+	gc.stream = rz2.NewAccStream(0)
 }
 
 func (gc *GraphClient) UpdateData(msg mqtt.Message) error {
 	gc.Lock()
 	defer gc.Unlock()
-	ext := strings.Split(msg.Topic(), "/")[2]
+	t, err := rz2.ParseTopicLenient(msg.Topic())
+	if err != nil {
+		return nil
+	}
+	ext := t.Extension
 	if ext != gc.ext {
 		return nil
 	}
-	var xdata, ydata []float64
-	var ave float64
-	switch ext {
-	case "acc02":
-		var send_time int64
-		buf := bytes.NewReader(msg.Payload()[:8])
-		binary.Read(buf, binary.BigEndian, &send_time)
-		acc, xind, err := rz2.ConvertAccPacket(msg.Payload()[12:])
-		if err != nil {
-			return err
-		}
-		acc = acc[xind : len(acc)-3+xind]
-		xdata = make([]float64, len(acc)/3)
-		ydata = make([]float64, len(acc)/3)
-		ave = 0.0
-		if gc.lastmtime == 0 {
-			gc.lastmtime = send_time - int64(gc.frequency*float64(len(ydata)))
-		}
-		dtime := float64(send_time-gc.lastmtime) / float64(len(ydata))
-		gc.frequency = 1000.0 / dtime
-		for i := 0; i < len(xdata); i++ {
-			xdata[i] = float64(gc.lastmtime) + dtime*float64(i+1)
-			ydata[i] = acc[3*i+gc.direction]
-			ave += ydata[i]
-		}
-		ave /= float64(len(ydata))
-		gc.lastmtime = send_time
-	case "str01":
-		mtime, strain, err := rz2.ConvertStrain(msg.Payload(), 103, true)
-		if err != nil {
-			return err
-		}
-		if len(strain) == 0 {
-			return fmt.Errorf("no data")
-		}
-		xdata = make([]float64, len(strain))
-		ydata = make([]float64, len(strain))
-		ave = 0.0
-		for i := 0; i < len(xdata); i++ {
-			xdata[i] = float64(mtime[i])
-			ydata[i] = strain[i]
-			ave += ydata[i]
-		}
-		ave /= float64(len(ydata))
-		gc.frequency = 1000.0 * float64(len(mtime)-1) / float64(mtime[len(mtime)-1]-mtime[0])
-		gc.lastmtime = mtime[len(mtime)-1]
-	case "ill01":
-		var send_time int64
-		buf := bytes.NewReader(msg.Payload()[:8])
-		binary.Read(buf, binary.BigEndian, &send_time)
-		send_time, data, err := rz2.ConvertIll(msg.Payload())
-		if err != nil {
-			return err
-		}
-		xdata = make([]float64, len(data))
-		ydata = make([]float64, len(data))
-		ave = 0.0
-		if gc.lastmtime == 0 {
-			gc.lastmtime = send_time - int64(gc.frequency*float64(len(ydata)))
-		}
-		dtime := float64(send_time-gc.lastmtime) / float64(len(ydata))
-		gc.frequency = 1000.0 / dtime
-		for i := 0; i < len(xdata); i++ {
-			xdata[i] = float64(gc.lastmtime) + dtime*float64(i+1)
-			ydata[i] = float64(data[i])
-			ave += ydata[i]
-		}
-		ave /= float64(len(ydata))
-		gc.lastmtime = send_time
-	case "gill01":
-		send_time, data0, err := rz2.ConvertGill(msg.Payload())
-		if err != nil {
-			return err
-		}
-		data := []float64{data0[1]}
-		switch gc.direction {
-		case 0:
-			data[0] = data0[0]
-		case 1:
-			data[0] = data0[1]
-		}
-		xdata = make([]float64, len(data))
-		ydata = make([]float64, len(data))
-		ave = 0.0
-		if gc.lastmtime == 0 {
-			gc.lastmtime = send_time - int64(gc.frequency*float64(len(ydata)))
+	if _, ok := rz2.LookupDecoder(ext); !ok {
+		return nil
+	}
+	s, err := rz2.Decode(msg.Topic(), msg.Payload())
+	if err != nil {
+		return err
+	}
+	if gc.direction < 0 || gc.direction >= len(s.Channels) {
+		return nil
+	}
+	if len(s.Samples) == 0 {
+		return fmt.Errorf("no data")
+	}
+	xdata := make([]float64, len(s.Samples))
+	ydata := s.Column(gc.direction)
+	if s.Timestamped {
+		for i, smp := range s.Samples {
+			xdata[i] = float64(smp.Time)
 		}
-		dtime := float64(send_time-gc.lastmtime) / float64(len(ydata))
-		gc.frequency = 1000.0 / dtime
-		for i := 0; i < len(xdata); i++ {
-			xdata[i] = float64(gc.lastmtime) + dtime*float64(i+1)
-			ydata[i] = float64(data[i])
-			ave += ydata[i]
+		if len(xdata) > 1 {
+			gc.frequency = 1000.0 * float64(len(xdata)-1) / (xdata[len(xdata)-1] - xdata[0])
 		}
-		ave /= float64(len(ydata))
-		gc.lastmtime = send_time
-	case "sht31":
-		var send_time int64
-		buf := bytes.NewReader(msg.Payload()[:8])
-		binary.Read(buf, binary.BigEndian, &send_time)
-		send_time, tmp_data, hum_data, err := rz2.ConvertSht(msg.Payload())
-		if err != nil {
-			return err
+		gc.lastmtime = s.Samples[len(s.Samples)-1].Time
+	} else if ext == "acc02" {
+		// sample times are reconstructed from send_times of packets
+		times, gap := gc.stream.AddSeries(s)
+		gc.stream.Discard()
+		if gap != nil {
+			log.Printf("%s: gap of %d samples (jump: %t)\n", gc.name, gap.Missing, gap.Jump)
 		}
-		xdata = make([]float64, len(tmp_data))
-		ydata = make([]float64, len(tmp_data))
-		ave = 0.0
+		copy(xdata, times)
+		gc.frequency = gc.stream.Rate()
+		gc.lastmtime = s.SendTime
+	} else {
+		// spread samples between the last message and this one
 		if gc.lastmtime == 0 {
-			gc.lastmtime = send_time - int64(gc.frequency*float64(len(ydata)))
+			gc.lastmtime = s.SendTime - int64(gc.frequency*float64(len(ydata)))
 		}
-		dtime := float64(send_time-gc.lastmtime) / float64(len(ydata))
+		dtime := float64(s.SendTime-gc.lastmtime) / float64(len(ydata))
 		gc.frequency = 1000.0 / dtime
 		for i := 0; i < len(xdata); i++ {
 			xdata[i] = float64(gc.lastmtime) + dtime*float64(i+1)
-			switch gc.direction {
-			case 0:
-				ydata[i] = float64(tmp_data[i])
-			case 1:
-				ydata[i] = float64(hum_data[i])
-			}
-			ave += ydata[i]
 		}
-		ave /= float64(len(ydata))
-		gc.lastmtime = send_time
-	default:
-		return nil
+		gc.lastmtime = s.SendTime
 	}
 	if len(xdata) >= gc.size {
 		for i := 0; i < gc.size; i++ {
@@ -523,6 +467,15 @@ func (gc *GraphClient) UpdateInfo(msg mqtt.Message) error {
 	var d dproxy.Drain
 	gc.name = d.String(p.M("name"))
 	log.Println(d.String(p.M("name")), d.String(p.M("time")), d.String(p.M("location")), d.String(p.M("hardwareaddress")), d.String(p.M("hostaddress")))
+	if info, ok := v.(map[string]interface{}); ok {
+		changed, err := rz2.RegisterDeviceInfo(gc.mac, info)
+		if err != nil {
+			log.Println(err)
+		} else if changed {
+			d, _ := rz2.LookupDevice(gc.mac)
+			log.Printf("%s: range: %s\n", gc.mac, d.AccRange)
+		}
+	}
 	return d.CombineErrors()
 }
 
@@ -667,6 +620,14 @@ func (gc *GraphClient) Draw(a *ui.Area, p *ui.AreaDrawParams) {
 			ylabel = "Temperature ['C]"
 		case 1:
 			ylabel = "Humidity [%%]"
+		case 2:
+			ylabel = "Dew Point ['C]"
+		case 3:
+			ylabel = "Absolute Humidity [g/m³]"
+		case 4:
+			ylabel = "Heat Index ['C]"
+		case 5:
+			ylabel = "WBGT ['C]"
 		}
 		brush.R = 0.0
 		brush.G = 0.9
@@ -1039,49 +1000,49 @@ func CalcFFT(acc []float64) []complex128 {
 }
 
 func publishHandler(client mqtt.Client, msg mqtt.Message) {
-	lis := strings.Split(msg.Topic(), "/")
-	if len(lis) < 3 {
+	t, err := rz2.ParseTopicLenient(msg.Topic())
+	if err != nil {
 		return
 	}
-	if lis[2] == "info" {
-		if lis[0] == graphclient1.mac {
+	if t.Extension == "info" {
+		if t.MacAddress == graphclient1.mac {
 			graphclient1.UpdateInfo(msg)
 		}
-		if lis[0] == graphclient2.mac {
+		if t.MacAddress == graphclient2.mac {
 			graphclient2.UpdateInfo(msg)
 		}
-		if lis[0] == graphclient3.mac {
+		if t.MacAddress == graphclient3.mac {
 			graphclient3.UpdateInfo(msg)
 		}
-		if lis[0] == graphclient4.mac {
+		if t.MacAddress == graphclient4.mac {
 			graphclient4.UpdateInfo(msg)
 		}
 	}
 	if msg.Topic() == graphclient1.GetTopic() {
 		err := graphclient1.UpdateData(msg)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("%s: %s: %s\n", graphclient1.name, msg.Topic(), err)
 		}
 	}
 	if msg.Topic() == graphclient2.GetTopic() {
 		err := graphclient2.UpdateData(msg)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("%s: %s: %s\n", graphclient2.name, msg.Topic(), err)
 		}
 	}
 	if msg.Topic() == graphclient3.GetTopic() {
 		err := graphclient3.UpdateData(msg)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("%s: %s: %s\n", graphclient3.name, msg.Topic(), err)
 		}
 	}
 	if msg.Topic() == graphclient4.GetTopic() {
 		err := graphclient4.UpdateData(msg)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("%s: %s: %s\n", graphclient4.name, msg.Topic(), err)
 		}
 	}
-	err := recorder.Record(msg)
+	err = recorder.Record(msg)
 	if err != nil {
 		log.Println(err.Error())
 	}
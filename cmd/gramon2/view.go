@@ -1,8 +1,6 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
 	"image/color"
 	"log"
@@ -293,6 +291,7 @@ type GraphClient struct {
 	tvalue    []float64
 	avalue    [][]float64
 	lastmtime int64
+	stream    *rz2.AccStream
 }
 
 func NewGraphClient(name string, size int, mac, num, ext string, mode string) *GraphClient {
@@ -310,6 +309,7 @@ func NewGraphClient(name string, size int, mac, num, ext string, mode string) *G
 		mode:      TIME,
 		tvalue:    make([]float64, size),
 		avalue:    [][]float64{xvalue, yvalue, zvalue},
+		stream:    rz2.NewAccStream(0),
 	}
 	return gc
 }
@@ -327,14 +327,30 @@ var (
 )
 
 func unittext(ext string) string {
-	switch ext {
-	case "acc02":
-		return "gal"
-	case "str01":
-		return "με"
-	default:
+	d, ok := rz2.LookupDecoder(ext)
+	if !ok || len(d.Channels()) == 0 {
 		return ""
 	}
+	return d.Channels()[0].Unit
+}
+
+// accData decodes x/y/z samples of a message with sample times reconstructed by AccStream
+func (gc *GraphClient) accData(topic string, payload []byte) ([]float64, []float64, []float64, []float64, error) {
+	s, err := rz2.Decode(topic, payload)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if len(s.Channels) < 3 || len(s.Samples) == 0 {
+		return nil, nil, nil, nil, nil
+	}
+	tdata, gap := gc.stream.AddSeries(s)
+	gc.stream.Discard()
+	if gap != nil {
+		log.Printf("%s: gap of %d samples (jump: %t)\n", gc.name, gap.Missing, gap.Jump)
+	}
+	gc.frequency = gc.stream.Rate()
+	gc.lastmtime = s.SendTime
+	return tdata, s.Column(0), s.Column(1), s.Column(2), nil
 }
 
 var (
@@ -371,13 +387,13 @@ func StartSubscriber(server string, topics []string) (mqtt.Client, error) {
 	}
 
 	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
-		lis := strings.Split(msg.Topic(), "/")
-		if len(lis) < 3 {
+		t, err := rz2.ParseTopicLenient(msg.Topic())
+		if err != nil {
 			return
 		}
 		var gc *GraphClient
 		for _, g := range gclist {
-			if lis[0] == g.mac {
+			if t.MacAddress == g.mac {
 				gc = g
 				break
 			}
@@ -385,44 +401,9 @@ func StartSubscriber(server string, topics []string) (mqtt.Client, error) {
 		if gc == nil {
 			return
 		}
-		var tdata, xdata, ydata, zdata []float64
-		var avex, avey, avez float64
-		switch lis[2] {
-		case "acc02":
-			var send_time int64
-			buf := bytes.NewReader(msg.Payload()[:8])
-			binary.Read(buf, binary.BigEndian, &send_time)
-			acc, xind, err := rz2.ConvertAccPacket(msg.Payload()[12:])
-			if err != nil {
-				return
-			}
-			acc = acc[xind : len(acc)-3+xind]
-			tdata = make([]float64, len(acc)/3)
-			xdata = make([]float64, len(acc)/3)
-			ydata = make([]float64, len(acc)/3)
-			zdata = make([]float64, len(acc)/3)
-			avex = 0.0
-			avey = 0.0
-			avez = 0.0
-			if gc.lastmtime == 0 {
-				gc.lastmtime = send_time - int64(gc.frequency*float64(len(xdata)))
-			}
-			dtime := float64(send_time-gc.lastmtime) / float64(len(xdata))
-			gc.frequency = 1000.0 / dtime
-			for i := 0; i < len(xdata); i++ {
-				tdata[i] = float64(gc.lastmtime) + dtime*float64(i+1)
-				xdata[i] = acc[3*i]
-				ydata[i] = acc[3*i+1]
-				zdata[i] = acc[3*i+2]
-				avex += xdata[i]
-				avey += ydata[i]
-				avez += zdata[i]
-			}
-			avex /= float64(len(xdata))
-			avey /= float64(len(ydata))
-			avez /= float64(len(zdata))
-			gc.lastmtime = send_time
-		default:
+		tdata, xdata, ydata, zdata, err := gc.accData(msg.Topic(), msg.Payload())
+		if err != nil {
+			return
 		}
 		update := func(orig, current []float64, size int) {
 			if len(current) >= size {
@@ -462,13 +443,13 @@ func StartSubscriber(server string, topics []string) (mqtt.Client, error) {
 func StartDatReader(fn string) {
 	records, _ := rz2.ReadServerRecord(fn)
 	for _, rec := range records {
-		lis := strings.Split(rec.Topic, "/")
-		if len(lis) < 3 {
+		t, err := rz2.ParseTopicLenient(rec.Topic)
+		if err != nil {
 			continue
 		}
 		var gc *GraphClient
 		for _, g := range gclist {
-			if lis[0] == g.mac {
+			if t.MacAddress == g.mac {
 				gc = g
 				break
 			}
@@ -476,44 +457,9 @@ func StartDatReader(fn string) {
 		if gc == nil {
 			continue
 		}
-		var tdata, xdata, ydata, zdata []float64
-		var avex, avey, avez float64
-		switch lis[2] {
-		case "acc02":
-			var send_time int64
-			buf := bytes.NewReader(rec.Content[:8])
-			binary.Read(buf, binary.BigEndian, &send_time)
-			acc, xind, err := rz2.ConvertAccPacket(rec.Content[12:])
-			if err != nil {
-				continue
-			}
-			acc = acc[xind : len(acc)-3+xind]
-			tdata = make([]float64, len(acc)/3)
-			xdata = make([]float64, len(acc)/3)
-			ydata = make([]float64, len(acc)/3)
-			zdata = make([]float64, len(acc)/3)
-			avex = 0.0
-			avey = 0.0
-			avez = 0.0
-			if gc.lastmtime == 0 {
-				gc.lastmtime = send_time - int64(gc.frequency*float64(len(xdata)))
-			}
-			dtime := float64(send_time-gc.lastmtime) / float64(len(xdata))
-			gc.frequency = 1000.0 / dtime
-			for i := 0; i < len(xdata); i++ {
-				tdata[i] = float64(gc.lastmtime) + dtime*float64(i+1)
-				xdata[i] = acc[3*i]
-				ydata[i] = acc[3*i+1]
-				zdata[i] = acc[3*i+2]
-				avex += xdata[i]
-				avey += ydata[i]
-				avez += zdata[i]
-			}
-			avex /= float64(len(xdata))
-			avey /= float64(len(ydata))
-			avez /= float64(len(zdata))
-			gc.lastmtime = send_time
-		default:
+		tdata, xdata, ydata, zdata, err := gc.accData(rec.Topic, rec.Content)
+		if err != nil {
+			continue
 		}
 		update := func(orig, current []float64, size int) {
 			if len(current) >= size {
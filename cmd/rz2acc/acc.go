@@ -1,21 +1,35 @@
 package main
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
 
 	"github.com/yofu/rz2"
 )
 
-func accStats(payload []byte) (string, error) {
-	var send_time int64
-	buf := bytes.NewReader(payload[:8])
-	binary.Read(buf, binary.BigEndian, &send_time)
-	acc, xind, err := rz2.ConvertAccPacket(payload[12:])
+func accStats(topic string, payload []byte) (string, error) {
+	s, err := rz2.Decode(topic, payload)
 	if err != nil {
 		return "", err
 	}
-	acc = acc[xind : len(acc)-3+xind]
-	return fmt.Sprintf("%s, %v", rz2.ConvertUnixtime(send_time).Format("15:04:05.000"), acc), nil
+	acc := make([]float64, 0, 3*len(s.Samples))
+	for _, smp := range s.Samples {
+		acc = append(acc, smp.Values...)
+	}
+	return fmt.Sprintf("%s, %v", rz2.ConvertUnixtime(s.SendTime).Format("15:04:05.000"), acc), nil
+}
+
+// decimatedStats is accStats of acd10 in archives
+func decimatedStats(payload []byte) (string, error) {
+	mtime, data, err := rz2.ConvertDecimated(payload)
+	if err != nil {
+		return "", err
+	}
+	if len(mtime) == 0 {
+		return "", fmt.Errorf("no data")
+	}
+	acc := make([]float64, 0, 3*len(data))
+	for _, v := range data {
+		acc = append(acc, v...)
+	}
+	return fmt.Sprintf("%s, %v", rz2.ConvertUnixtime(mtime[0]).Format("15:04:05.000"), acc), nil
 }
@@ -2,13 +2,17 @@ module github.com/yofu/rz2/cmd/rz2acc
 
 go 1.20
 
-require github.com/yofu/rz2 v0.0.0-20221211114714-f73ad56ca48f
+require (
+	github.com/eclipse/paho.mqtt.golang v1.3.2
+	github.com/google/subcommands v1.2.0
+	github.com/yofu/rz2 v0.0.0-20221211114714-f73ad56ca48f
+)
 
 require (
-	github.com/eclipse/paho.mqtt.golang v1.3.2 // indirect
-	github.com/google/subcommands v1.2.0 // indirect
 	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/mjibson/go-dsp v0.0.0-20180508042940-11479a337f12 // indirect
-	github.com/pelletier/go-toml/v2 v2.0.0 // indirect
+	github.com/pelletier/go-toml/v2 v2.2.2 // indirect
 	golang.org/x/net v0.0.0-20200425230154-ff2c4b7c35a0 // indirect
 )
+
+replace github.com/yofu/rz2 => ../../
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
-	"strings"
 
 	"github.com/google/subcommands"
 	"github.com/yofu/rz2"
@@ -14,6 +13,7 @@ import (
 
 type playCmd struct {
 	directory string
+	archive   string
 }
 
 func (*playCmd) Name() string{
@@ -25,17 +25,30 @@ func (*playCmd) Synopsis() string{
 }
 
 func (*playCmd) Usage() string {
-	return "play [-dir] <filename>"
+	return "play [-dir] [-archive] <filename>"
 }
 
 func (p *playCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&p.directory, "dir", "", "directory")
+	f.StringVar(&p.archive, "archive", "", "archive directory to fall back to when raw data has been removed")
 }
 
 func (p *playCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
 	c := make(chan rz2.ServerRecord)
 	for _, fn := range f.Args() {
-		go rz2.ReadServerRecordChan(filepath.Join(p.directory, fn), c)
+		path := filepath.Join(p.directory, fn)
+		if p.archive != "" {
+			fp, archived, err := rz2.FindDatFile(p.directory, p.archive, path)
+			if err != nil {
+				log.Printf("[play] %v\n", err)
+				return subcommands.ExitFailure
+			}
+			if archived {
+				log.Printf("[play] archive: %s\n", fp)
+			}
+			path = fp
+		}
+		go rz2.ReadServerRecordChan(path, c)
 	}
 	for {
 		select {
@@ -43,10 +56,20 @@ func (p *playCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}
 			if !more {
 				return subcommands.ExitSuccess
 			}
-			lis := strings.Split(rec.Topic, "/")
-			switch lis[2] {
+			t, err := rz2.ParseTopicLenient(rec.Topic)
+			if err != nil {
+				continue
+			}
+			switch t.Extension {
 			case "acc02":
-				status, err := accStats(rec.Content)
+				status, err := accStats(rec.Topic, rec.Content)
+				if err != nil {
+					log.Printf("[play] %v\n", err)
+					return subcommands.ExitFailure
+				}
+				fmt.Printf("%s, %s\n", rec.Topic, status)
+			case rz2.ExtDecimated10:
+				status, err := decimatedStats(rec.Content)
 				if err != nil {
 					log.Printf("[play] %v\n", err)
 					return subcommands.ExitFailure
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strings"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -37,6 +36,13 @@ func (r *receiveCmd) SetFlags(f *flag.FlagSet) {
 }
 
 func (r *receiveCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if r.macaddress != "" {
+		err := rz2.ValidateMacAddress(r.macaddress)
+		if err != nil {
+			log.Printf("[receive] %v\n", err)
+			return subcommands.ExitUsageError
+		}
+	}
 	id := fmt.Sprintf("rz2acc_go_%d", time.Now().UnixNano())
 	var srcclient mqtt.Client
 
@@ -50,12 +56,15 @@ func (r *receiveCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interfac
 	srcopts.SetAutoReconnect(false)
 	srcopts.SetClientID(id)
 	srcopts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
-		lis := strings.Split(msg.Topic(), "/")
-		switch lis[2] {
+		t, err := rz2.ParseTopicLenient(msg.Topic())
+		if err != nil {
+			return
+		}
+		switch t.Extension {
 		case "acc02":
-			status, err := accStats(msg.Payload())
+			status, err := accStats(msg.Topic(), msg.Payload())
 			if err != nil {
-				log.Fatal("[receive] %v\n", err)
+				log.Fatalf("[receive] %v\n", err)
 			}
 			fmt.Printf("%s, %s\n", msg.Topic(), status)
 			os.Exit(0)
@@ -73,7 +82,7 @@ func (r *receiveCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interfac
 		if r.macaddress == "" {
 			srcclient.Subscribe("#", 0, nil)
 		} else {
-			srcclient.Subscribe(fmt.Sprintf("%s/+/+", r.macaddress), 0, nil)
+			srcclient.Subscribe(rz2.TopicPattern(r.macaddress, -1, ""), 0, nil)
 		}
 	}
 	for {
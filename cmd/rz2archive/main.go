@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yofu/rz2"
+)
+
+var (
+	defaultconfig = &rz2.Config{
+		Homedir:    os.Getenv("HOME"),
+		Archivedir: "",
+	}
+)
+
+// archive writes derived archives of .dat files under path
+func archive(recdir, archivedir, path string, overwrite bool) error {
+	return filepath.Walk(path, func(fn string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(fn, ".dat") {
+			return nil
+		}
+		dst, err := rz2.ArchivePath(recdir, archivedir, fn)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(dst); err == nil && !overwrite {
+			return nil
+		}
+		err = rz2.ArchiveFile(fn, dst)
+		if err != nil {
+			log.Printf("%s: %s\n", fn, err)
+			return nil
+		}
+		fmt.Printf("%s -> %s\n", fn, dst)
+		return nil
+	})
+}
+
+func main() {
+	conffn := flag.String("config", "", "config file")
+	directory := flag.String("dir", "", "recorder directory")
+	archivedir := flag.String("archive", "", "archive directory")
+	overwrite := flag.Bool("f", false, "overwrite existing archives")
+	flag.Parse()
+
+	if *conffn != "" {
+		err := defaultconfig.ReadConfig(*conffn)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	recdir := filepath.Join(defaultconfig.Homedir, "rz2/recorder")
+	if *directory != "" {
+		recdir = *directory
+	}
+	if *archivedir != "" {
+		defaultconfig.Archivedir = *archivedir
+	}
+	if defaultconfig.Archivedir == "" {
+		defaultconfig.Archivedir = filepath.Join(defaultconfig.Homedir, "rz2/archive")
+	}
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		paths = []string{recdir}
+	}
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		recabs, err := filepath.Abs(recdir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = archive(recabs, defaultconfig.Archivedir, abs, *overwrite)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/yofu/rz2"
+)
+
+// accSum accumulates acc02 data of a topic
+type accSum struct {
+	topic string
+	count int
+	raw   [3]float64
+	raw2  [3]float64
+	cal   [3]float64
+}
+
+func (a *accSum) add(m [3]float64, c *rz2.Calibration) {
+	v := c.Apply(m)
+	for i := 0; i < 3; i++ {
+		a.raw[i] += m[i]
+		a.raw2[i] += m[i] * m[i]
+		a.cal[i] += v[i]
+	}
+	a.count++
+}
+
+func (a *accSum) mean() ([3]float64, [3]float64) {
+	var raw, cal [3]float64
+	for i := 0; i < 3; i++ {
+		raw[i] = a.raw[i] / float64(a.count)
+		cal[i] = a.cal[i] / float64(a.count)
+	}
+	return raw, cal
+}
+
+func (a *accSum) std() [3]float64 {
+	var rtn [3]float64
+	for i := 0; i < 3; i++ {
+		m := a.raw[i] / float64(a.count)
+		rtn[i] = math.Sqrt(math.Max(a.raw2[i]/float64(a.count)-m*m, 0))
+	}
+	return rtn
+}
+
+func ReadData(datdir string, fns ...string) (map[string]*accSum, error) {
+	sums := make(map[string]*accSum)
+	for _, fn := range fns {
+		err := rz2.ScanServerRecord(filepath.Join(datdir, fn), 0, nil, func(rec rz2.ServerRecord, _ interface{}) error {
+			t, err := rz2.ParseTopic(rec.Topic)
+			if err != nil || t.Extension != "acc02" {
+				return nil
+			}
+			device, _ := rz2.LookupDevice(t.MacAddress)
+			_, acc, xind, err := rz2.ConvertAccPacketWithTimeInto(nil, rec.Content, device.AccRange)
+			if err != nil {
+				return nil
+			}
+			sum, ok := sums[rec.Topic]
+			if !ok {
+				sum = &accSum{topic: rec.Topic}
+				sums[rec.Topic] = sum
+			}
+			for i := xind; i+3 <= len(acc); i += 3 {
+				sum.add([3]float64{acc[i], acc[i+1], acc[i+2]}, device.Calibration)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sums, nil
+}
+
+func report(sum *accSum, suggest bool) error {
+	t, err := rz2.ParseTopic(sum.topic)
+	if err != nil {
+		return err
+	}
+	device, _ := rz2.LookupDevice(t.MacAddress)
+	raw, cal := sum.mean()
+	std := sum.std()
+	norm := math.Sqrt(cal[0]*cal[0] + cal[1]*cal[1] + cal[2]*cal[2])
+	tilt := 0.0
+	if norm > 0 {
+		tilt = math.Acos(cal[2]/norm) * 180.0 / math.Pi
+	}
+	offset, err := device.Calibration.EstimateOffset(raw)
+	if err != nil {
+		return err
+	}
+	if suggest {
+		c := rz2.Identity()
+		if device.Calibration != nil {
+			c = device.Calibration
+		}
+		fmt.Printf("# %s: %d samples, tilt= %.3f°\n", sum.topic, sum.count, tilt)
+		fmt.Print("[[device]]\n")
+		fmt.Printf("macaddress = \"%s\"\n", t.MacAddress)
+		if device.Name != "" {
+			fmt.Printf("name = \"%s\"\n", device.Name)
+		}
+		if device.AccRange != 0 {
+			fmt.Printf("range = %d\n", int(device.AccRange))
+		}
+		fmt.Print("[device.calibration]\n")
+		fmt.Printf("offset = [%.4f, %.4f, %.4f]\n", offset[0], offset[1], offset[2])
+		fmt.Printf("gain = [%.6f, %.6f, %.6f]\n", c.Gain[0], c.Gain[1], c.Gain[2])
+		fmt.Printf("rotation = [[%.6f, %.6f, %.6f], [%.6f, %.6f, %.6f], [%.6f, %.6f, %.6f]]\n\n",
+			c.Rotation[0][0], c.Rotation[0][1], c.Rotation[0][2],
+			c.Rotation[1][0], c.Rotation[1][1], c.Rotation[1][2],
+			c.Rotation[2][0], c.Rotation[2][1], c.Rotation[2][2])
+		return nil
+	}
+	fmt.Printf("%s (%s) range= %s calibrated= %t\n", sum.topic, device.Name, device.AccRange, device.Calibration != nil)
+	fmt.Printf("    samples         : %d\n", sum.count)
+	fmt.Printf("    raw mean [gal]  : %10.3f %10.3f %10.3f\n", raw[0], raw[1], raw[2])
+	fmt.Printf("    raw std  [gal]  : %10.3f %10.3f %10.3f\n", std[0], std[1], std[2])
+	fmt.Printf("    calibrated [gal]: %10.3f %10.3f %10.3f\n", cal[0], cal[1], cal[2])
+	fmt.Printf("    |a| [gal]       : %10.3f (%+.3f%% of 1g)\n", norm, (norm/980.665-1.0)*100.0)
+	fmt.Printf("    tilt [°]        : %10.3f\n", tilt)
+	fmt.Printf("    offset at rest  : %10.3f %10.3f %10.3f\n", offset[0], offset[1], offset[2])
+	return nil
+}
+
+func main() {
+	conffn := flag.String("config", "", "config file")
+	datdir := flag.String("dir", ".", "dat directory")
+	suggest := flag.Bool("suggest", false, "print [[device]] settings with offsets estimated at rest")
+	flag.Parse()
+
+	if *conffn != "" {
+		conf := &rz2.Config{}
+		err := conf.ReadConfig(*conffn)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: rz2calib [-config fn] [-dir dir] [-suggest] datfile...")
+		os.Exit(1)
+	}
+
+	sums, err := ReadData(*datdir, flag.Args()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	topics := make([]string, 0, len(sums))
+	for t := range sums {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	for _, t := range topics {
+		err := report(sums[t], *suggest)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
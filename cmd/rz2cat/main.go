@@ -5,28 +5,88 @@ import (
 	"fmt"
 	"log"
 	"path/filepath"
+	"time"
 
 	"github.com/yofu/rz2"
 )
 
-func ReadData(datdir string, fns ...string) error {
+func ReadData(datdir, archivedir string, format rz2.RecordFormat, fns ...string) error {
 	for _, fn := range fns {
-		records, err := rz2.ReadServerRecord(filepath.Join(datdir, fn))
+		path := filepath.Join(datdir, fn)
+		if archivedir != "" {
+			// fall back to the archive when raw data has been removed
+			p, archived, err := rz2.FindDatFile(datdir, archivedir, path)
+			if err != nil {
+				return err
+			}
+			if archived {
+				fmt.Printf("# archive: %s\n", p)
+			}
+			path = p
+		}
+		err := rz2.ScanServerRecordFormat(path, format, 0, nil, func(rec rz2.ServerRecord, _ interface{}) error {
+			fmt.Println(rz2.SiteTopic(rec.Site, rec.Topic), len(rec.Content))
+			return nil
+		})
 		if err != nil {
 			return err
 		}
-		for _, rec := range records {
-			fmt.Println(rec.Topic, len(rec.Content))
-		}
 	}
 	return nil
 }
 
+func LocationFiles(recdir, layoutfn, location, start, end string) ([]string, error) {
+	layout, err := rz2.ReadLayout(layoutfn)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := rz2.ParseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	st, err := time.ParseInLocation("2006-01-02T15:04:05", start, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	et, err := time.ParseInLocation("2006-01-02T15:04:05", end, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	return layout.Files(recdir, loc, st, et)
+}
+
 func main() {
 	datdir := flag.String("dir", ".", "dat directory")
+	archivedir := flag.String("archive", "", "archive directory")
+	layoutfn := flag.String("layout", "", "layout file")
+	location := flag.String("location", "", "site/building/floor/point")
+	start := flag.String("start", "1970-01-01T00:00:00", "start time")
+	end := flag.String("end", time.Now().Format("2006-01-02T15:04:05"), "end time")
+	formatname := flag.String("format", "rz2rec", "writer of files: rz2rec or recorder (gramon, rz2recall)")
 	flag.Parse()
+	format, err := rz2.ParseRecordFormat(*formatname)
+	if err != nil {
+		log.Fatal(err)
+	}
 	datfn := flag.Args()
-	err := ReadData(*datdir, datfn...)
+	if *location != "" {
+		fns, err := LocationFiles(*datdir, *layoutfn, *location, *start, *end)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, fn := range fns {
+			fmt.Printf("# %s\n", fn)
+		}
+		for i, fn := range fns {
+			rel, err := filepath.Rel(*datdir, fn)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fns[i] = rel
+		}
+		datfn = fns
+	}
+	err = ReadData(*datdir, *archivedir, format, datfn...)
 	if err != nil {
 		log.Fatal(err)
 	}
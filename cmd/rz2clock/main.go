@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/yofu/rz2"
+)
+
+// ClockUnit holds clock samples of a device
+type ClockUnit struct {
+	samples []rz2.ClockSample
+	clk01   []float64
+	report  rz2.ClockReport
+}
+
+func ReadData(datdir string, fns ...string) (map[string]*ClockUnit, error) {
+	units := make(map[string]*ClockUnit)
+	for _, fn := range fns {
+		err := rz2.ScanServerRecord(filepath.Join(datdir, fn), 0, nil, func(rec rz2.ServerRecord, _ interface{}) error {
+			t, err := rz2.ParseTopicLenient(rec.Topic)
+			if err != nil {
+				return nil
+			}
+			c, ok := rz2.NewClockSample(rec)
+			if !ok {
+				return nil
+			}
+			unit, ok := units[t.MacAddress]
+			if !ok {
+				unit = &ClockUnit{}
+				units[t.MacAddress] = unit
+			}
+			unit.samples = append(unit.samples, c)
+			if t.Extension == "clk01" {
+				s, err := rz2.Decode(rec.Topic, rec.Content)
+				if err == nil && len(s.Samples) > 0 {
+					unit.clk01 = append(unit.clk01, s.Samples[0].Values[0])
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, unit := range units {
+		unit.report = rz2.EstimateClock(unit.samples)
+	}
+	return units, nil
+}
+
+func report(mac string, unit *ClockUnit) {
+	r := unit.report
+	fmt.Printf("%s: %d messages\n", mac, r.Samples)
+	for _, m := range r.Models {
+		fmt.Printf("    %s - %s offset= %+10.1f ms drift= %+8.2f ppm\n",
+			rz2.ConvertUnixtime(m.Start).Format("2006-01-02 15:04:05"),
+			rz2.ConvertUnixtime(m.End).Format("2006-01-02 15:04:05"), m.Offset, m.Drift)
+	}
+	for _, s := range r.Steps {
+		fmt.Printf("    step at %s: %+.1f ms\n", rz2.ConvertUnixtime(s.Time).Format("2006-01-02 15:04:05.000"), s.Size)
+	}
+	fmt.Printf("    latency [ms]: mean= %.1f median= %.1f 95%%= %.1f max= %.1f\n", r.LatencyMean, r.LatencyMedian, r.Latency95, r.LatencyMax)
+	if len(unit.clk01) > 0 {
+		min, max := unit.clk01[0], unit.clk01[0]
+		for _, v := range unit.clk01 {
+			if v < min {
+				min = v
+			}
+			if v > max {
+				max = v
+			}
+		}
+		fmt.Printf("    clk01: %d messages, value= %.0f - %.0f\n", len(unit.clk01), min, max)
+	}
+}
+
+// Correct writes copies of fns to outdir with send_times converted to server time
+func Correct(datdir, outdir string, units map[string]*ClockUnit, fns ...string) error {
+	for _, fn := range fns {
+		f, err := os.Create(filepath.Join(outdir, filepath.Base(fn)))
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(f)
+		err = rz2.ScanServerRecord(filepath.Join(datdir, fn), 0, nil, func(rec rz2.ServerRecord, _ interface{}) error {
+			if t, err := rz2.ParseTopicLenient(rec.Topic); err == nil {
+				if unit, ok := units[t.MacAddress]; ok {
+					rec = unit.report.CorrectRecord(rec)
+				}
+			}
+			return rz2.WriteServerRecord(w, rec)
+		})
+		if err != nil {
+			f.Close()
+			return err
+		}
+		err = w.Flush()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		err = f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	datdir := flag.String("dir", ".", "dat directory")
+	outdir := flag.String("correct", "", "write files with corrected send_time to the directory")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: rz2clock [-dir dir] [-correct outdir] datfile...")
+		os.Exit(1)
+	}
+
+	units, err := ReadData(*datdir, flag.Args()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	macs := make([]string, 0, len(units))
+	for mac := range units {
+		macs = append(macs, mac)
+	}
+	sort.Strings(macs)
+	for _, mac := range macs {
+		report(mac, units[mac])
+	}
+	if *outdir != "" {
+		err := os.MkdirAll(*outdir, 0755)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = Correct(*datdir, *outdir, units, flag.Args()...)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
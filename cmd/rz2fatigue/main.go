@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/yofu/rz2"
+)
+
+var (
+	defaultconfig = &rz2.Config{
+		Homedir: os.Getenv("HOME"),
+		List:    make([]string, 0),
+	}
+)
+
+// FatigueUnit holds cycles of a str01 channel
+type FatigueUnit struct {
+	gauge     rz2.StrainGauge
+	curve     rz2.SNCurve
+	hascurve  bool
+	rainflow  *rz2.Rainflow
+	histogram *rz2.RainflowHistogram
+	days      map[string]*rz2.RainflowHistogram
+	damage    map[string]float64 // damage per day
+	cycles    float64
+	maxrange  float64
+	first     int64 // time of the first sample [ms]
+	last      int64 // time of the last sample [ms]
+}
+
+func NewFatigueUnit(g rz2.StrainGauge, curve string, gate, rangebin, meanbin float64) *FatigueUnit {
+	unit := &FatigueUnit{
+		gauge:     g,
+		histogram: rz2.NewRainflowHistogram(rangebin, meanbin),
+		days:      make(map[string]*rz2.RainflowHistogram),
+		damage:    make(map[string]float64),
+	}
+	if g.SNCurve != "" {
+		curve = g.SNCurve
+	}
+	if curve != "" {
+		unit.curve, unit.hascurve = rz2.LookupSNCurve(curve)
+	}
+	unit.rainflow = rz2.NewRainflow(gate, func(c rz2.Cycle) {
+		day := rz2.ConvertUnixtime(c.Time).Format("2006-01-02")
+		h, ok := unit.days[day]
+		if !ok {
+			h = rz2.NewRainflowHistogram(rangebin, meanbin)
+			unit.days[day] = h
+		}
+		h.Add(c)
+		unit.histogram.Add(c)
+		unit.cycles += c.Count
+		if c.Range > unit.maxrange {
+			unit.maxrange = c.Range
+		}
+		if unit.hascurve {
+			unit.damage[day] += unit.curve.Damage(c)
+		}
+	})
+	return unit
+}
+
+func (unit *FatigueUnit) Days() []string {
+	days := make([]string, 0, len(unit.days))
+	for d := range unit.days {
+		days = append(days, d)
+	}
+	sort.Strings(days)
+	return days
+}
+
+// Span returns the calendar span of the data including days without cycles [day]
+func (unit *FatigueUnit) Span() float64 {
+	return float64(unit.last-unit.first) / 86400000.0
+}
+
+func (unit *FatigueUnit) Damage() float64 {
+	sum := 0.0
+	for _, d := range unit.damage {
+		sum += d
+	}
+	return sum
+}
+
+func ReadData(datdir string, curve string, gate, rangebin, meanbin float64, fns ...string) (map[string]*FatigueUnit, error) {
+	units := make(map[string]*FatigueUnit)
+	for _, fn := range fns {
+		err := rz2.ScanServerRecord(filepath.Join(datdir, fn), 0, nil, func(rec rz2.ServerRecord, _ interface{}) error {
+			t, err := rz2.ParseTopic(rec.Topic)
+			if err != nil || t.Extension != "str01" {
+				return nil
+			}
+			s, err := rz2.Decode(rec.Topic, rec.Content)
+			if err != nil {
+				return nil
+			}
+			unit, ok := units[rec.Topic]
+			if !ok {
+				device, _ := rz2.LookupDevice(t.MacAddress)
+				unit = NewFatigueUnit(device.StrainGauge(t.Channel), curve, gate, rangebin, meanbin)
+				units[rec.Topic] = unit
+			}
+			for _, smp := range s.Samples {
+				if unit.first == 0 || smp.Time < unit.first {
+					unit.first = smp.Time
+				}
+				if smp.Time > unit.last {
+					unit.last = smp.Time
+				}
+				unit.rainflow.Add(smp.Time, unit.gauge.Stress(smp.Values[0]))
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, unit := range units {
+		unit.rainflow.Finish()
+	}
+	return units, nil
+}
+
+func report(topic string, unit *FatigueUnit) {
+	fmt.Printf("%s: cycles= %.1f, max range= %.2f MPa (young= %g GPa)\n", topic, unit.cycles, unit.maxrange, unit.gauge.Young)
+	if !unit.hascurve {
+		fmt.Println("    no sncurve")
+		return
+	}
+	c := unit.curve
+	fmt.Printf("    sncurve %s: reference= %g MPa at %g, limit= %.1f MPa, cutoff= %.1f MPa\n", c.Name, c.Reference, c.Cycles, c.Limit, c.Cutoff)
+	for _, day := range unit.Days() {
+		fmt.Printf("    %s damage= %.3e\n", day, unit.damage[day])
+	}
+	d := unit.Damage()
+	fmt.Printf("    total damage= %.3e", d)
+	if span := unit.Span(); d > 0 && span > 0 {
+		// remaining life (1-D)/(D/day) at the average daily damage over the span of the data
+		rate := d / span
+		fmt.Printf(", remaining life= %.1f years at %.3e/day over %.1f days", math.Max(1.0-d, 0.0)/rate/365.0, rate, span)
+	}
+	fmt.Println()
+}
+
+// WriteCSV writes range-mean histograms per channel and per day, and damage per day
+func WriteCSV(prefix string, units map[string]*FatigueUnit, topics []string) error {
+	f, err := os.Create(prefix + "_histogram.csv")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "topic,day,range[MPa],mean[MPa],count")
+	for _, topic := range topics {
+		unit := units[topic]
+		for _, b := range unit.histogram.Bins() {
+			fmt.Fprintf(w, "%s,all,%g,%g,%g\n", topic, b.Range, b.Mean, b.Count)
+		}
+		for _, day := range unit.Days() {
+			for _, b := range unit.days[day].Bins() {
+				fmt.Fprintf(w, "%s,%s,%g,%g,%g\n", topic, day, b.Range, b.Mean, b.Count)
+			}
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	f, err = os.Create(prefix + "_damage.csv")
+	if err != nil {
+		return err
+	}
+	w = bufio.NewWriter(f)
+	fmt.Fprintln(w, "topic,sncurve,day,damage")
+	for _, topic := range topics {
+		unit := units[topic]
+		if !unit.hascurve {
+			continue
+		}
+		for _, day := range unit.Days() {
+			fmt.Fprintf(w, "%s,%s,%s,%e\n", topic, unit.curve.Name, day, unit.damage[day])
+		}
+	}
+	err = w.Flush()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func main() {
+	conffn := flag.String("config", "", "config file")
+	datdir := flag.String("dir", ".", "dat directory")
+	zerofn := flag.String("zero", "", "zero point file")
+	curve := flag.String("curve", "", "S-N curve of channels without sncurve (\"EC3-80\")")
+	gate := flag.Float64("gate", 1.0, "hysteresis of reversals [MPa]")
+	rangebin := flag.Float64("rangebin", 2.0, "bin width of range [MPa]")
+	meanbin := flag.Float64("meanbin", 10.0, "bin width of mean [MPa]")
+	csv := flag.String("csv", "", "write histogram and damage to prefix_histogram.csv and prefix_damage.csv")
+	flag.Parse()
+
+	if flag.NArg() == 0 || !(*rangebin > 0) || !(*meanbin > 0) || math.IsNaN(*gate) {
+		fmt.Fprintln(os.Stderr, "usage: rz2fatigue [-config file] [-curve EC3-80] [-gate MPa] [-rangebin MPa] [-meanbin MPa] [-csv prefix] datfile...")
+		os.Exit(1)
+	}
+	if *conffn != "" {
+		err := defaultconfig.ReadConfig(*conffn)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *curve != "" {
+		if _, ok := rz2.LookupSNCurve(*curve); !ok {
+			log.Fatalf("unknown sncurve: %s", *curve)
+		}
+	}
+	if *zerofn != "" {
+		z, err := rz2.LoadZeroStore(*zerofn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rz2.RegisterZeroStore(z)
+	}
+
+	units, err := ReadData(*datdir, *curve, *gate, *rangebin, *meanbin, flag.Args()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	topics := make([]string, 0, len(units))
+	for topic := range units {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		report(topic, units[topic])
+	}
+	if *csv != "" {
+		err := WriteCSV(*csv, units, topics)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/yofu/rz2"
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
+)
+
+var (
+	defaultconfig = &rz2.Config{
+		Server:  "tcp://192.168.0.100:1883",
+		Homedir: os.Getenv("HOME"),
+		List:    make([]string, 0),
+	}
+	retry = 5 * time.Second // interval to reopen a serial port
+)
+
+func StartPublisher(server string) (mqtt.Client, error) {
+	opts := mqtt.NewClientOptions()
+
+	opts.AddBroker(server)
+	opts.SetAutoReconnect(false)
+	opts.SetClientID(fmt.Sprintf("rz2gateway_%d", time.Now().UnixNano()))
+
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	token.WaitTimeout(time.Second * 5)
+	if token.Error() != nil {
+		return client, token.Error()
+	}
+
+	return client, nil
+}
+
+func getMacAddress() (string, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "", err
+	}
+	var currentIP string
+	for _, address := range addrs {
+		if ipnet, ok := address.(*net.IPNet); ok && !ipnet.IP.IsLoopback() {
+			if ipnet.IP.To4() != nil {
+				currentIP = ipnet.IP.String()
+				break
+			}
+		}
+	}
+	var currentNetworkHardwareName string
+	interfaces, _ := net.Interfaces()
+	for _, interf := range interfaces {
+		if addrs, err := interf.Addrs(); err == nil {
+			for _, addr := range addrs {
+				if strings.Contains(addr.String(), currentIP) {
+					currentNetworkHardwareName = interf.Name
+					break
+				}
+			}
+		}
+	}
+	netInterface, err := net.InterfaceByName(currentNetworkHardwareName)
+	if err != nil {
+		return "", err
+	}
+	return netInterface.HardwareAddr.String(), nil
+}
+
+// findPort returns the name of the USB serial port of vid and pid (any pid if empty)
+func findPort(vid, pid string) (string, error) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return "", err
+	}
+	for _, port := range ports {
+		if port.IsUSB && strings.EqualFold(port.VID, vid) && (pid == "" || strings.EqualFold(port.PID, pid)) {
+			return port.Name, nil
+		}
+	}
+	return "", fmt.Errorf("cannot find port of vid %s pid %s", vid, pid)
+}
+
+func listPorts() error {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return err
+	}
+	for _, port := range ports {
+		if port.IsUSB {
+			fmt.Printf("%s: vid %s pid %s serial %s %s\n", port.Name, port.VID, port.PID, port.SerialNumber, port.Product)
+		} else {
+			fmt.Printf("%s\n", port.Name)
+		}
+	}
+	return nil
+}
+
+// openSource opens the file or the serial port of the instrument
+func openSource(in rz2.Instrument) (io.ReadCloser, error) {
+	if fn, ok := in.File(); ok {
+		return os.Open(fn)
+	}
+	name := in.Port
+	if name == "" {
+		var err error
+		name, err = findPort(in.VID, in.PID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return serial.Open(name, &serial.Mode{BaudRate: in.Baud})
+}
+
+// Publisher publishes payloads to the broker, or prints them in dry run
+type Publisher struct {
+	forwarder *rz2.Forwarder
+}
+
+func (p *Publisher) Publish(topic string, time int64, b []byte) {
+	if p.forwarder == nil {
+		s, err := rz2.Decode(topic, b)
+		if err != nil {
+			fmt.Printf("%s: %s\n", topic, err)
+			return
+		}
+		fmt.Printf("%s %s", topic, rz2.ConvertUnixtime(s.SendTime).Format("15:04:05.000"))
+		for i, c := range s.Channels {
+			fmt.Printf(" %s= %g", c.Name, s.Samples[0].Values[i])
+		}
+		fmt.Println()
+		return
+	}
+	queued, err := p.forwarder.Publish(topic, time, b)
+	if err != nil {
+		fmt.Printf("%s: %s\n", topic, err)
+	}
+	if queued {
+		fmt.Printf("%s: %s\n", topic, p.forwarder)
+	}
+}
+
+// Run reads lines of the instrument and publishes a payload every interval
+// It returns at the end of a file source, and reopens a serial port after an error
+func Run(in rz2.Instrument, topic string, pub *Publisher, pace time.Duration) error {
+	parser, err := in.NewParser()
+	if err != nil {
+		return err
+	}
+	var parserlock sync.Mutex
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	ticker := time.NewTicker(time.Duration(in.Interval) * time.Millisecond)
+	defer ticker.Stop()
+	flush := func() {
+		now := time.Now().UnixNano() / 1000000
+		parserlock.Lock()
+		b, err := parser.Flush(now)
+		parserlock.Unlock()
+		if err != nil {
+			fmt.Printf("%s: %s\n", in.Name, err)
+			return
+		}
+		pub.Publish(topic, now, b)
+	}
+	// stop stops the ticker and waits for the goroutine, so that no flush runs after it
+	stop := func() {
+		ticker.Stop()
+		close(done)
+		<-finished
+	}
+	go func() {
+		defer close(finished)
+		for {
+			select {
+			case <-ticker.C:
+				flush()
+			case <-done:
+				return
+			}
+		}
+	}()
+	_, isfile := in.File()
+	for {
+		src, err := openSource(in)
+		if err != nil {
+			if isfile {
+				stop()
+				return err
+			}
+			fmt.Printf("%s: %s\n", in.Name, err)
+			time.Sleep(retry)
+			continue
+		}
+		scanner := bufio.NewScanner(src)
+		scanner.Split(in.SplitFunc())
+		for scanner.Scan() {
+			parserlock.Lock()
+			err := parser.Parse(time.Now().UnixNano()/1000000, scanner.Text())
+			parserlock.Unlock()
+			if err != nil {
+				fmt.Printf("%s: %s\n", in.Name, err)
+			}
+			if pace > 0 {
+				time.Sleep(pace)
+			}
+		}
+		src.Close()
+		if isfile {
+			stop()
+			flush()
+			return scanner.Err()
+		}
+		fmt.Printf("%s: port closed: %v\n", in.Name, scanner.Err())
+		time.Sleep(retry)
+	}
+}
+
+func main() {
+	server := flag.String("server", "", "server url:port")
+	conffn := flag.String("config", "", "config file with [[instrument]]")
+	mac := flag.String("mac", "", "mac address of topics (default: of this host)")
+	dry := flag.Bool("dry", false, "print payloads instead of publishing")
+	pace := flag.Int("pace", 0, "delay after each line of file sources [ms]")
+	list := flag.Bool("list", false, "list serial ports")
+	queuedir := flag.String("queue", "", "directory of queues of unsent payloads (default: homedir)")
+	queuesize := flag.Int64("queuesize", 16, "maximum size of a queue [MiB]")
+	flag.Parse()
+
+	if *list {
+		err := listPorts()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *conffn == "" {
+		fmt.Fprintln(os.Stderr, "usage: rz2gateway -config file [-server url] [-mac address] [-dry] [-pace ms]")
+		os.Exit(1)
+	}
+	err := defaultconfig.ReadConfig(*conffn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *server != "" {
+		defaultconfig.Server = *server
+	}
+	defaultconfig.Println()
+	if len(defaultconfig.Instruments) == 0 {
+		log.Fatal("no instrument")
+	}
+
+	macaddress := *mac
+	if macaddress == "" {
+		macaddress, err = getMacAddress()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	err = rz2.ValidateMacAddress(macaddress)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pub := &Publisher{}
+	if !*dry {
+		srvaddress, err := rz2.ServerAddress(defaultconfig.Server)
+		if srvaddress == "" {
+			log.Fatal(err)
+		}
+		client, err := StartPublisher(srvaddress)
+		if err != nil && client == nil {
+			log.Fatal(err)
+		}
+		if *queuedir == "" {
+			*queuedir = defaultconfig.Homedir
+		}
+		pub.forwarder = rz2.NewForwarder(client, *queuedir, *queuesize<<20)
+		go pub.forwarder.Run()
+	}
+
+	var wg sync.WaitGroup
+	for _, in := range defaultconfig.Instruments {
+		topic := in.Topic(macaddress).String()
+		fmt.Printf("%s: %s\n", in.Name, topic)
+		wg.Add(1)
+		go func(in rz2.Instrument) {
+			defer wg.Done()
+			err := Run(in, topic, pub, time.Duration(*pace)*time.Millisecond)
+			if err != nil {
+				fmt.Printf("%s: %s\n", in.Name, err)
+			}
+		}(in)
+	}
+	wg.Wait()
+}
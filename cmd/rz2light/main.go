@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/yofu/rz2"
+)
+
+var (
+	defaultconfig = &rz2.Config{
+		Homedir: os.Getenv("HOME"),
+		List:    make([]string, 0),
+	}
+)
+
+// LightUnit holds illuminance of an ill01 topic
+type LightUnit struct {
+	monitor   *rz2.LightMonitor
+	events    []rz2.LightEvent
+	saturated int
+}
+
+func ReadData(datdir string, fns ...string) (map[string]*LightUnit, error) {
+	units := make(map[string]*LightUnit)
+	for _, fn := range fns {
+		err := rz2.ScanServerRecord(filepath.Join(datdir, fn), 0, nil, func(rec rz2.ServerRecord, _ interface{}) error {
+			t, err := rz2.ParseTopic(rec.Topic)
+			if err != nil || t.Extension != "ill01" {
+				return nil
+			}
+			s, err := rz2.Decode(rec.Topic, rec.Content)
+			if err != nil {
+				return nil
+			}
+			unit, ok := units[rec.Topic]
+			if !ok {
+				device, _ := rz2.LookupDevice(t.MacAddress)
+				unit = &LightUnit{monitor: rz2.NewLightMonitor(device.LightSensor().Threshold)}
+				units[rec.Topic] = unit
+			}
+			col := s.Channel("illuminance")
+			for _, smp := range s.Samples {
+				if math.IsNaN(smp.Values[col]) {
+					unit.saturated++
+					continue
+				}
+				if ev := unit.monitor.Add(smp.Time, smp.Values[col]); ev != nil {
+					unit.events = append(unit.events, *ev)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return units, nil
+}
+
+func report(topic string, unit *LightUnit, events bool) {
+	fmt.Printf("%s:", topic)
+	if unit.saturated > 0 {
+		fmt.Printf(" %d saturated samples", unit.saturated)
+	}
+	fmt.Println()
+	fmt.Println("    date       lux·h       DLI[mol/m²/d] lit[h] events")
+	for _, d := range unit.monitor.Days() {
+		fmt.Printf("    %s %11.1f %13.3f %6.2f %6d\n", d.Date, d.LuxHours, d.DLI(), d.Lit, d.Events)
+	}
+	if !events {
+		return
+	}
+	for _, ev := range unit.events {
+		state := "off"
+		if ev.On {
+			state = "on"
+		}
+		fmt.Printf("    %s %-3s %-8s %.1f lx\n", rz2.ConvertUnixtime(ev.Time).Format("2006-01-02 15:04:05"), state, ev.Source, ev.Lux)
+	}
+}
+
+func main() {
+	conffn := flag.String("config", "", "config file with [device.light]")
+	datdir := flag.String("dir", ".", "dat directory")
+	events := flag.Bool("events", false, "print on/off events")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: rz2light [-config file] [-dir dir] [-events] datfile...")
+		os.Exit(1)
+	}
+	if *conffn != "" {
+		err := defaultconfig.ReadConfig(*conffn)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	units, err := ReadData(*datdir, flag.Args()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	topics := make([]string, 0, len(units))
+	for topic := range units {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		report(topic, units[topic], *events)
+	}
+}
@@ -87,14 +87,14 @@ func StartSubscriber(server string, topics []string) (mqtt.Client, error) {
 	}
 
 	opts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
-		lis := strings.Split(msg.Topic(), "/")
-		if len(lis) < 3 {
+		t, err := rz2.ParseTopicLenient(msg.Topic())
+		if err != nil {
 			return
 		}
 		var unit *Unit
 		ct := time.Now()
 		for _, u := range units {
-			if u.hardwareaddress == lis[0] {
+			if u.hardwareaddress == t.MacAddress {
 				unit = u
 				unit.receivedtime = ct
 				break
@@ -102,13 +102,13 @@ func StartSubscriber(server string, topics []string) (mqtt.Client, error) {
 		}
 		if unit == nil {
 			unit = &Unit{
-				hardwareaddress: lis[0],
+				hardwareaddress: t.MacAddress,
 				receivedtime:    ct,
 				tag:             make([]string, 0),
 			}
 			units = append(units, unit)
 		}
-		switch lis[2] {
+		switch t.Extension {
 		case "info":
 			var v interface{}
 			json.Unmarshal(msg.Payload(), &v)
@@ -120,8 +120,8 @@ func StartSubscriber(server string, topics []string) (mqtt.Client, error) {
 			unit.hostaddress = d.String(p.M("hostaddress"))
 		default:
 		}
-		unit.tag = append(unit.tag, lis[2])
-		filesize, err := recordfilesize(lis[0])
+		unit.tag = append(unit.tag, t.Extension)
+		filesize, err := recordfilesize(t.MacAddress)
 		if err != nil {
 		} else {
 			unit.filesize = filesize
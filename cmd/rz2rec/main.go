@@ -18,7 +18,7 @@ import (
 	"github.com/yofu/rz2"
 )
 
-var endian = binary.BigEndian
+var format = rz2.RecFormat
 
 var (
 	defaultconfig   = &rz2.Config{
@@ -30,54 +30,114 @@ var (
 		Removehour: 0,
 		List: make([]string, 0),
 	}
+	layout     *rz2.Layout
+	layoutlock sync.RWMutex
+	layouttime time.Time // modification time of the layout file
 )
 
 type Record struct {
 	sync.Mutex
 	path       string
 	dest       *os.File
+	root       string
 	dir        string
+	site       string
 	macaddress string
 }
 
-func NewRecord(dir, macaddress string) *Record {
+func NewRecord(root, site, macaddress string) *Record {
 	r := new(Record)
-	r.dir = dir
+	r.root = root
+	r.dir = filepath.Join(root, site, strings.Replace(macaddress, ":", "_", -1))
+	r.site = site
 	r.macaddress = macaddress
 	return r
 }
 
-func (r *Record) setdest() (string, string, error) {
+// currentdir returns the directory of the location where the device is installed at t
+// or the directory of the device itself if it is not found in the layout
+func (r *Record) currentdir(t time.Time) string {
+	layoutlock.RLock()
+	defer layoutlock.RUnlock()
+	if layout != nil {
+		if loc, ok := layout.Locate(r.site, r.macaddress, t); ok {
+			return loc.Dir(r.root)
+		}
+	}
+	return r.dir
+}
+
+// moved reports whether the location of the device at t differs from the directory of the current file
+func (r *Record) moved(t time.Time) bool {
 	r.Lock()
-	if r.dest != nil {
-		r.dest.Close()
+	defer r.Unlock()
+	return r.path != "" && r.currentdir(t) != filepath.Dir(r.path)
+}
+
+// readlayout reads the layout file if it is modified after the last read
+func readlayout(fn string) (bool, error) {
+	info, err := os.Stat(fn)
+	if err != nil {
+		return false, err
 	}
+	if info.ModTime().Equal(layouttime) {
+		return false, nil
+	}
+	l, err := rz2.ReadLayout(fn)
+	if err != nil {
+		return false, err
+	}
+	layoutlock.Lock()
+	layout = l
+	layouttime = info.ModTime()
+	layoutlock.Unlock()
+	return true, nil
+}
+
+// setdest starts a new file and returns the paths of the old and new files
+// The current file is kept when the new one cannot be created
+func (r *Record) setdest() (string, string, error) {
+	r.Lock()
+	defer r.Unlock()
 	now := time.Now()
 	name := strings.Replace(r.macaddress, ":", "_", -1)
-	p := filepath.Join(r.dir, fmt.Sprintf("%s_%s.dat", name, now.Format("2006-01-02-15-04-05")))
-	oldp := r.path
-	r.path = p
+	if r.site != "" {
+		name = fmt.Sprintf("%s_%s", r.site, name)
+	}
+	dir := r.currentdir(now)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", "", err
+	}
+	p := filepath.Join(dir, fmt.Sprintf("%s_%s.dat", name, now.Format("2006-01-02-15-04-05")))
 	w, err := os.Create(p)
 	if err != nil {
 		return "", "", err
 	}
+	if r.dest != nil {
+		r.dest.Close()
+	}
+	oldp := r.path
+	r.path = p
 	r.dest = w
-	r.Unlock()
-	return oldp, r.path, nil
+	return oldp, p, nil
 }
 
 func (r *Record) record(msg mqtt.Message) error {
 	r.Lock()
+	defer r.Unlock()
 	buf := new(bytes.Buffer)
-	buf.Grow(8 + len([]byte(msg.Topic())) + 1 + 4 + len(msg.Payload()))
+	// the site of the broker is recorded as the prefix of the topic
+	topic := rz2.SiteTopic(r.site, msg.Topic())
+	buf.Grow(8 + len([]byte(topic)) + 1 + 4 + len(msg.Payload()))
 	// Current Time [ms]: 8byte
 	ct := time.Now().UnixNano() / 1000000 // ms
-	err := binary.Write(buf, endian, ct)
+	err := binary.Write(buf, format.Time, ct)
 	if err != nil {
 		return err
 	}
 	// Topic
-	_, err = buf.WriteString(msg.Topic())
+	_, err = buf.WriteString(topic)
 	if err != nil {
 		return err
 	}
@@ -86,7 +146,7 @@ func (r *Record) record(msg mqtt.Message) error {
 		return err
 	}
 	// Data size: 4byte
-	err = binary.Write(buf, endian, int32(len(msg.Payload())))
+	err = binary.Write(buf, format.Size, int32(len(msg.Payload())))
 	if err != nil {
 		return err
 	}
@@ -97,7 +157,6 @@ func (r *Record) record(msg mqtt.Message) error {
 	}
 	_, err = buf.WriteTo(r.dest)
 	r.dest.Sync()
-	r.Unlock()
 	return err
 }
 
@@ -115,31 +174,36 @@ func removeoldfiles(dur time.Duration) error {
 		if !d.IsDir() {
 			continue
 		}
-		rd2, err := ioutil.ReadDir(filepath.Join(dir, d.Name()))
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-		for _, d2 := range rd2 {
-			if d2.IsDir() {
-				continue
+		// recorder/<mac>/*.dat or recorder/<site>/<mac>/*.dat
+		err := filepath.Walk(filepath.Join(dir, d.Name()), func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				log.Println(err)
+				return nil
+			}
+			if info.IsDir() {
+				return nil
 			}
-			if d2.ModTime().Before(t0) {
-				os.Remove(filepath.Join(dir, d.Name(), d2.Name()))
+			if info.ModTime().Before(t0) {
+				os.Remove(path)
 			}
+			return nil
+		})
+		if err != nil {
+			log.Println(err)
 		}
 	}
 	return nil
 }
 
-func StartSubscriber(server string, topics []string, fn func(mqtt.Client, mqtt.Message)) (mqtt.Client, error) {
+func StartSubscriber(broker rz2.Broker, topics []string, fn func(mqtt.Client, mqtt.Message)) (mqtt.Client, error) {
 	opts := mqtt.NewClientOptions()
 
+	server := broker.Server
 	opts.AddBroker(server)
 	opts.SetAutoReconnect(false)
 	opts.SetClientID(fmt.Sprintf("rz2rec_%d", time.Now().UnixNano()))
 	if strings.HasPrefix(server, "ssl") {
-		tlsconfig, err := rz2.NewTLSConfig(defaultconfig.Cafile, defaultconfig.Crtfile, defaultconfig.Keyfile)
+		tlsconfig, err := rz2.NewTLSConfig(broker.Cafile, broker.Crtfile, broker.Keyfile)
 		if err != nil {
 			return nil, err
 		}
@@ -177,6 +241,16 @@ func main() {
 
 	defaultconfig.Println()
 
+	if defaultconfig.Layout != "" {
+		_, err := readlayout(defaultconfig.Layout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, loc := range layout.Locations() {
+			fmt.Printf("location: %s\n", loc)
+		}
+	}
+
 	basedir := filepath.Join(defaultconfig.Homedir, "rz2/recorder/log")
 	os.MkdirAll(basedir, 0755)
 	logfile, err := os.Create(filepath.Join(basedir, fmt.Sprintf("log%s.0", time.Now().Format("20060102150405"))))
@@ -187,45 +261,101 @@ func main() {
 	log.SetOutput(logfile)
 
 	recdir := filepath.Join(defaultconfig.Homedir, "rz2/recorder")
+	filter := rz2.NewTopicFilter(defaultconfig)
 	records := make(map[string]*Record)
 	nrecords := 0
 
-	srvaddress, err := rz2.ServerAddress(defaultconfig.Server)
-	if srvaddress == "" {
+	var recordslock sync.Mutex
+	// buffered not to block message handlers while a backup is copied
+	backupch := make(chan string, 256)
+	brokers, err := defaultconfig.BrokerList()
+	if err != nil {
 		log.Fatal(err)
 	}
-	client, err := StartSubscriber(srvaddress, defaultconfig.List, func(client mqtt.Client, msg mqtt.Message) {
-		lis := strings.Split(msg.Topic(), "/")
-		var rec *Record
-		rec = records[lis[0]]
-		if rec == nil {
-			tmprecdir := filepath.Join(recdir, strings.Replace(lis[0], ":", "_", -1))
-			os.MkdirAll(tmprecdir, 0755)
-			r := NewRecord(tmprecdir, lis[0])
-			_, _, err := r.setdest()
+	clients := make([]mqtt.Client, len(brokers))
+	for i, b := range brokers {
+		srvaddress, err := rz2.ServerAddress(b.Server)
+		if srvaddress == "" {
+			log.Fatal(err)
+		}
+		b.Server = srvaddress
+		brokers[i] = b
+		site := b.Site
+		client, err := StartSubscriber(b, defaultconfig.List, func(client mqtt.Client, msg mqtt.Message) {
+			if !filter.Accept(msg.Topic()) {
+				return
+			}
+			lis := strings.Split(msg.Topic(), "/")
+			// the same MAC address seen via two brokers is recorded separately
+			// as sites of brokers are unique
+			key := fmt.Sprintf("%s/%s", site, lis[0])
+			recordslock.Lock()
+			rec := records[key]
+			if rec == nil {
+				rec = NewRecord(recdir, site, lis[0])
+				_, _, err := rec.setdest()
+				if err != nil {
+					log.Fatal(err)
+				}
+				records[key] = rec
+				nrecords++
+			}
+			recordslock.Unlock()
+			// a device reassigned in the layout is recorded under its new location at once
+			if rec.moved(time.Now()) {
+				oldp, newp, err := rec.setdest()
+				if err != nil {
+					log.Printf("setdest: %s\n", err)
+					return
+				}
+				log.Printf("moved: %s -> %s\n", oldp, newp)
+				go func() {
+					backupch <- oldp
+				}()
+			}
+			err := rec.record(msg)
 			if err != nil {
-				log.Fatal(err)
+				log.Println(err)
 			}
-			records[lis[0]] = r
-			nrecords++
-		}
-		err := records[lis[0]].record(msg)
-		if err != nil {
-			log.Println(err)
+		})
+		if client == nil {
+			log.Fatal(err)
 		}
-	})
+		clients[i] = client
+	}
 
 	ticker := time.NewTicker(time.Minute * 60)
 	// ticker := time.NewTicker(time.Second * 10)
 	conticker := time.NewTicker(time.Second)
-	backupch := make(chan string)
+	archivech := make(chan string, 256)
+	go func() {
+		for {
+			select {
+			case p := <-archivech:
+				dst, err := rz2.ArchivePath(recdir, defaultconfig.Archivedir, p)
+				if err != nil {
+					log.Printf("archive: %s\n", err)
+					continue
+				}
+				err = rz2.ArchiveFile(p, dst)
+				if err != nil {
+					log.Printf("archive: %s\n", err)
+					continue
+				}
+				fmt.Printf("archive: %s -> %s\n", p, dst)
+			}
+		}
+	}()
 	go func() {
 		for {
 			select {
 			case p := <-backupch:
 				oldpath := p
-				macdir := filepath.Base(filepath.Dir(p))
-				newpath := filepath.Join(defaultconfig.Backupdir, macdir, filepath.Base(p))
+				reldir, err := filepath.Rel(recdir, filepath.Dir(p))
+				if err != nil {
+					reldir = filepath.Base(filepath.Dir(p))
+				}
+				newpath := filepath.Join(defaultconfig.Backupdir, reldir, filepath.Base(p))
 				os.MkdirAll(filepath.Dir(newpath), 0755)
 				newfile, err := os.Create(newpath)
 				if err != nil {
@@ -242,20 +372,32 @@ func main() {
 					fmt.Println(err)
 				}
 				fmt.Printf("backup: %s -> %s\n", oldpath, newpath)
+				if defaultconfig.Archivedir != "" {
+					archivech <- oldpath
+				}
 			}
 		}
 	}()
 	for {
 		select {
 		case <-ticker.C:
+			status := filter.Status()
+			fmt.Print(status)
+			log.Printf("status:\n%s", status)
+			for i, b := range brokers {
+				log.Printf("broker %s (site: %s): connected= %t", b.Server, b.Site, clients[i].IsConnected())
+			}
+			recordslock.Lock()
 			for _, r := range records {
 				oldp, _, err := r.setdest()
 				fmt.Println(oldp, err)
 				if err != nil {
 					log.Printf("setdest: %s\n", err)
+					continue
 				}
 				backupch <- oldp
 			}
+			recordslock.Unlock()
 			if defaultconfig.Removehour > 0 {
 				err := removeoldfiles(-1 * time.Duration(defaultconfig.Removehour) * time.Hour)
 				if err != nil {
@@ -265,18 +407,27 @@ func main() {
 				}
 			}
 		case <-conticker.C:
-			if !client.IsConnected() {
-				log.Printf("not connected: %s", time.Now().Format("2006-01-02 15:04:05"))
-				for {
-					if client.IsConnected() {
-						log.Printf("reconnected: %s", time.Now().Format("2006-01-02 15:04:05"))
-						for _, t := range defaultconfig.List {
-							client.Subscribe(t, 0, nil)
-						}
-						break
+			if defaultconfig.Layout != "" {
+				ok, err := readlayout(defaultconfig.Layout)
+				if err != nil {
+					log.Printf("layout: %s\n", err)
+				} else if ok {
+					log.Printf("layout: reloaded %s\n", defaultconfig.Layout)
+				}
+			}
+			// a broker which is down must not block the others
+			for i, client := range clients {
+				if client.IsConnected() {
+					continue
+				}
+				log.Printf("not connected to %s: %s", brokers[i].Server, time.Now().Format("2006-01-02 15:04:05"))
+				token := client.Connect()
+				token.WaitTimeout(time.Second * 5)
+				if client.IsConnected() {
+					log.Printf("reconnected to %s: %s", brokers[i].Server, time.Now().Format("2006-01-02 15:04:05"))
+					for _, t := range defaultconfig.List {
+						client.Subscribe(t, 0, nil)
 					}
-					token := client.Connect()
-					token.WaitTimeout(time.Second * 5)
 				}
 			}
 		}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/yofu/rz2"
+)
+
+var (
+	defaultconfig = &rz2.Config{
+		Homedir: os.Getenv("HOME"),
+		List:    make([]string, 0),
+	}
+)
+
+// RosetteUnit holds rosettes of a device
+type RosetteUnit struct {
+	streams []*rz2.RosetteStream
+}
+
+func printHeader() {
+	fmt.Println("# time macaddress rosette max[με] min[με] angle[deg] shear[με] stress1[MPa] stress2[MPa] vonmises[MPa]")
+}
+
+func printResult(mac string, r rz2.Rosette, res rz2.RosetteResult) {
+	fmt.Printf("%s %s %s %10.2f %10.2f %7.2f %10.2f %9.3f %9.3f %9.3f\n", rz2.ConvertUnixtime(res.Time).Format("2006-01-02T15:04:05.000"), mac, r.Name, res.Max, res.Min, res.Angle, res.Shear, res.Stress1, res.Stress2, res.VonMises)
+}
+
+func ReadData(datdir string, fns ...string) error {
+	units := make(map[string]*RosetteUnit)
+	for _, d := range rz2.Devices() {
+		if len(d.Rosettes) == 0 {
+			continue
+		}
+		unit := &RosetteUnit{}
+		for _, r := range d.Rosettes {
+			unit.streams = append(unit.streams, rz2.NewRosetteStream(r))
+		}
+		units[d.MacAddress] = unit
+	}
+	if len(units) == 0 {
+		return fmt.Errorf("no rosette in the config")
+	}
+	printHeader()
+	for _, fn := range fns {
+		err := rz2.ScanServerRecord(filepath.Join(datdir, fn), 0, nil, func(rec rz2.ServerRecord, _ interface{}) error {
+			t, err := rz2.ParseTopic(rec.Topic)
+			if err != nil || t.Extension != "str01" {
+				return nil
+			}
+			unit, ok := units[t.MacAddress]
+			if !ok {
+				return nil
+			}
+			s, err := rz2.Decode(rec.Topic, rec.Content)
+			if err != nil {
+				return nil
+			}
+			for _, stream := range unit.streams {
+				for _, res := range stream.Add(t.Channel, s) {
+					printResult(t.MacAddress, stream.Rosette, res)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	conffn := flag.String("config", "", "config file with [[device.rosette]]")
+	datdir := flag.String("dir", ".", "dat directory")
+	zerofn := flag.String("zero", "", "zero point file")
+	flag.Parse()
+
+	if *conffn == "" || flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: rz2rosette -config file [-dir dir] [-zero file] datfile...")
+		os.Exit(1)
+	}
+	err := defaultconfig.ReadConfig(*conffn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *zerofn != "" {
+		z, err := rz2.LoadZeroStore(*zerofn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rz2.RegisterZeroStore(z)
+	}
+	err = ReadData(*datdir, flag.Args()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
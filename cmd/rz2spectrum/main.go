@@ -18,6 +18,12 @@ import (
 	"github.com/yofu/rz2"
 )
 
+// HasDatFile reports whether dir has a file of the hour of t
+func HasDatFile(t time.Time, dir string) bool {
+	lis, err := filepath.Glob(filepath.Join(dir, t.Format("2006-01-02-15")+"*"))
+	return err == nil && len(lis) > 0
+}
+
 func SearchDatFile(t time.Time, dir string) ([]string, error) {
 	stat, err := os.Stat(dir)
 	if err != nil {
@@ -108,6 +114,7 @@ type AccUnit struct {
 	ampx       []float64
 	ampy       []float64
 	ampz       []float64
+	stream     *rz2.AccStream
 }
 
 func NewAccUnit(name string, fftstart, fftsize int) *AccUnit {
@@ -123,6 +130,7 @@ func NewAccUnit(name string, fftstart, fftsize int) *AccUnit {
 		ampx:       make([]float64, fftsize),
 		ampy:       make([]float64, fftsize),
 		ampz:       make([]float64, fftsize),
+		stream:     rz2.NewAccStream(0),
 	}
 }
 
@@ -256,46 +264,70 @@ var (
 	accunits = make(map[string]*AccUnit, 0)
 )
 
+type accPacket struct {
+	series *rz2.Series
+	// acd10 of archives, whose times are already reconstructed
+	times []int64
+	data  [][]float64
+	err   error
+}
+
+// decodeAcc runs in parallel in rz2.ScanServerRecord
+func decodeAcc(rec rz2.ServerRecord) (interface{}, error) {
+	t, err := rz2.ParseTopicLenient(rec.Topic)
+	if err != nil || (t.Extension != "acc02" && t.Extension != rz2.ExtDecimated10) {
+		return nil, nil
+	}
+	if _, ok := accunits[t.MacAddress]; !ok {
+		return nil, nil
+	}
+	if t.Extension == rz2.ExtDecimated10 {
+		times, data, err := rz2.ConvertDecimated(rec.Content)
+		return &accPacket{times: times, data: data, err: err}, nil
+	}
+	s, err := rz2.Decode(rec.Topic, rec.Content)
+	return &accPacket{series: s, err: err}, nil
+}
+
 func ReadData(datdir string, fns ...string) error {
 	for _, fn := range fns {
-		records, _ := rz2.ReadServerRecord(filepath.Join(datdir, fn))
-		// if err != nil {
-		// 	return err
-		// }
-		var unit *AccUnit
-		for _, rec := range records {
-			lis := strings.Split(rec.Topic, "/")
-			if _, ok := accunits[lis[0]]; !ok {
-				continue
+		err := rz2.ScanServerRecord(filepath.Join(datdir, fn), 0, decodeAcc, func(rec rz2.ServerRecord, v interface{}) error {
+			if v == nil {
+				return nil
 			}
-			unit = accunits[lis[0]]
-			switch lis[2] {
-			case "acc02":
-				send_time, acc, xind, err := rz2.ConvertAccPacketWithTime(rec.Content)
-				if err != nil {
-					fmt.Println(err)
-				}
-				size := (len(acc) - xind) / 3
-				var dt float64
-				var lt int64 = 0
-				if unit.time != nil && len(unit.time) > 0 {
-					lt = int64(unit.time[len(unit.time)-1])
-				}
-				if lt == 0 {
-					dt = 8.0
-				} else {
-					dt = float64(send_time-lt) / float64(size)
-				}
-				for i := 0; i < size; i++ {
-					ct := int(float64(send_time) - float64(size-1-i)*dt)
-					unit.time = append(unit.time, ct)
-					unit.xacc = append(unit.xacc, acc[xind+3*i])
-					unit.yacc = append(unit.yacc, acc[xind+3*i+1])
-					unit.zacc = append(unit.zacc, acc[xind+3*i+2])
+			t, _ := rz2.ParseTopicLenient(rec.Topic)
+			unit := accunits[t.MacAddress]
+			p := v.(*accPacket)
+			if p.err != nil {
+				fmt.Println(p.err)
+				return nil
+			}
+			if p.series == nil {
+				for i, v := range p.data {
+					unit.time = append(unit.time, int(p.times[i]))
+					unit.xacc = append(unit.xacc, v[0])
+					unit.yacc = append(unit.yacc, v[1])
+					unit.zacc = append(unit.zacc, v[2])
 				}
-				lt = send_time
-			default:
+				return nil
+			}
+			samples := p.series.Samples
+			times, gap := unit.stream.AddSeries(p.series)
+			if gap != nil {
+				fmt.Printf("%s: gap %s - %s (missing %d, jump %t)\n", unit.name,
+					rz2.ConvertUnixtime(int64(gap.Start)).Format("15:04:05.000"),
+					rz2.ConvertUnixtime(int64(gap.End)).Format("15:04:05.000"), gap.Missing, gap.Jump)
 			}
+			for i := 0; i < len(times); i++ {
+				unit.time = append(unit.time, int(times[i]))
+				unit.xacc = append(unit.xacc, samples[i].Values[0])
+				unit.yacc = append(unit.yacc, samples[i].Values[1])
+				unit.zacc = append(unit.zacc, samples[i].Values[2])
+			}
+			return nil
+		})
+		if err != nil {
+			fmt.Println(err)
 		}
 	}
 	return nil
@@ -337,8 +369,10 @@ func main() {
 	fftsize := flag.Int("fftsize", 0, "FFT size")
 	subave := flag.Bool("subave", true, "subtract average or not")
 	datdir := flag.String("dir", "..\\dat", "dat directory")
+	archivedir := flag.String("archive", "", "archive directory to fall back to when raw data has been removed (10 Hz)")
 	smooth := flag.Int("smooth", 0, "smooting")
 	plotonly := flag.Bool("p", false, "plot only")
+	accrange := flag.String("range", "2g", "measurement range of acc sensors (2g, 4g or 8g)")
 	flag.Parse()
 
 	loc, _ := time.LoadLocation("Asia/Tokyo")
@@ -350,7 +384,12 @@ func main() {
 
 	filename := fmt.Sprintf("%s-%d-%d", t.Format("2006-01-02-15-04-05"), *fftsize, *smooth)
 	if !*plotonly {
-		datfn, err := SearchDatFile(t, *datdir)
+		dir := *datdir
+		if *archivedir != "" && !HasDatFile(t, dir) {
+			dir = *archivedir
+			fmt.Printf("ARCHIVE         : %s\n", dir)
+		}
+		datfn, err := SearchDatFile(t, dir)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -362,11 +401,19 @@ func main() {
 		unames := []string{"flab01", "flab02", "flab03", "flab04"}
 		// unames := []string{"rz8", "rz9"}
 		// unames := []string{"moncli01"}
+		rng, err := rz2.ParseAccRange(*accrange)
+		if err != nil {
+			log.Fatal(err)
+		}
 		for _, uname := range unames {
 			accunits[macaddress[uname]] = NewAccUnit(uname, fftstart, *fftsize)
+			err = rz2.RegisterDevice(rz2.Device{MacAddress: macaddress[uname], Name: uname, AccRange: rng})
+			if err != nil {
+				log.Fatal(err)
+			}
 		}
 
-		err = ReadData(*datdir, datfn...)
+		err = ReadData(dir, datfn...)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/yofu/rz2"
+)
+
+// TiltUnit holds tilt of a topic
+type TiltUnit struct {
+	topic  string
+	filter *rz2.GravityFilter
+	tilts  []rz2.Tilt
+	next   int64
+}
+
+func ReadData(datdir string, tau float64, interval int64, fns ...string) (map[string]*TiltUnit, error) {
+	units := make(map[string]*TiltUnit)
+	for _, fn := range fns {
+		err := rz2.ScanServerRecord(filepath.Join(datdir, fn), 0, nil, func(rec rz2.ServerRecord, _ interface{}) error {
+			t, err := rz2.ParseTopic(rec.Topic)
+			if err != nil || t.Extension != "acc02" {
+				return nil
+			}
+			s, err := rz2.Decode(rec.Topic, rec.Content)
+			if err != nil {
+				return nil
+			}
+			unit, ok := units[rec.Topic]
+			if !ok {
+				unit = &TiltUnit{
+					topic:  rec.Topic,
+					filter: rz2.NewGravityFilter(tau),
+				}
+				units[rec.Topic] = unit
+			}
+			for _, smp := range s.Samples {
+				unit.filter.Add(smp.Time, [3]float64{smp.Values[0], smp.Values[1], smp.Values[2]})
+				if unit.next == 0 {
+					// wait for the filter to settle
+					unit.next = smp.Time + int64(tau*1000.0)
+				}
+				if smp.Time >= unit.next {
+					unit.tilts = append(unit.tilts, rz2.NewTilt(smp.Time, unit.filter.Gravity()))
+					unit.next = smp.Time + interval
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return units, nil
+}
+
+func report(unit *TiltUnit, verbose bool) {
+	fmt.Printf("%s: %d samples\n", unit.topic, unit.filter.Count())
+	if len(unit.tilts) == 0 {
+		fmt.Print("    not enough data\n")
+		return
+	}
+	if verbose {
+		for _, t := range unit.tilts {
+			fmt.Printf("    %s %9.4f %9.4f %9.4f\n", rz2.ConvertUnixtime(t.Time).Format("2006-01-02 15:04:05"), t.Roll, t.Pitch, t.Angle())
+		}
+	}
+	var roll, pitch float64
+	for _, t := range unit.tilts {
+		roll += t.Roll
+		pitch += t.Pitch
+	}
+	roll /= float64(len(unit.tilts))
+	pitch /= float64(len(unit.tilts))
+	droll, dpitch := rz2.TiltDrift(unit.tilts)
+	last := unit.tilts[len(unit.tilts)-1]
+	g := last.Gravity
+	fmt.Printf("    gravity [gal] : %10.3f %10.3f %10.3f\n", g[0], g[1], g[2])
+	fmt.Printf("    roll [°]      : %10.4f (drift %+.4f °/day)\n", roll, droll)
+	fmt.Printf("    pitch [°]     : %10.4f (drift %+.4f °/day)\n", pitch, dpitch)
+	fmt.Printf("    tilt [°]      : %10.4f\n", last.Angle())
+	m := rz2.SuggestAxes(g)
+	fmt.Printf("    axes          : ns= %d ew= %d ud= %d sign= %v\n", m.NS, m.EW, m.UD, m.Sign)
+	r := m.Rotation()
+	fmt.Printf("    rotation      : [[%.1f, %.1f, %.1f], [%.1f, %.1f, %.1f], [%.1f, %.1f, %.1f]]\n",
+		r[0][0], r[0][1], r[0][2],
+		r[1][0], r[1][1], r[1][2],
+		r[2][0], r[2][1], r[2][2])
+}
+
+func main() {
+	conffn := flag.String("config", "", "config file")
+	datdir := flag.String("dir", ".", "dat directory")
+	tau := flag.Float64("tau", 10.0, "time constant of low-pass filter [s]")
+	interval := flag.Float64("interval", 60.0, "output interval [s]")
+	verbose := flag.Bool("v", false, "print tilt at each interval")
+	flag.Parse()
+
+	if *conffn != "" {
+		conf := &rz2.Config{}
+		err := conf.ReadConfig(*conffn)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: rz2tilt [-config fn] [-dir dir] [-tau s] [-interval s] [-v] datfile...")
+		os.Exit(1)
+	}
+
+	units, err := ReadData(*datdir, *tau, int64(*interval*1000.0), flag.Args()...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	topics := make([]string, 0, len(units))
+	for t := range units {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	for _, t := range topics {
+		report(units[t], *verbose)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yofu/rz2"
+)
+
+// WindUnit holds wind of a gill01 topic
+type WindUnit struct {
+	acc   *rz2.WindAccumulator
+	rose  *rz2.WindRose
+	stats []*rz2.WindStats
+}
+
+func ReadData(datdir, archivedir string, period, gust int64, sectors int, bins []float64, start, end int64, fns ...string) (map[string]*WindUnit, error) {
+	units := make(map[string]*WindUnit)
+	for _, fn := range fns {
+		path := filepath.Join(datdir, fn)
+		if archivedir != "" {
+			// fall back to the archive when raw data has been removed
+			p, archived, err := rz2.FindDatFile(datdir, archivedir, path)
+			if err != nil {
+				return nil, err
+			}
+			if archived {
+				fmt.Printf("# archive: %s\n", p)
+			}
+			path = p
+		}
+		err := rz2.ScanServerRecord(path, 0, nil, func(rec rz2.ServerRecord, _ interface{}) error {
+			t, err := rz2.ParseTopic(rec.Topic)
+			if err != nil || t.Extension != "gill01" {
+				return nil
+			}
+			s, err := rz2.Decode(rec.Topic, rec.Content)
+			if err != nil || len(s.Samples) == 0 {
+				return nil
+			}
+			if s.SendTime < start || s.SendTime >= end {
+				return nil
+			}
+			unit, ok := units[rec.Topic]
+			if !ok {
+				rose, err := rz2.NewWindRose(sectors, bins)
+				if err != nil {
+					return err
+				}
+				unit = &WindUnit{
+					acc:  rz2.NewWindAccumulator(period, gust),
+					rose: rose,
+				}
+				units[rec.Topic] = unit
+			}
+			for _, smp := range s.Samples {
+				direction, speed := smp.Values[0], smp.Values[1]
+				if st := unit.acc.Add(smp.Time, direction, speed); st != nil {
+					unit.stats = append(unit.stats, st)
+				}
+				unit.rose.Add(direction, speed)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, unit := range units {
+		if st := unit.acc.Flush(); st != nil {
+			unit.stats = append(unit.stats, st)
+		}
+	}
+	return units, nil
+}
+
+func report(topic string, unit *WindUnit) {
+	fmt.Printf("# %s\n", topic)
+	fmt.Println("# start n mean[m/s] vector[m/s] direction[deg] std[deg] max[m/s] gust[m/s] gustfactor turbulence")
+	for _, st := range unit.stats {
+		fmt.Printf("%s %4d %6.2f %6.2f %6.1f %5.1f %6.2f %6.2f %5.2f %5.3f\n", rz2.ConvertUnixtime(st.Start).Format("2006-01-02T15:04:05"), st.Count, st.MeanSpeed, st.VectorSpeed, st.Direction, st.DirectionStd, st.MaxSpeed, st.Gust, st.GustFactor, st.Turbulence)
+	}
+	r := unit.rose
+	fmt.Printf("# sector frequency [%%] of %.0f samples:", r.Total())
+	for k := 0; k <= len(r.Bins); k++ {
+		fmt.Printf(" %s,", r.ClassName(k))
+	}
+	fmt.Println()
+	width := 360.0 / float64(r.Sectors)
+	for s := 0; s < r.Sectors; s++ {
+		fmt.Printf("%6.1f", float64(s)*width)
+		for k := 0; k <= len(r.Bins); k++ {
+			fmt.Printf(" %6.2f", 100.0*r.Frequency(s, k))
+		}
+		fmt.Println()
+	}
+}
+
+func parseBins(s string) ([]float64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	lis := strings.Split(s, ",")
+	rtn := make([]float64, len(lis))
+	for i, l := range lis {
+		v, err := strconv.ParseFloat(strings.TrimSpace(l), 64)
+		if err != nil {
+			return nil, err
+		}
+		rtn[i] = v
+	}
+	return rtn, nil
+}
+
+func LocationFiles(recdir, layoutfn, location string, st, et time.Time) ([]string, error) {
+	layout, err := rz2.ReadLayout(layoutfn)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := rz2.ParseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	return layout.Files(recdir, loc, st, et)
+}
+
+func main() {
+	datdir := flag.String("dir", ".", "dat directory")
+	archivedir := flag.String("archive", "", "archive directory")
+	layoutfn := flag.String("layout", "", "layout file")
+	location := flag.String("location", "", "site/building/floor/point")
+	start := flag.String("start", "1970-01-01T00:00:00", "start time")
+	end := flag.String("end", time.Now().Format("2006-01-02T15:04:05"), "end time")
+	period := flag.Int64("period", 600, "averaging period [s]")
+	gust := flag.Int64("gust", 3, "duration of gust [s]")
+	sectors := flag.Int("sectors", 16, "number of direction sectors")
+	binstr := flag.String("bins", "1,2,4,6,8,10", "upper bounds of speed classes [m/s]")
+	svgfn := flag.String("svg", "", "write the wind rose to svg file (with the topic for more than one anemometer)")
+	size := flag.Int("size", 600, "size of the wind rose [px]")
+	flag.Parse()
+
+	st, err := time.ParseInLocation("2006-01-02T15:04:05", *start, time.Local)
+	if err != nil {
+		log.Fatal(err)
+	}
+	et, err := time.ParseInLocation("2006-01-02T15:04:05", *end, time.Local)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bins, err := parseBins(*binstr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	datfn := flag.Args()
+	if *location != "" {
+		fns, err := LocationFiles(*datdir, *layoutfn, *location, st, et)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for i, fn := range fns {
+			rel, err := filepath.Rel(*datdir, fn)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fns[i] = rel
+		}
+		datfn = fns
+	}
+	if len(datfn) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: rz2wind [-dir dir] [-archive dir] [-layout file -location loc] [-start time] [-end time] [-period s] [-svg file] datfile...")
+		os.Exit(1)
+	}
+
+	units, err := ReadData(*datdir, *archivedir, *period*1000, *gust*1000, *sectors, bins, st.UnixNano()/1000000, et.UnixNano()/1000000, datfn...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	topics := make([]string, 0, len(units))
+	for topic := range units {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	for _, topic := range topics {
+		report(topic, units[topic])
+		if *svgfn == "" {
+			continue
+		}
+		fn := *svgfn
+		if len(topics) > 1 {
+			ext := filepath.Ext(fn)
+			fn = fmt.Sprintf("%s_%s%s", strings.TrimSuffix(fn, ext), strings.NewReplacer(":", "", "/", "_").Replace(topic), ext)
+		}
+		f, err := os.Create(fn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		title := fmt.Sprintf("%s %s - %s", topic, st.Format("2006-01-02 15:04"), et.Format("2006-01-02 15:04"))
+		err = units[topic].rose.WriteSVG(f, title, *size)
+		if err != nil {
+			f.Close()
+			log.Fatal(err)
+		}
+		err = f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
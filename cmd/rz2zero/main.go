@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/yofu/rz2"
+)
+
+var (
+	defaultconfig = &rz2.Config{
+		Server:  "tcp://192.168.100.148:1883",
+		Homedir: os.Getenv("HOME"),
+		List:    make([]string, 0),
+	}
+)
+
+type rawSample struct {
+	time int64
+	raw  float64
+}
+
+// StrainUnit holds data of a str01 channel
+type StrainUnit struct {
+	mac     string
+	channel int
+	gauge   rz2.StrainGauge
+	recent  []rawSample // raw values in the last capture duration
+	trend   *rz2.StrainTrend
+}
+
+// TemperatureUnit holds data of a sht31 topic
+type TemperatureUnit struct {
+	recent []rawSample
+	trend  *rz2.StrainTrend
+}
+
+func keep(samples []rawSample, duration int64) []rawSample {
+	if len(samples) == 0 {
+		return samples
+	}
+	last := samples[len(samples)-1].time
+	i := 0
+	for i < len(samples) && samples[i].time < last-duration {
+		i++
+	}
+	if i > len(samples)/2 {
+		samples = append(samples[:0], samples[i:]...)
+		return samples
+	}
+	return samples[i:]
+}
+
+func ReadData(datdir string, duration, interval int64, fns ...string) (map[string]*StrainUnit, map[string]*TemperatureUnit, error) {
+	strains := make(map[string]*StrainUnit)
+	temps := make(map[string]*TemperatureUnit)
+	for _, fn := range fns {
+		err := rz2.ScanServerRecord(filepath.Join(datdir, fn), 0, nil, func(rec rz2.ServerRecord, _ interface{}) error {
+			t, err := rz2.ParseTopic(rec.Topic)
+			if err != nil {
+				return nil
+			}
+			switch t.Extension {
+			case "str01":
+				s, err := rz2.Decode(rec.Topic, rec.Content)
+				if err != nil {
+					return nil
+				}
+				unit, ok := strains[rec.Topic]
+				if !ok {
+					device, _ := rz2.LookupDevice(t.MacAddress)
+					unit = &StrainUnit{
+						mac:     t.MacAddress,
+						channel: t.Channel,
+						gauge:   device.StrainGauge(t.Channel),
+						trend:   rz2.NewStrainTrend(interval),
+					}
+					strains[rec.Topic] = unit
+				}
+				for _, smp := range s.Samples {
+					unit.recent = append(unit.recent, rawSample{smp.Time, smp.Values[1]})
+					unit.trend.AddStrain(smp.Time, smp.Values[0])
+				}
+				unit.recent = keep(unit.recent, duration)
+			case "sht31":
+				s, err := rz2.Decode(rec.Topic, rec.Content)
+				if err != nil {
+					return nil
+				}
+				unit, ok := temps[rec.Topic]
+				if !ok {
+					unit = &TemperatureUnit{trend: rz2.NewStrainTrend(interval)}
+					temps[rec.Topic] = unit
+				}
+				for _, smp := range s.Samples {
+					unit.recent = append(unit.recent, rawSample{smp.Time, smp.Values[0]})
+					unit.trend.AddTemperature(smp.Time, smp.Values[0])
+				}
+				unit.recent = keep(unit.recent, duration)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return strains, temps, nil
+}
+
+func sortedKeys(units map[string]*StrainUnit) []string {
+	keys := make([]string, 0, len(units))
+	for k := range units {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// temperature returns the average temperature of the reference of the gauge after start
+func temperature(temps map[string]*TemperatureUnit, g rz2.StrainGauge, start int64) float64 {
+	if g.Reference == "" {
+		return math.NaN()
+	}
+	unit, ok := temps[g.Reference]
+	if !ok {
+		return math.NaN()
+	}
+	sum := 0.0
+	n := 0
+	for _, s := range unit.recent {
+		if s.time >= start {
+			sum += s.raw
+			n++
+		}
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return sum / float64(n)
+}
+
+// Capture adds zero points of all channels as the averages of the last duration
+func Capture(store *rz2.ZeroStore, strains map[string]*StrainUnit, temps map[string]*TemperatureUnit) error {
+	for _, key := range sortedKeys(strains) {
+		unit := strains[key]
+		if len(unit.recent) == 0 {
+			continue
+		}
+		raw := make([]float64, len(unit.recent))
+		for i, s := range unit.recent {
+			raw[i] = s.raw
+		}
+		start := unit.recent[0].time
+		z, err := rz2.CaptureZero(unit.mac, unit.channel, start, raw, temperature(temps, unit.gauge, start))
+		if err != nil {
+			return err
+		}
+		err = store.Add(z)
+		if err != nil {
+			return err
+		}
+		printZero(z)
+	}
+	return nil
+}
+
+// Trend prints strain, temperature, thermal and structural strain of each channel per interval
+func Trend(store *rz2.ZeroStore, strains map[string]*StrainUnit, temps map[string]*TemperatureUnit) error {
+	for _, key := range sortedKeys(strains) {
+		unit := strains[key]
+		if ref, ok := temps[unit.gauge.Reference]; ok {
+			err := unit.trend.MergeTemperature(ref.trend)
+			if err != nil {
+				return err
+			}
+		}
+		points := unit.trend.Points()
+		if len(points) == 0 {
+			continue
+		}
+		coef := unit.gauge.Thermal
+		source := "configured"
+		if coef == 0 {
+			c, err := rz2.EstimateThermal(points)
+			if err == nil {
+				coef = c
+				source = "estimated"
+			} else {
+				source = err.Error()
+			}
+		}
+		reference := math.NaN()
+		if z, ok := store.Lookup(unit.mac, unit.channel, points[0].Time); ok {
+			reference = z.Temperature
+		}
+		if math.IsNaN(reference) {
+			for _, p := range points {
+				if !math.IsNaN(p.Temperature) {
+					reference = p.Temperature
+					break
+				}
+			}
+		}
+		rz2.SeparateThermal(points, coef, reference)
+		fmt.Printf("# %s thermal= %.3f με/'C (%s) reference= %.2f 'C\n", key, coef, source, reference)
+		fmt.Println("# time strain temperature thermal structural")
+		for _, p := range points {
+			fmt.Printf("%s %10.2f %7.2f %10.2f %10.2f\n", rz2.ConvertUnixtime(p.Time).Format("2006-01-02T15:04:05"), p.Strain, p.Temperature, p.Thermal, p.Structural)
+		}
+	}
+	return nil
+}
+
+func printZero(z rz2.ZeroPoint) {
+	fmt.Printf("%s/%02d: %s raw= %.1f temperature= %.2f\n", z.MacAddress, z.Channel, rz2.ConvertUnixtime(z.Time).Format("2006-01-02 15:04:05"), z.Raw, z.Temperature)
+}
+
+func parseChannel(s string) (string, int, error) {
+	ind := strings.LastIndex(s, "/")
+	if ind < 0 {
+		return "", 0, fmt.Errorf("channel must be mac/ch: %s", s)
+	}
+	ch, err := rz2.ParseChannel(s[ind+1:])
+	if err != nil {
+		return "", 0, err
+	}
+	return s[:ind], ch, rz2.NewTopic(s[:ind], ch, "str01").Validate()
+}
+
+// Publish sends a zero control message to receivers such as valmon
+func Publish(server string, topic rz2.Topic, c rz2.ZeroControl) error {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(server)
+	opts.SetAutoReconnect(false)
+	opts.SetClientID(fmt.Sprintf("rz2zero_%d", time.Now().UnixNano()))
+	if strings.HasPrefix(server, "ssl") {
+		tlsconfig, err := rz2.NewTLSConfig(defaultconfig.Cafile, defaultconfig.Crtfile, defaultconfig.Keyfile)
+		if err != nil {
+			return err
+		}
+		opts.SetTLSConfig(tlsconfig)
+	}
+	client := mqtt.NewClient(opts)
+	token := client.Connect()
+	token.WaitTimeout(time.Second * 5)
+	if token.Error() != nil {
+		return token.Error()
+	}
+	defer client.Disconnect(250)
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	token = client.Publish(topic.String(), 1, false, b)
+	token.WaitTimeout(time.Second * 5)
+	return token.Error()
+}
+
+func main() {
+	conffn := flag.String("config", "", "config file")
+	storefn := flag.String("store", "zero.toml", "zero point file")
+	datdir := flag.String("dir", ".", "dat directory")
+	list := flag.Bool("list", false, "list zero points")
+	capture := flag.Int64("capture", 0, "capture zero points of all channels from the last duration of data [s]")
+	set := flag.String("set", "", "set zero point of mac/ch from -raw")
+	raw := flag.Float64("raw", math.NaN(), "raw value of -set or -publish")
+	temp := flag.Float64("temperature", math.NaN(), "temperature of -set or -publish ['C]")
+	publish := flag.String("publish", "", "publish zero control message to mac/ch")
+	server := flag.String("server", "", "mqtt server of -publish")
+	trend := flag.Int64("trend", 0, "print strain trend separating thermal strain per interval [s]")
+	flag.Parse()
+
+	if *conffn != "" {
+		err := defaultconfig.ReadConfig(*conffn)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *publish != "" {
+		mac, ch, err := parseChannel(*publish)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c := rz2.ZeroControl{Time: time.Now().UnixNano() / 1000000}
+		if !math.IsNaN(*raw) {
+			c.Raw = raw
+		}
+		if !math.IsNaN(*temp) {
+			c.Temperature = temp
+		}
+		if *server == "" {
+			*server = defaultconfig.Server
+		}
+		err = Publish(*server, rz2.ZeroControlTopic(mac, ch), c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	store, err := rz2.LoadZeroStore(*storefn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rz2.RegisterZeroStore(store)
+
+	switch {
+	case *set != "":
+		mac, ch, err := parseChannel(*set)
+		if err != nil {
+			log.Fatal(err)
+		}
+		z := rz2.ZeroPoint{
+			MacAddress:  mac,
+			Channel:     ch,
+			Time:        time.Now().UnixNano() / 1000000,
+			Raw:         *raw,
+			Temperature: *temp,
+		}
+		err = store.Add(z)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printZero(z)
+		err = store.Save()
+		if err != nil {
+			log.Fatal(err)
+		}
+	case *capture > 0 || *trend > 0:
+		if flag.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "usage: rz2zero [-config file] [-store file] [-dir dir] -capture seconds|-trend seconds datfile...")
+			os.Exit(1)
+		}
+		strains, temps, err := ReadData(*datdir, *capture*1000, *trend*1000, flag.Args()...)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *capture > 0 {
+			err := Capture(store, strains, temps)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = store.Save()
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *trend > 0 {
+			err := Trend(store, strains, temps)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	case *list:
+		for _, z := range store.Zeros {
+			printZero(z)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "usage: rz2zero [-config file] [-store file] -list|-set mac/ch -raw value|-publish mac/ch|-capture seconds datfile...|-trend seconds datfile...")
+		os.Exit(1)
+	}
+}
@@ -2,14 +2,14 @@ package main
 
 import (
 	"bufio"
-	"bytes"
-	"encoding/binary"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
@@ -44,10 +44,124 @@ const (
 	Sht
 )
 
+// Extension returns the topic extension of the data type
+func (d Datatype) Extension() string {
+	switch d {
+	case Acc:
+		return "acc02"
+	case Clock:
+		return "clk01"
+	case Ill:
+		return "ill01"
+	case Ir:
+		return "ir01"
+	case Gill:
+		return "gill01"
+	case Sht:
+		return "sht31"
+	default:
+		return "str01"
+	}
+}
+
 var (
 	clients = make([]*Client, 0)
 )
 
+var (
+	zerostore  *rz2.ZeroStore
+	latest     = make(map[string]*rz2.Series) // latest series of each topic
+	latestlock sync.RWMutex
+)
+
+type rosetteRow struct {
+	stream *rz2.RosetteStream
+	row    int // index in rosettestatus
+}
+
+// rosettes of configured devices, and the latest results shown in the status
+var (
+	rosettes      = make(map[string][]rosetteRow)
+	rosettestatus = make([]string, 0)
+	rosettelock   sync.Mutex
+)
+
+// rosetteStats updates results of the rosettes with the str01 message
+func rosetteStats(t rz2.Topic, s *rz2.Series) {
+	rosettelock.Lock()
+	defer rosettelock.Unlock()
+	for _, rr := range rosettes[t.MacAddress] {
+		res := rr.stream.Add(t.Channel, s)
+		if len(res) == 0 {
+			continue
+		}
+		r := res[len(res)-1]
+		rosettestatus[rr.row] = fmt.Sprintf("%s: %s, e1/e2= %.1f/%.1f με, θ= %.1f°, σvm= %.1f MPa", rr.stream.Rosette.Name, rz2.ConvertUnixtime(r.Time).Format("15:04:05.000"), r.Max, r.Min, r.Angle, r.VonMises)
+	}
+}
+
+func latestSeries(topic string) (*rz2.Series, bool) {
+	latestlock.RLock()
+	defer latestlock.RUnlock()
+	s, ok := latest[topic]
+	return s, ok
+}
+
+// referenceTemperature returns the latest temperature of the sht31 measuring the gauge
+func referenceTemperature(g rz2.StrainGauge) float64 {
+	if g.Reference == "" {
+		return math.NaN()
+	}
+	s, ok := latestSeries(g.Reference)
+	if !ok || len(s.Samples) == 0 {
+		return math.NaN()
+	}
+	return s.Mean(0)
+}
+
+// rezero adds a zero point requested by a zero control message to the store
+func rezero(topic string, payload []byte) (string, error) {
+	t, err := rz2.ParseTopic(topic)
+	if err != nil {
+		return "", err
+	}
+	c, err := rz2.ParseZeroControl(payload)
+	if err != nil {
+		return "", err
+	}
+	if c.Time == 0 {
+		c.Time = time.Now().UnixNano() / 1000000
+	}
+	device, _ := rz2.LookupDevice(t.MacAddress)
+	temperature := referenceTemperature(device.StrainGauge(t.Channel))
+	if c.Temperature != nil {
+		temperature = *c.Temperature
+	}
+	var raw []float64
+	if c.Raw != nil {
+		raw = []float64{*c.Raw}
+	} else {
+		s, ok := latestSeries(rz2.NewTopic(t.MacAddress, t.Channel, "str01").String())
+		if !ok {
+			return "", fmt.Errorf("no str01 data")
+		}
+		raw = s.Column(s.Channel("raw"))
+	}
+	z, err := rz2.CaptureZero(t.MacAddress, t.Channel, c.Time, raw, temperature)
+	if err != nil {
+		return "", err
+	}
+	err = zerostore.Add(z)
+	if err != nil {
+		return "", err
+	}
+	err = zerostore.Save()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/%02d: zero= %.1f, Tmp.= %.1f['C]", z.MacAddress, z.Channel, z.Raw, z.Temperature), nil
+}
+
 func ReadClient(fn string) error {
 	f, err := os.Open(fn)
 	if err != nil {
@@ -64,6 +178,10 @@ func ReadClient(fn string) error {
 			fmt.Println("ReadClient: not enough data")
 			continue
 		}
+		if err := rz2.ValidateMacAddress(lis[2]); err != nil {
+			fmt.Printf("ReadClient: %s\n", err)
+			continue
+		}
 		col := 0
 		ty := Strain
 		if len(lis) > 3 {
@@ -105,43 +223,58 @@ func ReadClient(fn string) error {
 	return nil
 }
 
-func accStats(client *Client, msg mqtt.Message) (string, error) {
-	var send_time int64
-	buf := bytes.NewReader(msg.Payload()[:8])
-	binary.Read(buf, binary.BigEndian, &send_time)
-	acc, xind, err := rz2.ConvertAccPacket(msg.Payload()[12:])
+// stats returns a status line of a message decoded by the registered decoder
+func stats(client *Client, msg mqtt.Message) (string, error) {
+	t, err := rz2.ParseTopicLenient(msg.Topic())
 	if err != nil {
 		return "", err
 	}
-	acc = acc[xind : len(acc)-3+xind]
-	xacc := make([]float64, len(acc)/3)
-	yacc := make([]float64, len(acc)/3)
-	zacc := make([]float64, len(acc)/3)
-	avex := 0.0
-	avey := 0.0
-	avez := 0.0
-	for i := 0; i < len(xacc); i++ {
-		xacc[i] = acc[3*i]
-		yacc[i] = acc[3*i+1]
-		zacc[i] = acc[3*i+2]
-		avex += xacc[i]
-		avey += yacc[i]
-		avez += zacc[i]
-	}
-	avex /= float64(len(xacc))
-	avey /= float64(len(yacc))
-	avez /= float64(len(zacc))
-	return fmt.Sprintf("%s: %s, data= %d, ave(x/y/z)= %.3f/%.3f/%.3f", client.hostname, rz2.ConvertUnixtime(send_time).Format("15:04:05.000"), len(xacc), avex, avey, avez), nil
-}
-
-func strainStats(client *Client, msg mqtt.Message) (string, error) {
-	mtime, strain, err := rz2.ConvertStrain(msg.Payload(), 103, false)
+	s, err := rz2.Decode(msg.Topic(), msg.Payload())
 	if err != nil {
 		return "", err
 	}
-	if len(strain) == 0 {
+	latestlock.Lock()
+	latest[msg.Topic()] = s
+	latestlock.Unlock()
+	if t.Extension == "str01" {
+		rosetteStats(t, s)
+	}
+	num := fmt.Sprintf("%02d", t.Channel)
+	if f, ok := statsfuncs[t.Extension]; ok {
+		return f(client, num, s)
+	}
+	return aveStats(client, num, s)
+}
+
+var (
+	statsfuncs = map[string]func(*Client, string, *rz2.Series) (string, error){
+		"str01":  strainStats,
+		"clk01":  clockStats,
+		"sht31":  shtStats,
+		"ir01":   irStats,
+		"gill01": gillStats,
+		"ill01":  illStats,
+	}
+)
+
+func aveStats(client *Client, num string, s *rz2.Series) (string, error) {
+	if len(s.Samples) == 0 {
 		return "", fmt.Errorf("no data")
 	}
+	names := make([]string, len(s.Channels))
+	values := make([]string, len(s.Channels))
+	for i, c := range s.Channels {
+		names[i] = c.Name
+		values[i] = fmt.Sprintf("%.3f", s.Mean(i))
+	}
+	return fmt.Sprintf("%s: %s, data= %d, ave(%s)= %s", client.hostname, rz2.ConvertUnixtime(s.SendTime).Format("15:04:05.000"), len(s.Samples), strings.Join(names, "/"), strings.Join(values, "/")), nil
+}
+
+func strainStats(client *Client, num string, s *rz2.Series) (string, error) {
+	if len(s.Samples) == 0 {
+		return "", fmt.Errorf("no data")
+	}
+	strain := s.Column(s.Channel("raw"))
 	min := strain[0]
 	max := strain[0]
 	for i := 0; i < len(strain); i++ {
@@ -157,71 +290,84 @@ func strainStats(client *Client, msg mqtt.Message) (string, error) {
 	if int(min) > threshold {
 		color = "red"
 	}
-	lis := strings.Split(msg.Topic(), "/")
-	if len(lis) < 2 {
-		return "", fmt.Errorf("unknown client: %s", msg.Topic())
+	ave := s.Mean(s.Channel("strain"))
+	rtn := fmt.Sprintf("%s/%s: %s, data= %d, min/max= [%d/%d](fg:%s), ave= %.1f με", client.hostname, num, rz2.ConvertUnixtime(s.Samples[len(s.Samples)-1].Time).Format("15:04:05.000"), len(strain), int32(min), int32(max), color, ave)
+	// structural strain compensated by the reference temperature
+	ch, _ := rz2.ParseChannel(num)
+	device, _ := rz2.LookupDevice(client.macaddress)
+	g := device.StrainGauge(ch)
+	if z, ok := zerostore.Lookup(client.macaddress, ch, s.Samples[0].Time); ok {
+		if tmp := referenceTemperature(g); g.Thermal != 0 && !math.IsNaN(tmp) && !math.IsNaN(z.Temperature) {
+			rtn += fmt.Sprintf(", str.= %.1f με", ave-g.ThermalStrain(tmp, z))
+		}
 	}
-	return fmt.Sprintf("%s/%s: %s, data= %d, min/max= [%d/%d](fg:%s)", client.hostname, lis[1], rz2.ConvertUnixtime(mtime[len(mtime)-1]).Format("15:04:05.000"), len(strain), int32(min), int32(max), color), nil
+	return rtn, nil
 }
 
-func clockStats(client *Client, msg mqtt.Message) (string, error) {
-	var send_time int64
-	var data int32
-	buf := bytes.NewReader(msg.Payload()[:8])
-	binary.Read(buf, binary.BigEndian, &send_time)
-	buf = bytes.NewReader(msg.Payload()[8:12])
-	binary.Read(buf, binary.BigEndian, &data)
-	// fmt.Println(data, msg.Payload()[8:12])
-	lis := strings.Split(msg.Topic(), "/")
-	if len(lis) < 2 {
-		return "", fmt.Errorf("unknown client: %s", msg.Topic())
-	}
-	return fmt.Sprintf("%s/%s: %s, data= %d", client.hostname, lis[1], rz2.ConvertUnixtime(send_time).Format("15:04:05.000"), data), nil
+func clockStats(client *Client, num string, s *rz2.Series) (string, error) {
+	if len(s.Samples) == 0 {
+		return "", fmt.Errorf("no data")
+	}
+	// server time minus send_time: clock offset plus latency
+	delay := time.Now().UnixNano()/1000000 - s.SendTime
+	return fmt.Sprintf("%s/%s: %s, data= %d, delay= %d ms", client.hostname, num, rz2.ConvertUnixtime(s.SendTime).Format("15:04:05.000"), int32(s.Samples[0].Values[0]), delay), nil
 }
 
-func illStats(client *Client, msg mqtt.Message) (string, error) {
-	send_time, data, err := rz2.ConvertIll(msg.Payload())
-	if err != nil {
-		return "", err
+func shtStats(client *Client, num string, s *rz2.Series) (string, error) {
+	if len(s.Samples) == 0 {
+		return "", fmt.Errorf("no data")
 	}
-	ave := 0.0
-	for i :=0; i < len(data); i++ {
-		ave += float64(data[i])
+	c := rz2.NewClimate(s.Mean(0), s.Mean(1))
+	device, _ := rz2.LookupDevice(client.macaddress)
+	alerts := device.ClimateAlert().Check(c)
+	status := "[ok](fg:green)"
+	if len(alerts) > 0 {
+		status = fmt.Sprintf("[%s](fg:red)", strings.Join(alerts, ","))
 	}
-	ave /= float64(len(data))
-	return fmt.Sprintf("%s: %s, data= %d, ave= %.3f", client.hostname, rz2.ConvertUnixtime(send_time).Format("15:04:05.000"), len(data), ave), nil
+	return fmt.Sprintf("%s: %s, data= %d, Tmp.= %.1f['C], Hum.=%.1f[%%], Td= %.1f['C], AH= %.1f[g/m³], WBGT= %.1f['C] %s", client.hostname, rz2.ConvertUnixtime(s.SendTime).Format("15:04:05.000"), len(s.Samples), c.Temperature, c.Humidity, c.DewPoint, c.AbsoluteHumidity, c.WBGT, status), nil
 }
 
-func shtStats(client *Client, msg mqtt.Message) (string, error) {
-	send_time, tmp_data, hum_data, err := rz2.ConvertSht(msg.Payload())
-	if err != nil {
-		return "", err
+func illStats(client *Client, num string, s *rz2.Series) (string, error) {
+	if len(s.Samples) == 0 {
+		return "", fmt.Errorf("no data")
 	}
-	tmp_ave := 0.0
-	hum_ave := 0.0
-	for i :=0; i < len(tmp_data); i++ {
-		tmp_ave += float64(tmp_data[i])
-		hum_ave += float64(hum_data[i])
+	lux := s.Mean(s.Channel("illuminance"))
+	device, _ := rz2.LookupDevice(client.macaddress)
+	state := "dark"
+	if math.IsNaN(lux) {
+		state = "[saturated](fg:red)"
+	} else if lux > device.LightSensor().Threshold {
+		state = "[lit](fg:yellow)"
 	}
-	tmp_ave /= float64(len(tmp_data))
-	hum_ave /= float64(len(hum_data))
-	return fmt.Sprintf("%s: %s, data= %d, Tmp.= %.1f['C], Hum.=%.1f[%%]", client.hostname, rz2.ConvertUnixtime(send_time).Format("15:04:05.000"), len(tmp_data), tmp_ave, hum_ave), nil
+	return fmt.Sprintf("%s: %s, data= %d, Ill.= %.1f[lx] (ch0/ch1= %.0f/%.0f) %s", client.hostname, rz2.ConvertUnixtime(s.SendTime).Format("15:04:05.000"), len(s.Samples), lux, s.Mean(s.Channel("ch0")), s.Mean(s.Channel("ch1")), state), nil
 }
 
-func irStats(client *Client, msg mqtt.Message) (string, error) {
-	send_time, data, err := rz2.ConvertIR(msg.Payload())
-	if err != nil {
-		return "", err
+func irStats(client *Client, num string, s *rz2.Series) (string, error) {
+	if len(s.Samples) == 0 {
+		return "", fmt.Errorf("no data")
 	}
-	return fmt.Sprintf("%s: %s, data= %d", client.hostname, rz2.ConvertUnixtime(send_time).Format("15:04:05.000"), data), nil
+	return fmt.Sprintf("%s: %s, data= %d", client.hostname, rz2.ConvertUnixtime(s.SendTime).Format("15:04:05.000"), int8(s.Samples[0].Values[0])), nil
 }
 
-func gillStats(client *Client, msg mqtt.Message) (string, error) {
-	send_time, data, err := rz2.ConvertGill(msg.Payload())
-	if err != nil {
-		return "", err
+func gillStats(client *Client, num string, s *rz2.Series) (string, error) {
+	if len(s.Samples) == 0 {
+		return "", fmt.Errorf("no data")
 	}
-	return fmt.Sprintf("%s: %s, angle= %.1f[°], speed= %.1f[m/s]", client.hostname, rz2.ConvertUnixtime(send_time).Format("15:04:05.000"), data[0], data[1]), nil
+	v := s.Samples[0].Values
+	str := fmt.Sprintf("%s: %s, angle= %.1f[°], speed= %.1f[m/s]", client.hostname, rz2.ConvertUnixtime(s.SendTime).Format("15:04:05.000"), v[0], v[1])
+	if col := s.Channel("count"); col >= 0 && !math.IsNaN(v[col]) {
+		str += fmt.Sprintf(", n= %.0f", v[col])
+		if v[col] == 0 {
+			str += fmt.Sprintf(" (stale %.1f[s])", v[s.Channel("age")]/1000.0)
+		}
+		if status := int(v[s.Channel("status")]); status != 0 {
+			str += fmt.Sprintf(", %s", rz2.GillStatusText(status))
+		}
+		if errors := v[s.Channel("errors")]; errors > 0 {
+			str += fmt.Sprintf(", errors= %.0f", errors)
+		}
+	}
+	return str, nil
 }
 
 func getLatestFileSize(path string) (int64, error) {
@@ -253,6 +399,8 @@ func main() {
 	cafn := flag.String("cafile", "", "ca file")
 	crtfn := flag.String("crtfile", "", "crt file")
 	keyfn := flag.String("keyfile", "", "key file")
+	conffn := flag.String("config", "", "config file (devices)")
+	zerofn := flag.String("zero", "", "zero point file updated by zero control messages")
 	flag.Parse()
 
 	if *cafn != "" {
@@ -265,6 +413,27 @@ func main() {
 		keyfile = *keyfn
 	}
 
+	if *conffn != "" {
+		err := new(rz2.Config).ReadConfig(*conffn)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *zerofn != "" {
+		z, err := rz2.LoadZeroStore(*zerofn)
+		if err != nil {
+			log.Fatal(err)
+		}
+		zerostore = z
+		rz2.RegisterZeroStore(z)
+	}
+	for _, d := range rz2.Devices() {
+		for _, r := range d.Rosettes {
+			rosettes[d.MacAddress] = append(rosettes[d.MacAddress], rosetteRow{rz2.NewRosetteStream(r), len(rosettestatus)})
+			rosettestatus = append(rosettestatus, fmt.Sprintf("%s: %s", r.Name, d.MacAddress))
+		}
+	}
+
 	err := ReadClient(*cfn)
 	if err != nil {
 		log.Fatal(err)
@@ -277,81 +446,18 @@ func main() {
 	rightkeys := make([]string, 0)
 	clientkeys := make(map[string]*Client)
 	for _, c := range clients {
-		switch c.datatype {
-		case Strain:
-			if c.column == 0 {
-				for j := 1; j <= 4; j++ {
-					key := fmt.Sprintf("%s/%02d/str01", c.macaddress, j)
-					leftkeys = append(leftkeys, key)
-					clientkeys[key] = c
-				}
-			} else {
-				for j := 1; j <= 4; j++ {
-					key := fmt.Sprintf("%s/%02d/str01", c.macaddress, j)
-					rightkeys = append(rightkeys, key)
-					clientkeys[key] = c
-				}
-			}
-		case Acc:
-			if c.column == 0 {
-				key := fmt.Sprintf("%s/01/acc02", c.macaddress)
-				leftkeys = append(leftkeys, key)
-				clientkeys[key] = c
-			} else {
-				key := fmt.Sprintf("%s/01/acc02", c.macaddress)
-				rightkeys = append(rightkeys, key)
-				clientkeys[key] = c
-			}
-		case Clock:
-			if c.column == 0 {
-				key := fmt.Sprintf("%s/01/clk01", c.macaddress)
-				leftkeys = append(leftkeys, key)
-				clientkeys[key] = c
-			} else {
-				key := fmt.Sprintf("%s/01/clk01", c.macaddress)
-				rightkeys = append(rightkeys, key)
-				clientkeys[key] = c
-			}
-		case Ill:
-			if c.column == 0 {
-				key := fmt.Sprintf("%s/01/ill01", c.macaddress)
-				leftkeys = append(leftkeys, key)
-				clientkeys[key] = c
-			} else {
-				key := fmt.Sprintf("%s/01/ill01", c.macaddress)
-				rightkeys = append(rightkeys, key)
-				clientkeys[key] = c
-			}
-		case Ir:
-			if c.column == 0 {
-				key := fmt.Sprintf("%s/01/ir01", c.macaddress)
-				leftkeys = append(leftkeys, key)
-				clientkeys[key] = c
-			} else {
-				key := fmt.Sprintf("%s/01/ir01", c.macaddress)
-				rightkeys = append(rightkeys, key)
-				clientkeys[key] = c
-			}
-		case Gill:
-			if c.column == 0 {
-				key := fmt.Sprintf("%s/01/gill01", c.macaddress)
-				leftkeys = append(leftkeys, key)
-				clientkeys[key] = c
-			} else {
-				key := fmt.Sprintf("%s/01/gill01", c.macaddress)
-				rightkeys = append(rightkeys, key)
-				clientkeys[key] = c
-			}
-		case Sht:
+		nch := 1
+		if c.datatype == Strain {
+			nch = 4
+		}
+		for j := 1; j <= nch; j++ {
+			key := rz2.NewTopic(c.macaddress, j, c.datatype.Extension()).String()
 			if c.column == 0 {
-				key := fmt.Sprintf("%s/01/sht31", c.macaddress)
 				leftkeys = append(leftkeys, key)
-				clientkeys[key] = c
 			} else {
-				key := fmt.Sprintf("%s/01/sht31", c.macaddress)
 				rightkeys = append(rightkeys, key)
-				clientkeys[key] = c
 			}
+			clientkeys[key] = c
 		}
 	}
 
@@ -388,14 +494,15 @@ func main() {
 	}
 	sl := widgets.NewList()
 	sl.Title = "Status"
-	sl.Rows = make([]string, 4)
+	sl.Rows = make([]string, 4+len(rosettestatus))
 	sl.Rows[0] = fmt.Sprintf("SERVER: %s", srvaddress)
 	sl.Rows[1] = "STATUS: [connected](fg:green)"
 	sl.Rows[2] = "[no error](fg:green)"
 	sl.Rows[3] = "file size"
+	copy(sl.Rows[4:], rosettestatus)
 	sl.TextStyle = ui.NewStyle(ui.ColorWhite)
 	sl.WrapText = false
-	sl.SetRect(80, len(rightkeys)+3, 160, len(rightkeys)+9)
+	sl.SetRect(80, len(rightkeys)+3, 160, len(rightkeys)+9+len(rosettestatus))
 	ui.Render(sl)
 
 	id := fmt.Sprintf("valmon_go_%d", time.Now().UnixNano())
@@ -414,188 +521,36 @@ func main() {
 		srcopts.SetTLSConfig(tlsconfig)
 	}
 	srcopts.SetDefaultPublishHandler(func(client mqtt.Client, msg mqtt.Message) {
-		lis := strings.Split(msg.Topic(), "/")
+		if zerostore != nil && strings.HasSuffix(msg.Topic(), "/zero") {
+			status, err := rezero(msg.Topic(), msg.Payload())
+			if err != nil {
+				sl.Rows[2] = fmt.Sprintf("[%s:%s](fg:red)", msg.Topic(), err)
+			} else {
+				sl.Rows[2] = fmt.Sprintf("[%s](fg:green)", status)
+			}
+			ui.Render(sl)
+			return
+		}
 		cl := clientkeys[msg.Topic()]
 		if cl == nil {
 			return
 		}
-		switch lis[2] {
-		case "acc02":
-			status, err := accStats(cl, msg)
-			if err != nil {
-				sl.Rows[2] = fmt.Sprintf("[%s:%s](fg:red)", cl.hostname, err)
-				ui.Render(sl)
-				return
-			}
-			switch cl.column {
-			case 0:
-				for i, k := range leftkeys {
-					if k == msg.Topic() {
-						ll.Rows[i] = status
-						ui.Render(ll)
-						break
-					}
-				}
-			case 1:
-				for i, k := range rightkeys {
-					if k == msg.Topic() {
-						rl.Rows[i] = status
-						ui.Render(rl)
-						break
-					}
-				}
-			}
-		case "str01":
-			status, err := strainStats(cl, msg)
-			if err != nil {
-				sl.Rows[2] = fmt.Sprintf("[%s/%d:%s](fg:red)", cl.hostname, lis[1], err)
-				ui.Render(sl)
-				return
-			}
-			switch cl.column {
-			case 0:
-				for i, k := range leftkeys {
-					if k == msg.Topic() {
-						ll.Rows[i] = status
-						ui.Render(ll)
-						break
-					}
-				}
-			case 1:
-				for i, k := range rightkeys {
-					if k == msg.Topic() {
-						rl.Rows[i] = status
-						ui.Render(rl)
-						break
-					}
-				}
-			}
-		case "clk01":
-			status, err := clockStats(cl, msg)
-			if err != nil {
-				sl.Rows[2] = fmt.Sprintf("[%s/%d:%s](fg:red)", cl.hostname, lis[1], err)
-				ui.Render(sl)
-				return
-			}
-			switch cl.column {
-			case 0:
-				for i, k := range leftkeys {
-					if k == msg.Topic() {
-						ll.Rows[i] = status
-						ui.Render(ll)
-						break
-					}
-				}
-			case 1:
-				for i, k := range rightkeys {
-					if k == msg.Topic() {
-						rl.Rows[i] = status
-						ui.Render(rl)
-						break
-					}
-				}
-			}
-		case "ill01":
-			status, err := illStats(cl, msg)
-			if err != nil {
-				sl.Rows[2] = fmt.Sprintf("[%s:%s](fg:red)", cl.hostname, err)
-				ui.Render(sl)
-				return
-			}
-			switch cl.column {
-			case 0:
-				for i, k := range leftkeys {
-					if k == msg.Topic() {
-						ll.Rows[i] = status
-						ui.Render(ll)
-						break
-					}
-				}
-			case 1:
-				for i, k := range rightkeys {
-					if k == msg.Topic() {
-						rl.Rows[i] = status
-						ui.Render(rl)
-						break
-					}
-				}
-			}
-		case "ir01":
-			status, err := irStats(cl, msg)
-			if err != nil {
-				sl.Rows[2] = fmt.Sprintf("[%s:%s](fg:red)", cl.hostname, err)
-				ui.Render(sl)
-				return
-			}
-			switch cl.column {
-			case 0:
-				for i, k := range leftkeys {
-					if k == msg.Topic() {
-						ll.Rows[i] = status
-						ui.Render(ll)
-						break
-					}
-				}
-			case 1:
-				for i, k := range rightkeys {
-					if k == msg.Topic() {
-						rl.Rows[i] = status
-						ui.Render(rl)
-						break
-					}
-				}
-			}
-		case "gill01":
-			status, err := gillStats(cl, msg)
-			if err != nil {
-				sl.Rows[2] = fmt.Sprintf("[%s:%s](fg:red)", cl.hostname, err)
-				ui.Render(sl)
-				return
-			}
-			switch cl.column {
-			case 0:
-				for i, k := range leftkeys {
-					if k == msg.Topic() {
-						ll.Rows[i] = status
-						ui.Render(ll)
-						break
-					}
-				}
-			case 1:
-				for i, k := range rightkeys {
-					if k == msg.Topic() {
-						rl.Rows[i] = status
-						ui.Render(rl)
-						break
-					}
-				}
-			}
-		case "sht31":
-			status, err := shtStats(cl, msg)
-			if err != nil {
-				sl.Rows[2] = fmt.Sprintf("[%s:%s](fg:red)", cl.hostname, err)
-				ui.Render(sl)
-				return
-			}
-			switch cl.column {
-			case 0:
-				for i, k := range leftkeys {
-					if k == msg.Topic() {
-						ll.Rows[i] = status
-						ui.Render(ll)
-						break
-					}
-				}
-			case 1:
-				for i, k := range rightkeys {
-					if k == msg.Topic() {
-						rl.Rows[i] = status
-						ui.Render(rl)
-						break
-					}
-				}
+		status, err := stats(cl, msg)
+		if err != nil {
+			sl.Rows[2] = fmt.Sprintf("[%s:%s:%s](fg:red)", cl.hostname, msg.Topic(), err)
+			ui.Render(sl)
+			return
+		}
+		keys, list := leftkeys, ll
+		if cl.column == 1 {
+			keys, list = rightkeys, rl
+		}
+		for i, k := range keys {
+			if k == msg.Topic() {
+				list.Rows[i] = status
+				ui.Render(list)
+				break
 			}
-		default:
 		}
 	})
 
@@ -615,6 +570,9 @@ func main() {
 		for {
 			select {
 			case <-ticker.C:
+				rosettelock.Lock()
+				copy(sl.Rows[4:], rosettestatus)
+				rosettelock.Unlock()
 				if srcclient.IsConnected() {
 					sl.Rows[1] = fmt.Sprintf("STATUS: [connected](fg:green): %s", time.Now().Format("15:04:05.000"))
 					sl.Rows[2] = "[no error](fg:green)"
@@ -3,6 +3,8 @@ package rz2
 import (
 	"fmt"
 	"io/ioutil"
+	"sort"
+	"strings"
 
 	toml "github.com/pelletier/go-toml/v2"
 )
@@ -14,22 +16,152 @@ type Config struct {
 	Keyfile string `toml:"keyfile"`
 	Homedir string `toml:"homedir"`
 	Backupdir string `toml:"backupdir"`
+	Archivedir string `toml:"archivedir"`
 	Removehour int `toml:"removehour"`
 	List []string `toml:"list"`
+	Include []string `toml:"include"`
+	Exclude []string `toml:"exclude"`
+	Policy map[string]Policy `toml:"policy"`
+	Brokers []Broker `toml:"broker"`
+	Layout string `toml:"layout"`
+	Devices []Device `toml:"device"`
+	SNCurves []SNCurve `toml:"sncurve"`
+	Instruments []Instrument `toml:"instrument"`
+}
+
+// Broker represents a mosquitto server and the site it serves
+type Broker struct {
+	Site string `toml:"site"`
+	Server string `toml:"server"`
+	Cafile string `toml:"cafile"`
+	Crtfile string `toml:"crtfile"`
+	Keyfile string `toml:"keyfile"`
+}
+
+// BrokerList returns configured brokers, or the single default server when no broker is configured
+// Sites of more than one broker must be unique and not empty, since records are separated by site
+func (c *Config) BrokerList() ([]Broker, error) {
+	if len(c.Brokers) == 0 {
+		return []Broker{
+			Broker{
+				Site: "",
+				Server: c.Server,
+				Cafile: c.Cafile,
+				Crtfile: c.Crtfile,
+				Keyfile: c.Keyfile,
+			},
+		}, nil
+	}
+	sites := make(map[string]bool)
+	rtn := make([]Broker, len(c.Brokers))
+	for i, b := range c.Brokers {
+		err := ValidateSite(b.Site)
+		if err != nil {
+			return nil, fmt.Errorf("broker %s: %s", b.Server, err)
+		}
+		if len(c.Brokers) > 1 {
+			if b.Site == "" {
+				return nil, fmt.Errorf("broker %s: no site", b.Server)
+			}
+			if sites[b.Site] {
+				return nil, fmt.Errorf("broker %s: duplicated site: %s", b.Server, b.Site)
+			}
+			sites[b.Site] = true
+		}
+		if b.Cafile == "" {
+			b.Cafile = c.Cafile
+		}
+		if b.Crtfile == "" {
+			b.Crtfile = c.Crtfile
+		}
+		if b.Keyfile == "" {
+			b.Keyfile = c.Keyfile
+		}
+		rtn[i] = b
+	}
+	return rtn, nil
 }
 
 func (c *Config) Println() {
 	fmt.Printf("server: %s\n", c.Server)
+	for i, b := range c.Brokers {
+		fmt.Printf("broker %d: %s (site: %s)\n", i, b.Server, b.Site)
+	}
 	fmt.Printf("cafile: %s\n", c.Cafile)
 	fmt.Printf("crtfile: %s\n", c.Crtfile)
 	fmt.Printf("keyfile: %s\n", c.Keyfile)
 	fmt.Printf("homedir: %s\n", c.Homedir)
 	fmt.Printf("backupdir: %s\n", c.Backupdir)
+	fmt.Printf("archivedir: %s\n", c.Archivedir)
 	fmt.Printf("removehour: %d\n", c.Removehour)
+	if c.Layout != "" {
+		fmt.Printf("layout: %s\n", c.Layout)
+	}
 	fmt.Print("list:\n")
 	for i, t := range c.List {
 		fmt.Printf("    %d: %s\n", i, t)
 	}
+	if len(c.Include) > 0 {
+		fmt.Printf("include: %s\n", strings.Join(c.Include, ", "))
+	}
+	if len(c.Exclude) > 0 {
+		fmt.Printf("exclude: %s\n", strings.Join(c.Exclude, ", "))
+	}
+	if len(c.Devices) > 0 {
+		fmt.Print("device:\n")
+		for _, d := range c.Devices {
+			fmt.Printf("    %s: %s %s\n", d.MacAddress, d.Name, d.AccRange)
+			if d.Calibration != nil {
+				fmt.Printf("        offset: %v, gain: %v, rotation: %v\n", d.Calibration.Offset, d.Calibration.Gain, d.Calibration.Rotation)
+			}
+			for _, g := range d.Strain {
+				fmt.Printf("        strain %02d: gauge factor: %g, gain: %g, bridge: %s, polarity: %d, offset: %g\n", g.Channel, g.GaugeFactor, g.Gain, g.Bridge, g.Polarity, g.Offset)
+				if g.Reference != "" {
+					fmt.Printf("            thermal: %g, reference: %s\n", g.Thermal, g.Reference)
+				}
+				if g.SNCurve != "" {
+					fmt.Printf("            young: %g, sncurve: %s\n", g.Young, g.SNCurve)
+				}
+			}
+			if d.Light != nil {
+				fmt.Printf("        light: gain: %g, integration: %g, glass: %g, threshold: %g\n", d.Light.Gain, d.Light.Integration, d.Light.Glass, d.Light.Threshold)
+			}
+			if d.Climate != nil {
+				a := d.Climate
+				fmt.Printf("        climate: profile: %s, temperature: %g-%g, humidity: %g-%g, dewpoint: %g-%g, surface: %g, margin: %g, mould: %g, wbgt: %g, heatindex: %g\n", a.Profile, a.MinTemperature, a.MaxTemperature, a.MinHumidity, a.MaxHumidity, a.MinDewPoint, a.MaxDewPoint, a.Surface, a.Margin, a.Mould, a.MaxWBGT, a.MaxHeatIndex)
+			}
+			for _, r := range d.Rosettes {
+				fmt.Printf("        rosette %s: type: %s, channels: %v, young: %g, poisson: %g\n", r.Name, r.Type, r.Channels, r.Young, r.Poisson)
+			}
+		}
+	}
+	if len(c.SNCurves) > 0 {
+		fmt.Print("sncurve:\n")
+		for _, sn := range c.SNCurves {
+			fmt.Printf("    %s: reference: %g, cycles: %g, m: %g, limit: %g, m2: %g, cutoff: %g\n", sn.Name, sn.Reference, sn.Cycles, sn.M, sn.Limit, sn.M2, sn.Cutoff)
+		}
+	}
+	if len(c.Instruments) > 0 {
+		fmt.Print("instrument:\n")
+		for _, in := range c.Instruments {
+			port := in.Port
+			if port == "" {
+				port = fmt.Sprintf("vid %s pid %s", in.VID, in.PID)
+			}
+			fmt.Printf("    %s: %s (%d baud, %s), parser: %s, topic: %02d/%s, interval: %d, stale: %d\n", in.Name, port, in.Baud, in.Framing, in.Parser, in.Channel, in.Extension, in.Interval, in.Stale)
+		}
+	}
+	if len(c.Policy) > 0 {
+		fmt.Print("policy:\n")
+		exts := make([]string, 0, len(c.Policy))
+		for ext := range c.Policy {
+			exts = append(exts, ext)
+		}
+		sort.Strings(exts)
+		for _, ext := range exts {
+			fmt.Printf("    %s: %s\n", ext, c.Policy[ext])
+		}
+	}
 	fmt.Println("")
 }
 
@@ -38,7 +170,44 @@ func (c *Config) ReadConfig(fn string) error {
 	if err != nil {
 		return err
 	}
-	toml.Unmarshal(b, &c)
+	err = toml.Unmarshal(b, &c)
+	if err != nil {
+		return fmt.Errorf("%s: %s", fn, err)
+	}
 	fmt.Println(c.List)
+	for _, sn := range c.SNCurves {
+		err := RegisterSNCurve(sn)
+		if err != nil {
+			return err
+		}
+	}
+	for ext, p := range c.Policy {
+		p.normalize()
+		err := p.Validate()
+		if err != nil {
+			return fmt.Errorf("policy %s: %s", ext, err)
+		}
+		c.Policy[ext] = p
+	}
+	topics := make(map[string]string)
+	for i := range c.Instruments {
+		in := &c.Instruments[i]
+		in.normalize()
+		err := in.Validate()
+		if err != nil {
+			return err
+		}
+		t := fmt.Sprintf("%02d/%s", in.Channel, in.Extension)
+		if name, ok := topics[t]; ok {
+			return fmt.Errorf("instrument %s: same topic as %s: %s", in.Name, name, t)
+		}
+		topics[t] = in.Name
+	}
+	for _, d := range c.Devices {
+		err := RegisterDevice(d)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
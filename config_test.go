@@ -0,0 +1,61 @@
+package rz2
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// settings of float64 written as integers
+const testConfigIntegers = `
+[[device]]
+macaddress = "b8:27:eb:00:00:01"
+[device.calibration]
+offset = [1, 0, -2]
+gain = [1, 1, 1]
+rotation = [[1, 0, 0], [0, 1, 0], [0, 0, 1]]
+[device.light]
+gain = 8
+integration = 101
+[device.climate]
+maxtemperature = 27
+[[device.rosette]]
+name = "r1"
+type = "rectangular"
+channels = [1, 2, 3]
+young = 205
+poisson = 0.3
+
+[[sncurve]]
+name = "test"
+reference = 80
+`
+
+func TestReadConfigIntegers(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "rz2.toml")
+	err := ioutil.WriteFile(fn, []byte(testConfigIntegers), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{}
+	err = c.ReadConfig(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := c.Devices[0]
+	if d.Calibration.Offset != [3]float64{1, 0, -2} || d.Calibration.Rotation[2][2] != 1 {
+		t.Errorf("calibration: %v", d.Calibration)
+	}
+	if d.Light.Gain != 8 || d.Light.Integration != 101 {
+		t.Errorf("light: %v", d.Light)
+	}
+	if d.Climate.MaxTemperature != 27 {
+		t.Errorf("climate: %v", d.Climate)
+	}
+	if d.Rosettes[0].Young != 205 {
+		t.Errorf("rosette: %v", d.Rosettes[0])
+	}
+	if c.SNCurves[0].Reference != 80 {
+		t.Errorf("sncurve: %v", c.SNCurves[0])
+	}
+}
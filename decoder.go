@@ -0,0 +1,449 @@
+package rz2
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Channel is a quantity carried by a message
+type Channel struct {
+	Name string
+	Unit string
+}
+
+// Sample is a set of channel values at a time
+type Sample struct {
+	Time   int64     // unix time [ms]
+	Values []float64 // one value per channel
+}
+
+// Series is a decoded message
+type Series struct {
+	Extension   string
+	SendTime    int64 // unix time [ms] when the message was sent (0 if unknown)
+	Channels    []Channel
+	Samples     []Sample
+	Timestamped bool                   // sample times are given by the device; otherwise they are nominal
+	Info        map[string]interface{} // contents of info messages
+}
+
+// Column returns values of the i-th channel
+func (s *Series) Column(i int) []float64 {
+	rtn := make([]float64, len(s.Samples))
+	for j, smp := range s.Samples {
+		if i < len(smp.Values) {
+			rtn[j] = smp.Values[i]
+		}
+	}
+	return rtn
+}
+
+// Times returns time of samples
+func (s *Series) Times() []int64 {
+	rtn := make([]int64, len(s.Samples))
+	for j, smp := range s.Samples {
+		rtn[j] = smp.Time
+	}
+	return rtn
+}
+
+// Mean returns average of the i-th channel
+func (s *Series) Mean(i int) float64 {
+	if len(s.Samples) == 0 {
+		return 0.0
+	}
+	sum := 0.0
+	for _, v := range s.Column(i) {
+		sum += v
+	}
+	return sum / float64(len(s.Samples))
+}
+
+// Channel returns the index of the channel with the name (-1 if not found)
+func (s *Series) Channel(name string) int {
+	for i, c := range s.Channels {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Decoder converts payloads of a topic extension to Series
+type Decoder interface {
+	Channels() []Channel
+	Decode(payload []byte) (*Series, error)
+}
+
+type decoder struct {
+	channels []Channel
+	decode   func([]byte) (*Series, error)
+}
+
+func (d *decoder) Channels() []Channel {
+	return d.channels
+}
+
+func (d *decoder) Decode(payload []byte) (*Series, error) {
+	return d.decode(payload)
+}
+
+// DeviceDecoder is a Decoder whose conversion depends on settings of the device sending the message
+type DeviceDecoder interface {
+	Decoder
+	DecodeDevice(device Device, channel int, payload []byte) (*Series, error)
+}
+
+type deviceDecoder struct {
+	channels []Channel
+	decode   func(Device, int, []byte) (*Series, error)
+}
+
+func (d *deviceDecoder) Channels() []Channel {
+	return d.channels
+}
+
+// Decode decodes payload with default settings
+func (d *deviceDecoder) Decode(payload []byte) (*Series, error) {
+	return d.decode(Device{}, 0, payload)
+}
+
+func (d *deviceDecoder) DecodeDevice(device Device, channel int, payload []byte) (*Series, error) {
+	return d.decode(device, channel, payload)
+}
+
+// NewDeviceDecoder returns a DeviceDecoder of channels which decodes payloads with fn
+// channel is the channel number of the topic
+func NewDeviceDecoder(channels []Channel, fn func(device Device, channel int, payload []byte) (*Series, error)) DeviceDecoder {
+	return &deviceDecoder{
+		channels: channels,
+		decode:   fn,
+	}
+}
+
+// NewDecoder returns a Decoder of channels which decodes payloads with fn
+func NewDecoder(channels []Channel, fn func(payload []byte) (*Series, error)) Decoder {
+	return &decoder{
+		channels: channels,
+		decode:   fn,
+	}
+}
+
+var (
+	decoders     = make(map[string]Decoder)
+	decoderslock sync.RWMutex
+)
+
+// RegisterDecoder registers d for topic extension ext
+// A decoder already registered for ext is replaced
+func RegisterDecoder(ext string, d Decoder) {
+	decoderslock.Lock()
+	defer decoderslock.Unlock()
+	decoders[ext] = d
+}
+
+// LookupDecoder returns the decoder registered for ext
+func LookupDecoder(ext string) (Decoder, bool) {
+	decoderslock.RLock()
+	defer decoderslock.RUnlock()
+	d, ok := decoders[ext]
+	return d, ok
+}
+
+// Extensions returns registered topic extensions
+func Extensions() []string {
+	decoderslock.RLock()
+	defer decoderslock.RUnlock()
+	rtn := make([]string, 0, len(decoders))
+	for ext := range decoders {
+		rtn = append(rtn, ext)
+	}
+	sort.Strings(rtn)
+	return rtn
+}
+
+// Decode decodes payload with the decoder of the extension of topic (macaddress/num/ext)
+// Settings of the device registered by RegisterDevice are used for a DeviceDecoder
+func Decode(topic string, payload []byte) (*Series, error) {
+	ext := topic[strings.LastIndex(topic, "/")+1:]
+	d, ok := LookupDecoder(ext)
+	if !ok {
+		return nil, fmt.Errorf("unknown extension: %s", ext)
+	}
+	var s *Series
+	var err error
+	if dd, ok := d.(DeviceDecoder); ok {
+		mac, channel := macAddressOf(topic)
+		device, _ := LookupDevice(mac)
+		s, err = dd.DecodeDevice(device, channel, payload)
+	} else {
+		s, err = d.Decode(payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Extension = ext
+	if s.Channels == nil {
+		s.Channels = d.Channels()
+	}
+	return s, nil
+}
+
+// sameTime returns samples of values sent at send_time
+func sameTime(send_time int64, values ...[]float64) []Sample {
+	if len(values) == 0 {
+		return nil
+	}
+	rtn := make([]Sample, len(values[0]))
+	for i := range rtn {
+		v := make([]float64, len(values))
+		for j := range values {
+			v[j] = values[j][i]
+		}
+		rtn[i] = Sample{Time: send_time, Values: v}
+	}
+	return rtn
+}
+
+var (
+	accChannels = []Channel{
+		{"x", "gal"},
+		{"y", "gal"},
+		{"z", "gal"},
+	}
+	amgChannels = func() []Channel {
+		rtn := make([]Channel, 65)
+		rtn[0] = Channel{"thermistor", "'C"}
+		for i := 1; i < 65; i++ {
+			rtn[i] = Channel{fmt.Sprintf("pixel%02d", i-1), "'C"}
+		}
+		return rtn
+	}()
+)
+
+// accSamples returns samples of complete x/y/z triplets
+// the last sample is at send_time and the others are spaced at the nominal rate
+func accSamples(send_time int64, acc []float64, xind int) []Sample {
+	if xind > len(acc) {
+		return nil
+	}
+	size := (len(acc) - xind) / 3
+	rtn := make([]Sample, size)
+	for i := 0; i < size; i++ {
+		rtn[i] = Sample{
+			Time:   send_time - int64(float64(size-1-i)*1000.0/accRate),
+			Values: []float64{acc[xind+3*i], acc[xind+3*i+1], acc[xind+3*i+2]},
+		}
+	}
+	return rtn
+}
+
+func decodeAcc02(device Device, channel int, b []byte) (*Series, error) {
+	send_time, acc, xind, err := ConvertAccPacketWithTimeInto(nil, b, device.AccRange)
+	if err != nil {
+		return nil, err
+	}
+	device.Calibration.ApplyPacket(acc, xind)
+	return &Series{
+		SendTime: send_time,
+		Samples:  accSamples(send_time, acc, xind),
+	}, nil
+}
+
+func decodeAcc01(device Device, channel int, b []byte) (*Series, error) {
+	acc := ConvertAccWithRange(b, device.AccRange)
+	device.Calibration.ApplyPacket(acc, 0)
+	return &Series{
+		Samples: accSamples(0, acc, 0),
+	}, nil
+}
+
+func decodeStr01(device Device, channel int, b []byte) (*Series, error) {
+	mtime, raw, err := ConvertStrain(b, strainFactor, false)
+	if err != nil {
+		return nil, err
+	}
+	g := device.StrainGauge(channel)
+	strain := make([]float64, len(raw))
+	var z ZeroPoint
+	zeroed := false
+	if len(mtime) > 0 {
+		z, zeroed = lookupZero(device.MacAddress, channel, mtime[0])
+	}
+	for i, v := range raw {
+		if zeroed {
+			strain[i] = g.ConvertZero(v, z)
+		} else {
+			strain[i] = g.Convert(v)
+		}
+	}
+	send_time, _, _ := readHeader("str01", b)
+	samples := make([]Sample, len(strain))
+	for i := range strain {
+		samples[i] = Sample{Time: mtime[i], Values: []float64{strain[i], raw[i]}}
+	}
+	return &Series{
+		SendTime:    send_time,
+		Samples:     samples,
+		Timestamped: true,
+	}, nil
+}
+
+func decodeSht31(b []byte) (*Series, error) {
+	send_time, tmp, hum, err := ConvertSht(b)
+	if err != nil {
+		return nil, err
+	}
+	dew := make([]float64, len(tmp))
+	abs := make([]float64, len(tmp))
+	hi := make([]float64, len(tmp))
+	wbgt := make([]float64, len(tmp))
+	for i := range tmp {
+		c := NewClimate(tmp[i], hum[i])
+		dew[i], abs[i], hi[i], wbgt[i] = c.DewPoint, c.AbsoluteHumidity, c.HeatIndex, c.WBGT
+	}
+	return &Series{
+		SendTime: send_time,
+		Samples:  sameTime(send_time, tmp, hum, dew, abs, hi, wbgt),
+	}, nil
+}
+
+func decodeIll01(device Device, channel int, b []byte) (*Series, error) {
+	send_time, ch0, ch1, lux, err := ConvertLux(b, device.LightSensor())
+	if err != nil {
+		return nil, err
+	}
+	return &Series{
+		SendTime: send_time,
+		Samples:  sameTime(send_time, lux, ch0, ch1),
+	}, nil
+}
+
+func decodeIr01(b []byte) (*Series, error) {
+	send_time, data, err := ConvertIR(b)
+	if err != nil {
+		return nil, err
+	}
+	return &Series{
+		SendTime: send_time,
+		Samples:  sameTime(send_time, []float64{float64(data)}),
+	}, nil
+}
+
+func decodeGill01(b []byte) (*Series, error) {
+	send_time, data, err := ConvertGill(b)
+	if err != nil {
+		return nil, err
+	}
+	// payloads without health
+	for len(data) < 6 {
+		data = append(data, math.NaN())
+	}
+	return &Series{
+		SendTime: send_time,
+		Samples:  []Sample{{Time: send_time, Values: data}},
+	}, nil
+}
+
+func decodeGps01(b []byte) (*Series, error) {
+	send_time, data, err := ConvertValues("gps01", b)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) != len(gpsChannels) {
+		return nil, &DataSizeError{Name: "gps01", Size: len(data)}
+	}
+	return &Series{
+		SendTime: send_time,
+		Samples:  []Sample{{Time: send_time, Values: data}},
+	}, nil
+}
+
+// decodeCsv01 names channels count, value00, value01, ... by the number of values
+func decodeCsv01(b []byte) (*Series, error) {
+	send_time, data, err := ConvertValues("csv01", b)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, &DataSizeError{Name: "csv01", Size: 0}
+	}
+	channels := make([]Channel, len(data))
+	channels[0] = Channel{"count", ""}
+	for i := 1; i < len(data); i++ {
+		channels[i] = Channel{fmt.Sprintf("value%02d", i-1), ""}
+	}
+	return &Series{
+		SendTime: send_time,
+		Channels: channels,
+		Samples:  []Sample{{Time: send_time, Values: data}},
+	}, nil
+}
+
+func decodeClk01(b []byte) (*Series, error) {
+	send_time, data, err := readHeader("clk01", b)
+	if err != nil {
+		return nil, err
+	}
+	return &Series{
+		SendTime: send_time,
+		Samples:  sameTime(send_time, []float64{float64(data)}),
+	}, nil
+}
+
+// decodeAmg88 decodes register values (130 bytes) or float32 values encoded by EncodeAmg
+func decodeAmg88(b []byte) (*Series, error) {
+	if len(b) == 130 {
+		data, err := ConvertAmg(b)
+		if err != nil {
+			return nil, err
+		}
+		return &Series{
+			Samples: []Sample{{Values: data}},
+		}, nil
+	}
+	val, err := DecodeAmg(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(val) != 65 {
+		return nil, &DataSizeError{Name: "amg88", Size: len(b)}
+	}
+	data := make([]float64, len(val))
+	for i, v := range val {
+		data[i] = float64(v)
+	}
+	return &Series{
+		Samples: []Sample{{Values: data}},
+	}, nil
+}
+
+func decodeInfo(b []byte) (*Series, error) {
+	info := make(map[string]interface{})
+	err := json.Unmarshal(b, &info)
+	if err != nil {
+		return nil, err
+	}
+	return &Series{
+		Info: info,
+	}, nil
+}
+
+func init() {
+	RegisterDecoder("acc02", NewDeviceDecoder(accChannels, decodeAcc02))
+	RegisterDecoder("acc01", NewDeviceDecoder(accChannels, decodeAcc01))
+	RegisterDecoder("str01", NewDeviceDecoder([]Channel{{"strain", "με"}, {"raw", ""}}, decodeStr01))
+	RegisterDecoder("sht31", NewDecoder([]Channel{{"temperature", "'C"}, {"humidity", "%"}, {"dewpoint", "'C"}, {"absolute", "g/m³"}, {"heatindex", "'C"}, {"wbgt", "'C"}}, decodeSht31))
+	RegisterDecoder("ill01", NewDeviceDecoder([]Channel{{"illuminance", "lx"}, {"ch0", ""}, {"ch1", ""}}, decodeIll01))
+	RegisterDecoder("ir01", NewDecoder([]Channel{{"ir", ""}}, decodeIr01))
+	RegisterDecoder("gill01", NewDecoder([]Channel{{"direction", "°"}, {"speed", "m/s"}, {"count", ""}, {"status", ""}, {"errors", ""}, {"age", "ms"}}, decodeGill01))
+	RegisterDecoder("gps01", NewDecoder(gpsChannels, decodeGps01))
+	RegisterDecoder("csv01", NewDecoder([]Channel{{"count", ""}}, decodeCsv01))
+	RegisterDecoder("clk01", NewDecoder([]Channel{{"clock", ""}}, decodeClk01))
+	RegisterDecoder("amg88", NewDecoder(amgChannels, decodeAmg88))
+	RegisterDecoder("info", NewDecoder(nil, decodeInfo))
+}
@@ -0,0 +1,232 @@
+package rz2
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Device represents settings of a sensor unit given as [[device]] in the config
+type Device struct {
+	MacAddress string   `toml:"macaddress"`
+	Name       string   `toml:"name"`
+	AccRange   AccRange `toml:"range"`
+	// calibration of acc sensor (nil if not calibrated)
+	Calibration *Calibration `toml:"calibration"`
+	// strain gauges of str01 channels
+	Strain []StrainGauge `toml:"strain"`
+	// strain rosettes made of str01 channels
+	Rosettes []Rosette `toml:"rosette"`
+	// TSL2572 of ill01 (nil for default)
+	Light *LightSensor `toml:"light"`
+	// alert thresholds of sht31 (nil for default)
+	Climate *ClimateAlert `toml:"climate"`
+}
+
+// Validate checks the mac address and the settings
+func (d Device) Validate() error {
+	err := ValidateMacAddress(d.MacAddress)
+	if err != nil {
+		return err
+	}
+	if !d.AccRange.Valid() {
+		return fmt.Errorf("%s: invalid range: %d", d.MacAddress, int(d.AccRange))
+	}
+	if d.Calibration != nil {
+		c := *d.Calibration
+		c.normalize()
+		err := c.Validate()
+		if err != nil {
+			return fmt.Errorf("%s: %s", d.MacAddress, err)
+		}
+	}
+	channels := make(map[int]bool)
+	for _, g := range d.Strain {
+		g.normalize()
+		err := g.Validate()
+		if err != nil {
+			return fmt.Errorf("%s: %s", d.MacAddress, err)
+		}
+		if channels[g.Channel] {
+			return fmt.Errorf("%s: duplicated strain channel: %02d", d.MacAddress, g.Channel)
+		}
+		channels[g.Channel] = true
+	}
+	if d.Light != nil {
+		l := *d.Light
+		l.normalize()
+		err := l.Validate()
+		if err != nil {
+			return fmt.Errorf("%s: %s", d.MacAddress, err)
+		}
+	}
+	if d.Climate != nil {
+		a := *d.Climate
+		a.normalize()
+		err := a.Validate()
+		if err != nil {
+			return fmt.Errorf("%s: %s", d.MacAddress, err)
+		}
+	}
+	names := make(map[string]bool)
+	for _, r := range d.Rosettes {
+		r.normalize()
+		err := r.Validate()
+		if err != nil {
+			return fmt.Errorf("%s: %s", d.MacAddress, err)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("%s: duplicated rosette: %s", d.MacAddress, r.Name)
+		}
+		names[r.Name] = true
+	}
+	return nil
+}
+
+// StrainGauge returns the setting of str01 channel
+func (d Device) StrainGauge(channel int) StrainGauge {
+	for _, g := range d.Strain {
+		if g.Channel == channel {
+			return g
+		}
+	}
+	return DefaultStrainGauge(channel)
+}
+
+// LightSensor returns the setting of TSL2572
+func (d Device) LightSensor() LightSensor {
+	if d.Light == nil {
+		return DefaultLightSensor()
+	}
+	return *d.Light
+}
+
+// ClimateAlert returns the alert thresholds of sht31
+func (d Device) ClimateAlert() ClimateAlert {
+	if d.Climate == nil {
+		return DefaultClimateAlert()
+	}
+	return *d.Climate
+}
+
+var (
+	devices     = make(map[string]Device)
+	deviceslock sync.RWMutex
+)
+
+// RegisterDevice registers settings of d
+// Settings already registered for the mac address are replaced
+func RegisterDevice(d Device) error {
+	err := d.Validate()
+	if err != nil {
+		return err
+	}
+	if d.Calibration != nil {
+		c := *d.Calibration
+		c.normalize()
+		d.Calibration = &c
+	}
+	if len(d.Strain) > 0 {
+		strain := make([]StrainGauge, len(d.Strain))
+		for i, g := range d.Strain {
+			g.normalize()
+			strain[i] = g
+		}
+		d.Strain = strain
+	}
+	if d.Light != nil {
+		l := *d.Light
+		l.normalize()
+		d.Light = &l
+	}
+	if d.Climate != nil {
+		a := *d.Climate
+		a.normalize()
+		d.Climate = &a
+	}
+	if len(d.Rosettes) > 0 {
+		rosettes := make([]Rosette, len(d.Rosettes))
+		for i, r := range d.Rosettes {
+			r.normalize()
+			rosettes[i] = r
+		}
+		d.Rosettes = rosettes
+	}
+	deviceslock.Lock()
+	defer deviceslock.Unlock()
+	devices[d.MacAddress] = d
+	return nil
+}
+
+// LookupDevice returns settings of the device with mac
+// A device which is not registered has default settings
+func LookupDevice(mac string) (Device, bool) {
+	deviceslock.RLock()
+	defer deviceslock.RUnlock()
+	d, ok := devices[mac]
+	if !ok {
+		return Device{MacAddress: mac}, false
+	}
+	return d, true
+}
+
+// Devices returns registered devices sorted by mac address
+func Devices() []Device {
+	deviceslock.RLock()
+	defer deviceslock.RUnlock()
+	rtn := make([]Device, 0, len(devices))
+	for _, d := range devices {
+		rtn = append(rtn, d)
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].MacAddress < rtn[j].MacAddress
+	})
+	return rtn
+}
+
+// RegisterDeviceInfo updates settings of the device with settings announced in its info message
+// The range is given as "range": 8 or "range": "8g"
+// It reports whether the settings are changed
+func RegisterDeviceInfo(mac string, info map[string]interface{}) (bool, error) {
+	v, ok := info["range"]
+	if !ok {
+		return false, nil
+	}
+	var r AccRange
+	switch val := v.(type) {
+	case float64:
+		r = AccRange(val)
+		if float64(r) != val || !r.Valid() {
+			return false, fmt.Errorf("%s: invalid range: %v", mac, val)
+		}
+	case string:
+		var err error
+		r, err = ParseAccRange(val)
+		if err != nil {
+			return false, fmt.Errorf("%s: %s", mac, err)
+		}
+	default:
+		return false, fmt.Errorf("%s: invalid range: %v", mac, val)
+	}
+	d, _ := LookupDevice(mac)
+	if d.AccRange == r {
+		return false, nil
+	}
+	d.AccRange = r
+	return true, RegisterDevice(d)
+}
+
+// macAddressOf returns the mac address and the channel of topic
+// The channel is 0 when it is not given
+func macAddressOf(topic string) (string, int) {
+	lis := strings.Split(topic, "/")
+	if len(lis) < 2 {
+		return lis[0], 0
+	}
+	ch, err := ParseChannel(lis[1])
+	if err != nil {
+		return lis[0], 0
+	}
+	return lis[0], ch
+}
@@ -0,0 +1,47 @@
+package rz2
+
+import (
+	"fmt"
+)
+
+// ShortDataError is returned when a payload is shorter than it should be
+type ShortDataError struct {
+	Name   string // name of the decoder
+	Length int    // length of the payload
+	Need   int    // required length
+}
+
+func (e *ShortDataError) Error() string {
+	return fmt.Sprintf("%s: not enough data: %d < %d", e.Name, e.Length, e.Need)
+}
+
+// DataSizeError is returned when a size field of a payload is invalid
+type DataSizeError struct {
+	Name string // name of the decoder
+	Size int    // value of the size field
+}
+
+func (e *DataSizeError) Error() string {
+	return fmt.Sprintf("%s: data size error: %d", e.Name, e.Size)
+}
+
+// checkLength returns ShortDataError if b is shorter than need
+func checkLength(name string, b []byte, need int) error {
+	if len(b) < need {
+		return &ShortDataError{Name: name, Length: len(b), Need: need}
+	}
+	return nil
+}
+
+// checkCount checks that b holds count items of width bytes after offset
+// It is done in int64 not to overflow with a broken count on 32-bit platforms
+func checkCount(name string, b []byte, offset int, count int32, width int) error {
+	if count < 0 {
+		return &DataSizeError{Name: name, Size: int(count)}
+	}
+	need := int64(offset) + int64(count)*int64(width)
+	if int64(len(b)) < need {
+		return &ShortDataError{Name: name, Length: len(b), Need: int(need)}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package rz2
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SNCurve is an S-N curve of stress ranges given as [[sncurve]] in the config
+// N = Cycles*(Reference/S)^M above Limit, N = ND*(Limit/S)^M2 between Cutoff and Limit
+// and ranges below Cutoff don't damage
+type SNCurve struct {
+	Name      string  `toml:"name"`
+	Reference float64 `toml:"reference"` // stress range at Cycles [MPa]
+	Cycles    float64 `toml:"cycles"`    // default: 2e6
+	M         float64 `toml:"m"`         // default: 3
+	Limit     float64 `toml:"limit"`     // constant amplitude fatigue limit [MPa] (0 for a single slope)
+	M2        float64 `toml:"m2"`        // slope below Limit (default: M+2)
+	Cutoff    float64 `toml:"cutoff"`    // [MPa]
+}
+
+func (c *SNCurve) normalize() {
+	if c.Cycles == 0 {
+		c.Cycles = 2e6
+	}
+	if c.M == 0 {
+		c.M = 3.0
+	}
+	if c.M2 == 0 {
+		c.M2 = c.M + 2.0
+	}
+}
+
+// Validate checks the curve
+func (c SNCurve) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("sncurve: no name")
+	}
+	for _, v := range []float64{c.Reference, c.Cycles, c.M, c.M2} {
+		if !(v > 0) || math.IsInf(v, 0) {
+			return fmt.Errorf("sncurve %s: invalid value: %f", c.Name, v)
+		}
+	}
+	if !(c.Limit >= 0 && c.Cutoff >= 0) || (c.Limit > 0 && c.Cutoff > c.Limit) {
+		return fmt.Errorf("sncurve %s: invalid limit/cutoff: %f/%f", c.Name, c.Limit, c.Cutoff)
+	}
+	return nil
+}
+
+// EC3Curve returns the curve of detail category [MPa] of Eurocode 3 (EN 1993-1-9)
+// The limit is at 5e6 cycles and the cutoff at 1e8 cycles
+func EC3Curve(category float64) SNCurve {
+	limit := category * math.Pow(2.0/5.0, 1.0/3.0)
+	return SNCurve{
+		Name:      fmt.Sprintf("EC3-%g", category),
+		Reference: category,
+		Cycles:    2e6,
+		M:         3.0,
+		Limit:     limit,
+		M2:        5.0,
+		Cutoff:    limit * math.Pow(5e6/1e8, 1.0/5.0),
+	}
+}
+
+// Life returns the number of cycles to failure at stress range s [MPa] (+Inf below the cutoff)
+func (c SNCurve) Life(s float64) float64 {
+	s = math.Abs(s)
+	if s == 0 || s < c.Cutoff {
+		return math.Inf(1)
+	}
+	if c.Limit == 0 || s >= c.Limit {
+		return c.Cycles * math.Pow(c.Reference/s, c.M)
+	}
+	nd := c.Cycles * math.Pow(c.Reference/c.Limit, c.M)
+	return nd * math.Pow(c.Limit/s, c.M2)
+}
+
+// Damage returns damage of a cycle by Miner's rule
+func (c SNCurve) Damage(cy Cycle) float64 {
+	return cy.Count / c.Life(cy.Range)
+}
+
+var (
+	sncurves     = make(map[string]SNCurve)
+	sncurveslock sync.RWMutex
+)
+
+// RegisterSNCurve registers c by its name
+func RegisterSNCurve(c SNCurve) error {
+	c.normalize()
+	err := c.Validate()
+	if err != nil {
+		return err
+	}
+	sncurveslock.Lock()
+	defer sncurveslock.Unlock()
+	sncurves[c.Name] = c
+	return nil
+}
+
+// LookupSNCurve returns the curve registered as name
+// "EC3-<category>" is the curve of Eurocode 3 unless registered
+func LookupSNCurve(name string) (SNCurve, bool) {
+	sncurveslock.RLock()
+	c, ok := sncurves[name]
+	sncurveslock.RUnlock()
+	if ok {
+		return c, true
+	}
+	if strings.HasPrefix(name, "EC3-") {
+		cat, err := strconv.ParseFloat(name[4:], 64)
+		if err == nil && cat > 0 {
+			return EC3Curve(cat), true
+		}
+	}
+	return SNCurve{}, false
+}
+
+// SNCurves returns registered curves sorted by name
+func SNCurves() []SNCurve {
+	sncurveslock.RLock()
+	defer sncurveslock.RUnlock()
+	rtn := make([]SNCurve, 0, len(sncurves))
+	for _, c := range sncurves {
+		rtn = append(rtn, c)
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].Name < rtn[j].Name
+	})
+	return rtn
+}
@@ -0,0 +1,194 @@
+package rz2
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PolicyRaw     = "raw"
+	PolicyEvery   = "every"
+	PolicyTrigger = "trigger"
+)
+
+// default hold of trigger policies [s]
+const policyHold = 60
+
+// Policy describes how messages with a topic extension are stored
+type Policy struct {
+	Mode    string `toml:"mode"`
+	Every   int    `toml:"every"`
+	Trigger string `toml:"trigger"`
+	Hold    int    `toml:"hold"`
+}
+
+func (p *Policy) normalize() {
+	if p.Mode == "" {
+		p.Mode = PolicyRaw
+	}
+	if p.Mode == PolicyEvery && p.Every == 0 {
+		p.Every = 1
+	}
+	if p.Mode == PolicyTrigger && p.Hold == 0 {
+		p.Hold = policyHold
+	}
+}
+
+// Validate checks the mode and its parameters
+func (p Policy) Validate() error {
+	switch p.Mode {
+	case PolicyRaw:
+	case PolicyEvery:
+		if p.Every < 1 {
+			return fmt.Errorf("invalid every: %d", p.Every)
+		}
+	case PolicyTrigger:
+		if p.Trigger == "" {
+			return fmt.Errorf("no trigger")
+		}
+		if p.Hold <= 0 {
+			return fmt.Errorf("invalid hold: %d", p.Hold)
+		}
+	default:
+		return fmt.Errorf("unknown mode: %s", p.Mode)
+	}
+	return nil
+}
+
+func (p Policy) String() string {
+	switch p.Mode {
+	case PolicyEvery:
+		return fmt.Sprintf("every %d", p.Every)
+	case PolicyTrigger:
+		return fmt.Sprintf("trigger %s (hold %ds)", p.Trigger, p.Hold)
+	default:
+		return PolicyRaw
+	}
+}
+
+func matchAny(patterns []string, topic string) bool {
+	for _, p := range patterns {
+		if MatchTopic(p, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+type filterCount struct {
+	stored  int
+	dropped int
+}
+
+// TopicFilter decides which received messages are recorded
+type TopicFilter struct {
+	sync.Mutex
+	include   []string
+	exclude   []string
+	policy    map[string]Policy
+	counter   map[string]int
+	triggered map[string]time.Time
+	count     map[string]*filterCount
+}
+
+func NewTopicFilter(c *Config) *TopicFilter {
+	policy := make(map[string]Policy)
+	for ext, p := range c.Policy {
+		p.normalize()
+		policy[ext] = p
+	}
+	return &TopicFilter{
+		include:   c.Include,
+		exclude:   c.Exclude,
+		policy:    policy,
+		counter:   make(map[string]int),
+		triggered: make(map[string]time.Time),
+		count:     make(map[string]*filterCount),
+	}
+}
+
+// Accept reports whether the message on topic should be recorded
+func (f *TopicFilter) Accept(topic string) bool {
+	f.Lock()
+	defer f.Unlock()
+	now := time.Now()
+	for ext, p := range f.policy {
+		if p.Mode == PolicyTrigger && p.Trigger != "" && MatchTopic(p.Trigger, topic) {
+			f.triggered[ext] = now.Add(time.Duration(p.Hold) * time.Second)
+		}
+	}
+	ext := ""
+	if lis := strings.Split(topic, "/"); len(lis) >= 3 {
+		ext = lis[2]
+	}
+	c := f.count[ext]
+	if c == nil {
+		c = &filterCount{}
+		f.count[ext] = c
+	}
+	if !f.accept(topic, ext, now) {
+		c.dropped++
+		return false
+	}
+	c.stored++
+	return true
+}
+
+func (f *TopicFilter) accept(topic, ext string, now time.Time) bool {
+	if len(f.include) > 0 && !matchAny(f.include, topic) {
+		return false
+	}
+	if matchAny(f.exclude, topic) {
+		return false
+	}
+	p, ok := f.policy[ext]
+	if !ok {
+		return true
+	}
+	switch p.Mode {
+	case PolicyEvery:
+		if p.Every <= 1 {
+			return true
+		}
+		n := f.counter[topic]
+		f.counter[topic] = (n + 1) % p.Every
+		return n == 0
+	case PolicyTrigger:
+		return now.Before(f.triggered[ext])
+	default:
+		return true
+	}
+}
+
+// Status returns stored/dropped message counts per extension since the last call
+func (f *TopicFilter) Status() string {
+	f.Lock()
+	defer f.Unlock()
+	exts := make([]string, 0, len(f.count))
+	for ext := range f.count {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	var otp bytes.Buffer
+	for _, ext := range exts {
+		name := ext
+		if name == "" {
+			name = "(none)"
+		}
+		p, ok := f.policy[ext]
+		if !ok {
+			p = Policy{Mode: PolicyRaw}
+		}
+		active := ""
+		if p.Mode == PolicyTrigger && time.Now().Before(f.triggered[ext]) {
+			active = ", active"
+		}
+		otp.WriteString(fmt.Sprintf("%s: stored= %d, dropped= %d [%s%s]\n", name, f.count[ext].stored, f.count[ext].dropped, p, active))
+	}
+	f.count = make(map[string]*filterCount)
+	return otp.String()
+}
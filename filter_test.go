@@ -0,0 +1,24 @@
+package rz2
+
+import (
+	"testing"
+)
+
+func TestTopicFilterTriggerDefaultHold(t *testing.T) {
+	c := &Config{
+		Policy: map[string]Policy{
+			"acc02": Policy{Mode: PolicyTrigger, Trigger: "+/+/event"},
+		},
+	}
+	f := NewTopicFilter(c)
+	if f.Accept("b8:27:eb:00:00:01/01/acc02") {
+		t.Error("stored before trigger")
+	}
+	f.Accept("b8:27:eb:00:00:01/01/event")
+	if !f.Accept("b8:27:eb:00:00:01/01/acc02") {
+		t.Error("not stored after trigger")
+	}
+	if err := (Policy{Mode: PolicyTrigger, Trigger: "+/+/event", Hold: -1}).Validate(); err == nil {
+		t.Error("negative hold accepted")
+	}
+}
@@ -0,0 +1,371 @@
+package rz2
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	forwardQueueSize = 16 << 20 // default maximum size of a ForwardQueue [bytes]
+	forwardTimeout   = 5 * time.Second
+	reconnectMax     = time.Minute // maximum interval of reconnection
+)
+
+// ForwardQueue is a bounded on-disk queue of payloads not yet published
+// The file is a sequence of ClientRecord readable by ReadClientRecord,
+// and payloads left by a previous run are forwarded after restart
+// The oldest quarter is dropped when the file is full
+type ForwardQueue struct {
+	fn         string
+	max        int64
+	lock       sync.Mutex
+	forwarding sync.Mutex // serializes Forward, which releases lock while publishing
+	count      int
+	size       int64
+	dropped    int
+}
+
+// NewForwardQueue opens the queue of file fn up to max bytes (0 for default)
+// A record broken by a crash while writing is discarded
+func NewForwardQueue(fn string, max int64) (*ForwardQueue, error) {
+	if max <= 0 {
+		max = forwardQueueSize
+	}
+	q := &ForwardQueue{fn: fn, max: max}
+	records, err := ReadClientRecord(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return q, nil
+		}
+		if records == nil {
+			return nil, err
+		}
+		err = q.rewrite(records)
+		if err != nil {
+			return nil, err
+		}
+		return q, nil
+	}
+	q.count = len(records)
+	for _, r := range records {
+		q.size += 12 + int64(len(r.Data))
+	}
+	// ReadClientRecord stops without error at a header whose data is cut,
+	// which must be removed before Push appends to the file
+	info, err := os.Stat(fn)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != q.size {
+		err = os.Truncate(fn, q.size)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// rewrite replaces the file with records
+func (q *ForwardQueue) rewrite(records []ClientRecord) error {
+	tmp := q.fn + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	size := int64(0)
+	for _, r := range records {
+		err := WriteClientRecord(w, r)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		size += 12 + int64(len(r.Data))
+	}
+	err = w.Flush()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, q.fn)
+	if err != nil {
+		return err
+	}
+	q.count = len(records)
+	q.size = size
+	return nil
+}
+
+// Push appends payload sent at time [ms]
+func (q *ForwardQueue) Push(time int64, payload []byte) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	need := 12 + int64(len(payload))
+	if need > q.max {
+		return fmt.Errorf("forward queue: payload too large: %d", len(payload))
+	}
+	if q.size+need > q.max {
+		records, err := ReadClientRecord(q.fn)
+		if err != nil {
+			return err
+		}
+		size := q.size
+		i := 0
+		for i < len(records) && (i < len(records)/4 || size+need > q.max) {
+			size -= 12 + int64(len(records[i].Data))
+			i++
+		}
+		err = q.rewrite(records[i:])
+		if err != nil {
+			return err
+		}
+		q.dropped += i
+	}
+	f, err := os.OpenFile(q.fn, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	err = WriteClientRecord(f, ClientRecord{Time: time, Size: int32(len(payload)), Data: payload})
+	if err != nil {
+		f.Close()
+		// remove a record written partially
+		os.Truncate(q.fn, q.size)
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	q.count++
+	q.size += need
+	return nil
+}
+
+// Forward calls fn with up to limit payloads in order (all if limit <= 0) and removes the sent ones
+// It stops at the first error of fn and returns the number of sent payloads
+// The file is read and rewritten once, and fn is called without the lock,
+// so that Push is not blocked while payloads are published
+func (q *ForwardQueue) Forward(limit int, fn func(ClientRecord) error) (int, error) {
+	q.forwarding.Lock()
+	defer q.forwarding.Unlock()
+	q.lock.Lock()
+	if q.count == 0 {
+		q.lock.Unlock()
+		return 0, nil
+	}
+	records, err := ReadClientRecord(q.fn)
+	dropped := q.dropped
+	q.lock.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	if limit <= 0 || limit > len(records) {
+		limit = len(records)
+	}
+	sent := 0
+	for sent < limit {
+		err = fn(records[sent])
+		if err != nil {
+			break
+		}
+		sent++
+	}
+	if sent == 0 {
+		return 0, err
+	}
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	// Push may have dropped the oldest payloads, which were sent or not, while forwarding
+	remove := sent - (q.dropped - dropped)
+	if remove <= 0 {
+		return sent, err
+	}
+	if remove == q.count {
+		rerr := os.Remove(q.fn)
+		if rerr != nil {
+			return sent, rerr
+		}
+		q.count, q.size = 0, 0
+		return sent, err
+	}
+	records, rerr := ReadClientRecord(q.fn)
+	if rerr != nil {
+		return sent, rerr
+	}
+	rerr = q.rewrite(records[remove:])
+	if rerr != nil {
+		return sent, rerr
+	}
+	return sent, err
+}
+
+// Len returns the number of queued payloads
+func (q *ForwardQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.count
+}
+
+// Size returns the size of the file [bytes]
+func (q *ForwardQueue) Size() int64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.size
+}
+
+// Dropped returns the number of payloads dropped because the queue was full
+func (q *ForwardQueue) Dropped() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.dropped
+}
+
+// String returns the depth of the queue for logs
+func (q *ForwardQueue) String() string {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return fmt.Sprintf("queue: %d payloads, %d bytes, %d dropped", q.count, q.size, q.dropped)
+}
+
+// Forwarder publishes payloads, and keeps them in a ForwardQueue per topic while the broker is unreachable
+type Forwarder struct {
+	client mqtt.Client
+	dir    string
+	max    int64
+	lock   sync.Mutex
+	queues map[string]*ForwardQueue
+}
+
+// NewForwarder returns a Forwarder of client with queue files up to max bytes (0 for default) in dir
+func NewForwarder(client mqtt.Client, dir string, max int64) *Forwarder {
+	return &Forwarder{
+		client: client,
+		dir:    dir,
+		max:    max,
+		queues: make(map[string]*ForwardQueue),
+	}
+}
+
+// QueueFile returns the file name of the queue of topic
+func QueueFile(topic string) string {
+	return strings.NewReplacer(":", "", "/", "_").Replace(topic) + ".queue"
+}
+
+// queue returns the queue of topic, which holds payloads left by a previous run if any
+func (f *Forwarder) queue(topic string) (*ForwardQueue, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if q, ok := f.queues[topic]; ok {
+		return q, nil
+	}
+	q, err := NewForwardQueue(filepath.Join(f.dir, QueueFile(topic)), f.max)
+	if err != nil {
+		return nil, err
+	}
+	if q.Len() > 0 {
+		log.Printf("%s: %s left\n", topic, q)
+	}
+	f.queues[topic] = q
+	return q, nil
+}
+
+func (f *Forwarder) publish(topic string, payload []byte) error {
+	if !f.client.IsConnected() {
+		return fmt.Errorf("not connected")
+	}
+	// QoS 1 so that payloads are removed from queues only after PUBACK;
+	// a token of QoS 0 completes when the payload is written to a connection which may be dead
+	token := f.client.Publish(topic, 1, false, payload)
+	if !token.WaitTimeout(forwardTimeout) {
+		return fmt.Errorf("publish timeout")
+	}
+	return token.Error()
+}
+
+// Publish publishes payload sent at time [ms] to topic
+// It is queued while the broker is unreachable or older payloads of topic are waiting,
+// and true is returned then
+func (f *Forwarder) Publish(topic string, time int64, payload []byte) (bool, error) {
+	q, err := f.queue(topic)
+	if err != nil {
+		return false, err
+	}
+	if q.Len() == 0 && f.publish(topic, payload) == nil {
+		return false, nil
+	}
+	return true, q.Push(time, payload)
+}
+
+// Run keeps the client connected and forwards queued payloads in order
+// Reconnection backs off up to a minute. It doesn't return
+func (f *Forwarder) Run() {
+	wait := time.Second
+	for {
+		if !f.client.IsConnected() {
+			token := f.client.Connect()
+			token.WaitTimeout(forwardTimeout)
+			if !f.client.IsConnected() {
+				log.Printf("reconnect: %v, retry in %s; %s\n", token.Error(), wait, f)
+				time.Sleep(wait)
+				wait *= 2
+				if wait > reconnectMax {
+					wait = reconnectMax
+				}
+				continue
+			}
+			log.Printf("reconnected; %s\n", f)
+		}
+		wait = time.Second
+		sent := 0
+		for _, topic := range f.topics() {
+			q, _ := f.queue(topic)
+			n, err := q.Forward(0, func(r ClientRecord) error {
+				return f.publish(topic, r.Data)
+			})
+			sent += n
+			if n > 0 || err != nil {
+				log.Printf("%s: forwarded %d, %s, %v\n", topic, n, q, err)
+			}
+		}
+		if sent == 0 {
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func (f *Forwarder) topics() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	rtn := make([]string, 0, len(f.queues))
+	for topic := range f.queues {
+		rtn = append(rtn, topic)
+	}
+	sort.Strings(rtn)
+	return rtn
+}
+
+// String returns the total depth of queues for logs
+func (f *Forwarder) String() string {
+	count, dropped := 0, 0
+	size := int64(0)
+	for _, topic := range f.topics() {
+		q, _ := f.queue(topic)
+		count += q.Len()
+		size += q.Size()
+		dropped += q.Dropped()
+	}
+	return fmt.Sprintf("queue: %d payloads, %d bytes, %d dropped", count, size, dropped)
+}
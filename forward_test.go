@@ -0,0 +1,97 @@
+package rz2
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestForwardQueuePushWhileForwarding(t *testing.T) {
+	q, err := NewForwardQueue(filepath.Join(t.TempDir(), "test.queue"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		err := q.Push(int64(i), []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := make([]byte, 0)
+	n, err := q.Forward(0, func(r ClientRecord) error {
+		if len(got) == 5 {
+			return fmt.Errorf("not connected")
+		}
+		got = append(got, r.Data[0])
+		// fn is called without the lock
+		return q.Push(int64(9+len(got)), []byte{byte(9 + len(got))})
+	})
+	if n != 5 || err == nil {
+		t.Fatalf("sent: %d, error: %v", n, err)
+	}
+	n, err = q.Forward(0, func(r ClientRecord) error {
+		got = append(got, r.Data[0])
+		return nil
+	})
+	if n != 10 || err != nil {
+		t.Fatalf("sent: %d, error: %v", n, err)
+	}
+	for i, b := range got {
+		if int(b) != i {
+			t.Fatalf("payload %d: %d", i, b)
+		}
+	}
+	if q.Len() != 0 || q.Size() != 0 {
+		t.Fatal(q)
+	}
+}
+
+// a header without data is left by a crash while writing a payload
+func TestForwardQueueTornWrite(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.queue")
+	q, err := NewForwardQueue(fn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		err := q.Push(int64(i), []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.OpenFile(fn, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := hex.DecodeString("000000000000006400000010")
+	f.Write(b)
+	f.Close()
+	q, err = NewForwardQueue(fn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 2 || q.Size() != 26 {
+		t.Fatal(q)
+	}
+	for i := 2; i < 4; i++ {
+		err := q.Push(int64(i), []byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := make([]byte, 0)
+	n, err := q.Forward(0, func(r ClientRecord) error {
+		got = append(got, r.Data[0])
+		return nil
+	})
+	if n != 4 || err != nil {
+		t.Fatalf("sent: %d, error: %v", n, err)
+	}
+	for i, b := range got {
+		if int(b) != i {
+			t.Fatalf("payload %d: %d", i, b)
+		}
+	}
+}
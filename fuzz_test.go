@@ -0,0 +1,136 @@
+//go:build go1.18
+// +build go1.18
+
+package rz2
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// fuzzSizes are data sizes which broke decoders
+var fuzzSizes = []int32{0, 1, 2, 3, 4, 7, 8, 12, 44, 65, 130, 0x7fff, 0x7fffffff, -1, -0x80000000}
+
+// fuzzHeader returns a payload of send_time and data_size followed by body
+func fuzzHeader(size int32, body []byte) []byte {
+	b := make([]byte, 12+len(body))
+	binary.BigEndian.PutUint64(b[:8], uint64(goldenTime))
+	binary.BigEndian.PutUint32(b[8:12], uint32(size))
+	copy(b[12:], body)
+	return b
+}
+
+// fuzzSeeds adds golden vectors of ext, broken headers and extra to the corpus
+func fuzzSeeds(f *testing.F, ext string, extra ...[]byte) {
+	f.Add([]byte{})
+	for _, s := range fuzzSizes {
+		f.Add(fuzzHeader(s, make([]byte, 64)))
+	}
+	for _, b := range goldenBytes(f, ext) {
+		f.Add(b)
+	}
+	for _, b := range extra {
+		f.Add(b)
+	}
+}
+
+// fuzzDecoder checks that the decoder registered for ext returns an error instead of panicking
+func fuzzDecoder(f *testing.F, ext string, extra ...[]byte) {
+	fuzzSeeds(f, ext, extra...)
+	topic := NewTopic("00:00:00:00:00:00", 1, ext).String()
+	f.Fuzz(func(t *testing.T, b []byte) {
+		s, err := Decode(topic, b)
+		if err == nil && s == nil {
+			t.Fatal("no series without error")
+		}
+	})
+}
+
+func FuzzAcc02(f *testing.F) {
+	fuzzDecoder(f, "acc02")
+}
+
+func FuzzAcc01(f *testing.F) {
+	fuzzDecoder(f, "acc01", make([]byte, 9*25))
+}
+
+func FuzzStr01(f *testing.F) {
+	fuzzDecoder(f, "str01")
+}
+
+func FuzzSht31(f *testing.F) {
+	fuzzDecoder(f, "sht31")
+}
+
+func FuzzIll01(f *testing.F) {
+	fuzzDecoder(f, "ill01")
+}
+
+func FuzzIr01(f *testing.F) {
+	fuzzDecoder(f, "ir01")
+}
+
+func FuzzGill01(f *testing.F) {
+	fuzzDecoder(f, "gill01")
+}
+
+func FuzzGps01(f *testing.F) {
+	fuzzDecoder(f, "gps01")
+}
+
+func FuzzCsv01(f *testing.F) {
+	fuzzDecoder(f, "csv01")
+}
+
+func FuzzClk01(f *testing.F) {
+	fuzzDecoder(f, "clk01")
+}
+
+func FuzzAmg88(f *testing.F) {
+	b, err := EncodeAmg(make([]float64, 65))
+	if err != nil {
+		f.Fatal(err)
+	}
+	fuzzDecoder(f, "amg88", b, make([]byte, 130))
+}
+
+func FuzzInfo(f *testing.F) {
+	fuzzDecoder(f, "info", []byte(`{"name":"rz2","time":"2020-09-13 12:26:40"}`))
+}
+
+func FuzzConvertDecimated(f *testing.F) {
+	b, err := EncodeDecimated(goldenTime, 10, [][]float64{{1, 2, 3}, {4, 5, 6}})
+	if err != nil {
+		f.Fatal(err)
+	}
+	fuzzSeeds(f, ExtDecimated10, b)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		ConvertDecimated(b)
+	})
+}
+
+func FuzzConvertAccStats(f *testing.F) {
+	b, err := EncodeAccStats([]AccStats{{Time: goldenTime, Max: [3]float64{1, 2, 3}}})
+	if err != nil {
+		f.Fatal(err)
+	}
+	fuzzSeeds(f, ExtAccStats, b)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		ConvertAccStats(b)
+	})
+}
+
+func FuzzDecodeSpectrum(f *testing.F) {
+	data := make([][]float64, bufsize/2)
+	for i := range data {
+		data[i] = []float64{float64(i), 1, 2, 3}
+	}
+	b, err := EncodeSpectrum(data)
+	if err != nil {
+		f.Fatal(err)
+	}
+	fuzzSeeds(f, "spectrum", b)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		DecodeSpectrum(b)
+	})
+}
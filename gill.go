@@ -4,23 +4,338 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 )
 
+const (
+	gillStale   = 5000 // default time without valid readings until the sensor is stale [ms]
+	gillSize    = 16   // data size of gill01 without health
+	gillHealthy = 32   // data size of gill01 with health
+)
+
+// GillHealth is the health of a Gill anemometer in a publish interval
+type GillHealth struct {
+	Count  int32 // number of averaged readings (0 when no reading or stale)
+	Status int32 // worst status code of the interval
+	Errors int32 // number of lines with a broken format or checksum
+	Age    int32 // time since the last valid reading [ms]
+}
+
+// ConvertGill returns direction and speed, and count, status, errors and age if the payload has health
 func ConvertGill(b []byte) (int64, []float64, error) {
-	if len(b) < 28 {
-		return 0, nil, fmt.Errorf("not enough byte size")
-	}
-	var send_time int64
-	var data_size int32
-	buf := bytes.NewReader(b[:8])
-	binary.Read(buf, binary.BigEndian, &send_time)
-	buf = bytes.NewReader(b[8:12])
-	binary.Read(buf, binary.BigEndian, &data_size)
+	err := checkLength("gill01", b, 28)
+	if err != nil {
+		return 0, nil, err
+	}
+	send_time, data_size, _ := readHeader("gill01", b)
 	var angle float64
 	var speed float64
-	buf = bytes.NewReader(b[12:20])
+	buf := bytes.NewReader(b[12:20])
 	binary.Read(buf, binary.BigEndian, &angle)
 	buf = bytes.NewReader(b[20:28])
 	binary.Read(buf, binary.BigEndian, &speed)
-	return send_time, []float64{angle, speed}, nil
+	if data_size < gillHealthy {
+		return send_time, []float64{angle, speed}, nil
+	}
+	err = checkLength("gill01", b, 12+gillHealthy)
+	if err != nil {
+		return 0, nil, err
+	}
+	var h GillHealth
+	binary.Read(bytes.NewReader(b[28:44]), binary.BigEndian, &h)
+	return send_time, []float64{angle, speed, float64(h.Count), float64(h.Status), float64(h.Errors), float64(h.Age)}, nil
+}
+
+// EncodeGill converts wind direction [deg] and speed [m/s] to binary data (gill01)
+func EncodeGill(send_time int64, angle, speed float64) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Grow(12 + gillSize)
+	err := writeHeader(buf, send_time, gillSize)
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, []float64{angle, speed})
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeGillHealth converts wind direction [deg], speed [m/s] and health to binary data (gill01)
+// Readers of the older format see direction and speed only
+func EncodeGillHealth(send_time int64, angle, speed float64, h GillHealth) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Grow(12 + gillHealthy)
+	err := writeHeader(buf, send_time, gillHealthy)
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, []float64{angle, speed})
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, h)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gillUnits converts units of Gill to m/s
+var gillUnits = map[string]float64{
+	"M": 1.0,           // m/s
+	"N": 1852.0 / 3600, // knots
+	"P": 0.44704,       // mph
+	"K": 1.0 / 3.6,     // km/h
+	"F": 0.00508,       // ft/min
+}
+
+// GillStatusText returns the meaning of status code of WindSonic
+func GillStatusText(code int) string {
+	switch code {
+	case 0x00:
+		return "ok"
+	case 0x01:
+		return "axis 1 failed"
+	case 0x02:
+		return "axis 2 failed"
+	case 0x04:
+		return "axis 1 and 2 failed"
+	case 0x08:
+		return "NVM error"
+	case 0x09:
+		return "ROM error"
+	case 0x0A:
+		return "maximum gain"
+	case 0x51:
+		return "measurement average building"
+	default:
+		return fmt.Sprintf("unknown status %02X", code)
+	}
+}
+
+// GillStatusValid reports whether a reading with status code has valid wind
+func GillStatusValid(code int) bool {
+	switch code {
+	case 0x00, 0x0A, 0x51:
+		return true
+	default:
+		return false
+	}
+}
+
+// GillReading is a line of a Gill anemometer
+type GillReading struct {
+	Node      string
+	Direction float64 // [deg] (NaN when the speed is too low to have direction)
+	Speed     float64 // [m/s]
+	Unit      string  // unit of the line
+	Status    int
+	Checked   bool // true if the line had a checksum
+}
+
+// ParseGill parses a line of Gill ASCII in polar or UV format, or NMEA MWV
+//
+//	<STX>Q,229,002.74,M,00,<ETX>16
+//	<STX>Q,+001.70,-002.15,M,00,<ETX>36
+//	$IIMWV,229,R,002.74,M,A*18
+//
+// UV components are positive for wind from north (U) and west (V)
+// A line with a wrong checksum is an error
+func ParseGill(line string) (GillReading, error) {
+	line = strings.TrimRight(line, "\r\n")
+	if i := strings.IndexByte(line, '$'); i >= 0 {
+		return parseMWV(line[i:])
+	}
+	r := GillReading{}
+	if i := strings.IndexByte(line, '\x02'); i >= 0 {
+		line = line[i+1:]
+		j := strings.IndexByte(line, '\x03')
+		if j < 0 {
+			return r, fmt.Errorf("gill: no ETX: %q", line)
+		}
+		err := checkXORSum(line[:j], line[j+1:])
+		if err != nil {
+			return r, fmt.Errorf("gill: %s", err)
+		}
+		line = line[:j]
+		r.Checked = true
+	}
+	lis := strings.Split(strings.TrimSuffix(line, ","), ",")
+	if len(lis) < 5 {
+		return r, fmt.Errorf("gill: not enough fields: %q", line)
+	}
+	r.Node = lis[0]
+	r.Unit = lis[3]
+	factor, ok := gillUnits[r.Unit]
+	if !ok {
+		return r, fmt.Errorf("gill: unknown unit: %q", r.Unit)
+	}
+	status, err := strconv.ParseUint(lis[4], 16, 8)
+	if err != nil {
+		return r, fmt.Errorf("gill: status: %q", lis[4])
+	}
+	r.Status = int(status)
+	if strings.HasPrefix(lis[1], "+") || strings.HasPrefix(lis[1], "-") {
+		u, err := strconv.ParseFloat(lis[1], 64)
+		if err != nil {
+			return r, err
+		}
+		v, err := strconv.ParseFloat(lis[2], 64)
+		if err != nil {
+			return r, err
+		}
+		r.Speed = math.Hypot(u, v) * factor
+		r.Direction = math.NaN()
+		if r.Speed > 0 {
+			r.Direction = math.Mod(math.Atan2(-v, u)*180.0/math.Pi+360.0, 360.0)
+		}
+		return r, nil
+	}
+	speed, err := strconv.ParseFloat(lis[2], 64)
+	if err != nil {
+		return r, err
+	}
+	r.Speed = speed * factor
+	r.Direction = math.NaN()
+	if lis[1] != "" {
+		r.Direction, err = strconv.ParseFloat(lis[1], 64)
+		if err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// parseMWV parses $--MWV,angle,R|T,speed,unit,A|V*hh
+func parseMWV(line string) (GillReading, error) {
+	r := GillReading{Direction: math.NaN()}
+	i := strings.IndexByte(line, '*')
+	if i < 0 {
+		return r, fmt.Errorf("gill: no checksum: %q", line)
+	}
+	err := checkXORSum(line[1:i], line[i+1:])
+	if err != nil {
+		return r, fmt.Errorf("gill: %s", err)
+	}
+	r.Checked = true
+	lis := strings.Split(line[1:i], ",")
+	if len(lis) < 6 || !strings.HasSuffix(lis[0], "MWV") {
+		return r, fmt.Errorf("gill: not MWV: %q", line)
+	}
+	r.Node = lis[0]
+	r.Unit = lis[4]
+	// NMEA has N for knots too, but K for km/h and M for m/s as Gill
+	factor, ok := gillUnits[r.Unit]
+	if !ok || r.Unit == "P" || r.Unit == "F" {
+		return r, fmt.Errorf("gill: unknown unit: %q", r.Unit)
+	}
+	speed, err := strconv.ParseFloat(lis[3], 64)
+	if err != nil {
+		return r, err
+	}
+	r.Speed = speed * factor
+	if lis[1] != "" {
+		r.Direction, err = strconv.ParseFloat(lis[1], 64)
+		if err != nil {
+			return r, err
+		}
+	}
+	if lis[5] != "A" {
+		// data not valid
+		r.Status = 0x04
+	}
+	return r, nil
+}
+
+// checkXORSum checks that sum is XOR of the bytes of body in 2 hex digits (Gill and NMEA)
+func checkXORSum(body, sum string) error {
+	sum = strings.TrimSpace(sum)
+	if len(sum) < 2 {
+		return fmt.Errorf("no checksum: %q", body)
+	}
+	want, err := strconv.ParseUint(sum[:2], 16, 8)
+	if err != nil {
+		return fmt.Errorf("invalid checksum: %q", sum)
+	}
+	var got byte
+	for i := 0; i < len(body); i++ {
+		got ^= body[i]
+	}
+	if got != byte(want) {
+		return fmt.Errorf("checksum error: %02X != %02X", got, want)
+	}
+	return nil
+}
+
+// GillAverager averages readings in a publish interval
+type GillAverager struct {
+	stale  int64
+	last   int64 // time of the last valid reading
+	count  int
+	speed  float64
+	su, sv float64
+	status int
+	errors int
+}
+
+// NewGillAverager returns a GillAverager which is stale after stale [ms] without valid readings (0 for default)
+func NewGillAverager(stale int64) *GillAverager {
+	if stale <= 0 {
+		stale = gillStale
+	}
+	return &GillAverager{stale: stale, last: math.MinInt64}
+}
+
+// Add adds a reading at time [ms]
+// Readings with a failure status are not averaged but their status is kept
+func (g *GillAverager) Add(time int64, r GillReading) {
+	if r.Status != 0 && (g.status == 0 || GillStatusValid(g.status)) {
+		g.status = r.Status
+	}
+	if !GillStatusValid(r.Status) || math.IsNaN(r.Speed) {
+		return
+	}
+	g.count++
+	g.last = time
+	g.speed += r.Speed
+	if !math.IsNaN(r.Direction) {
+		rad := r.Direction * math.Pi / 180.0
+		g.su += r.Speed * math.Sin(rad)
+		g.sv += r.Speed * math.Cos(rad)
+	}
+}
+
+// Error counts a line which cannot be parsed
+func (g *GillAverager) Error() {
+	g.errors++
+}
+
+// Stale reports whether there has been no valid reading for the stale time
+func (g *GillAverager) Stale(now int64) bool {
+	return g.last == math.MinInt64 || now-g.last > g.stale
+}
+
+// Flush returns scalar mean speed [m/s], direction of the vector mean [deg] and health of the interval
+// Direction and speed are NaN when there is no reading or the sensor is stale
+func (g *GillAverager) Flush(now int64) (float64, float64, GillHealth) {
+	h := GillHealth{Count: int32(g.count), Status: int32(g.status), Errors: int32(g.errors), Age: math.MaxInt32}
+	if g.last != math.MinInt64 && now-g.last < math.MaxInt32 {
+		h.Age = int32(now - g.last)
+	}
+	angle, speed := math.NaN(), math.NaN()
+	if g.count > 0 && !g.Stale(now) {
+		speed = g.speed / float64(g.count)
+		if g.su != 0 || g.sv != 0 {
+			angle = math.Mod(math.Atan2(g.su, g.sv)*180.0/math.Pi+360.0, 360.0)
+		}
+	} else {
+		h.Count = 0
+	}
+	g.count = 0
+	g.speed, g.su, g.sv = 0, 0, 0
+	g.status, g.errors = 0, 0
+	return angle, speed, h
 }
@@ -0,0 +1,74 @@
+package rz2
+
+import (
+	"math"
+	"testing"
+)
+
+// lines of the WindSonic manual
+func TestParseGill(t *testing.T) {
+	for _, c := range []struct {
+		line      string
+		direction float64
+		speed     float64
+		status    int
+		checked   bool
+	}{
+		{"\x02Q,229,002.74,M,00,\x0316\r\n", 229, 2.74, 0, true},
+		{"Q,229,002.74,M,00,", 229, 2.74, 0, false},
+		{"\x02Q,229,002.74,M,01,\x0317", 229, 2.74, 1, true},
+		{"\x02Q,+001.70,-002.15,M,00,\x0336", math.Atan2(2.15, 1.70) * 180.0 / math.Pi, math.Hypot(1.70, 2.15), 0, true},
+		{"$IIMWV,229,R,002.74,M,A*18", 229, 2.74, 0, true},
+		{"$IIMWV,229,R,005.33,N,A*1F", 229, 5.33 * 1852.0 / 3600.0, 0, true},
+		{"$IIMWV,229,R,002.74,M,V*0F", 229, 2.74, 0x04, true},
+	} {
+		r, err := ParseGill(c.line)
+		if err != nil {
+			t.Errorf("%q: %s", c.line, err)
+			continue
+		}
+		if math.Abs(r.Direction-c.direction) > 1e-9 || math.Abs(r.Speed-c.speed) > 1e-9 || r.Status != c.status || r.Checked != c.checked {
+			t.Errorf("%q: %+v", c.line, r)
+		}
+	}
+}
+
+func TestParseGillUV(t *testing.T) {
+	for _, c := range []struct {
+		line      string
+		direction float64
+	}{
+		{"Q,+002.00,+000.00,M,00,", 0},
+		{"Q,+000.00,+002.00,M,00,", 270},
+		{"Q,-002.00,+000.00,M,00,", 180},
+		{"Q,+000.00,-002.00,M,00,", 90},
+	} {
+		r, err := ParseGill(c.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(r.Direction-c.direction) > 1e-9 || r.Speed != 2 {
+			t.Errorf("%q: %g deg, %g m/s", c.line, r.Direction, r.Speed)
+		}
+	}
+	r, err := ParseGill("Q,+000.00,+000.00,M,00,")
+	if err != nil || !math.IsNaN(r.Direction) {
+		t.Errorf("calm: %+v, %v", r, err)
+	}
+}
+
+func TestParseGillError(t *testing.T) {
+	for _, line := range []string{
+		"\x02Q,229,002.74,M,00,\x0317",
+		"\x02Q,229,002.74,M,00,\x03",
+		"\x02Q,229,002.74,M,00,",
+		"$IIMWV,229,R,002.74,M,A*19",
+		"$IIMWV,229,R,002.74,M,A",
+		"Q,229,002.74,X,00,",
+		"Q,229,002.74",
+	} {
+		if _, err := ParseGill(line); err == nil {
+			t.Errorf("%q: no error", line)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package rz2
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"testing"
+)
+
+const goldenTime = 1600000000000 // 2020-09-13T12:26:40Z
+
+// golden byte vectors of device formats
+var goldens = []struct {
+	ext     string
+	encode  func() ([]byte, error)
+	hex     string
+	samples int
+	last    []float64 // leading values of the last decoded sample
+	tol     float64   // absolute tolerance of last (quantized acceleration)
+}{
+	{
+		"acc02",
+		func() ([]byte, error) {
+			return EncodeAccPacket(goldenTime, []float64{1, -1, 980.665, 0.5, 0, -980.665}, 0)
+		},
+		"00000174876e8000" + "00000016" + "00000006" + "001051" + "ffefb0" + "3e8000" + "000831" + "000000" + "c18000",
+		2,
+		[]float64{0.5, 0, -980.665},
+		0.005,
+	},
+	{
+		"acc02",
+		func() ([]byte, error) {
+			return EncodeAccPacket(goldenTime, []float64{1, -1, 980.665, 0.5}, 1)
+		},
+		"00000174876e8000" + "00000010" + "00000004" + "001050" + "ffefb1" + "3e8000" + "000830",
+		1,
+		[]float64{-1, 980.665, 0.5},
+		0.005,
+	},
+	{
+		"str01",
+		func() ([]byte, error) {
+			return EncodeStrain(goldenTime, goldenTime-1000, []float64{0, 1, -1, 8388607, -8388607}, 103, false)
+		},
+		"00000174876e8000" + "0000001c" + "00000174876e7c18" + "00000000" + "00000001" + "00ffffff" + "007fffff" + "00800001",
+		5,
+		[]float64{-151.69901104228012, -8388607},
+		0,
+	},
+	{
+		"sht31",
+		func() ([]byte, error) {
+			return EncodeSht(goldenTime, []float64{25.5, -3.25}, []float64{60, 99.5})
+		},
+		"00000174876e8000" + "00000004" + "41cc0000" + "42700000" + "c0500000" + "42c70000",
+		2,
+		[]float64{-3.25, 99.5},
+		0,
+	},
+	{
+		"ill01",
+		func() ([]byte, error) {
+			return EncodeIll(goldenTime, []int{0, 1, 1000, -1})
+		},
+		"00000174876e8000" + "00000004" + "0000" + "0001" + "03e8" + "ffff",
+		2,
+		[]float64{0, 1000, 65535},
+		0,
+	},
+	{
+		"ir01",
+		func() ([]byte, error) {
+			return EncodeIR(goldenTime, -5)
+		},
+		"00000174876e8000" + "00000001" + "fb",
+		1,
+		[]float64{-5},
+		0,
+	},
+	{
+		"gill01",
+		func() ([]byte, error) {
+			return EncodeGill(goldenTime, 123.5, 4.25)
+		},
+		"00000174876e8000" + "00000010" + "405ee00000000000" + "4011000000000000",
+		1,
+		[]float64{123.5, 4.25, math.NaN(), math.NaN(), math.NaN(), math.NaN()},
+		0,
+	},
+	{
+		"gill01",
+		func() ([]byte, error) {
+			return EncodeGillHealth(goldenTime, 123.5, 4.25, GillHealth{Count: 4, Status: 0x0a, Errors: 1, Age: 250})
+		},
+		"00000174876e8000" + "00000020" + "405ee00000000000" + "4011000000000000" + "00000004" + "0000000a" + "00000001" + "000000fa",
+		1,
+		[]float64{123.5, 4.25, 4, 10, 1, 250},
+		0,
+	},
+	{
+		"gps01",
+		func() ([]byte, error) {
+			return EncodeValues(goldenTime, []float64{35.5, 139.75, 40, 1, 8, 0.9, 0, 0, 1600000000000})
+		},
+		"00000174876e8000" + "00000009" + "4041c00000000000" + "4061780000000000" + "4044000000000000" + "3ff0000000000000" + "4020000000000000" + "3feccccccccccccd" + "0000000000000000" + "0000000000000000" + "42774876e8000000",
+		1,
+		[]float64{35.5, 139.75, 40, 1, 8, 0.9, 0, 0, 1600000000000},
+		0,
+	},
+	{
+		"csv01",
+		func() ([]byte, error) {
+			return EncodeValues(goldenTime, []float64{2, -1.5})
+		},
+		"00000174876e8000" + "00000002" + "4000000000000000" + "bff8000000000000",
+		1,
+		[]float64{2, -1.5},
+		0,
+	},
+}
+
+// goldenBytes returns the golden vectors of ext
+func goldenBytes(tb testing.TB, ext string) [][]byte {
+	rtn := make([][]byte, 0)
+	for _, g := range goldens {
+		if g.ext != ext {
+			continue
+		}
+		b, err := hex.DecodeString(g.hex)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		rtn = append(rtn, b)
+	}
+	return rtn
+}
+
+func TestGolden(t *testing.T) {
+	counts := make(map[string]int)
+	for _, g := range goldens {
+		name := fmt.Sprintf("%s/%d", g.ext, counts[g.ext])
+		counts[g.ext]++
+		g := g
+		t.Run(name, func(t *testing.T) {
+			want, err := hex.DecodeString(g.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := g.encode()
+			if err != nil {
+				t.Fatalf("encode: %s", err)
+			}
+			if !bytes.Equal(b, want) {
+				t.Errorf("encode:\n got  %x\n want %x", b, want)
+			}
+			s, err := Decode(NewTopic("00:00:00:00:00:00", 1, g.ext).String(), want)
+			if err != nil {
+				t.Fatalf("decode: %s", err)
+			}
+			if len(s.Samples) != g.samples || s.SendTime != goldenTime {
+				t.Fatalf("decode: %d samples at %d, want %d at %d", len(s.Samples), s.SendTime, g.samples, goldenTime)
+			}
+			values := s.Samples[len(s.Samples)-1].Values
+			for i, v := range g.last {
+				tol := math.Max(g.tol, 1e-9*math.Abs(v))
+				if i >= len(values) || (math.IsNaN(v) != math.IsNaN(values[i])) || math.Abs(values[i]-v) > tol {
+					t.Errorf("decode: %v, want %v", values, g.last)
+					break
+				}
+			}
+		})
+	}
+}
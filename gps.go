@@ -0,0 +1,187 @@
+package rz2
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// gpsChannels are values of gps01 payloads
+var gpsChannels = []Channel{
+	{"latitude", "°"},
+	{"longitude", "°"},
+	{"altitude", "m"},
+	{"quality", ""},
+	{"satellites", ""},
+	{"hdop", ""},
+	{"speed", "m/s"},
+	{"course", "°"},
+	{"gpstime", "ms"},
+}
+
+// GPSFix is the state of a GPS receiver given by NMEA 0183 sentences
+type GPSFix struct {
+	Time       int64   // unix time of the fix [ms] (time of day only until RMC gives the date)
+	Latitude   float64 // [deg] north positive
+	Longitude  float64 // [deg] east positive
+	Altitude   float64 // above mean sea level [m]
+	Quality    int     // fix quality of GGA (0: invalid, 1: GPS, 2: DGPS, ...)
+	Satellites int
+	HDOP       float64
+	Speed      float64 // speed over ground [m/s]
+	Course     float64 // course over ground [deg]
+	date       int64   // unix time of 00:00 UTC of the date of RMC [ms]
+}
+
+// Values returns values of gps01 channels
+func (f GPSFix) Values() []float64 {
+	return []float64{f.Latitude, f.Longitude, f.Altitude, float64(f.Quality), float64(f.Satellites), f.HDOP, f.Speed, f.Course, float64(f.Time)}
+}
+
+// ParseNMEA updates fix by a GGA or RMC sentence ($GPGGA, $GNRMC, ...) and returns its type
+// It returns false when the sentence doesn't give a valid fix
+func ParseNMEA(line string, fix *GPSFix) (string, bool, error) {
+	line = strings.TrimSpace(line)
+	i := strings.IndexByte(line, '$')
+	j := strings.LastIndexByte(line, '*')
+	if i < 0 || j < i {
+		return "", false, fmt.Errorf("nmea: not a sentence: %q", line)
+	}
+	err := checkXORSum(line[i+1:j], line[j+1:])
+	if err != nil {
+		return "", false, fmt.Errorf("nmea: %s", err)
+	}
+	lis := strings.Split(line[i+1:j], ",")
+	if len(lis[0]) != 5 {
+		return "", false, fmt.Errorf("nmea: invalid address: %q", lis[0])
+	}
+	kind := lis[0][2:]
+	switch kind {
+	case "GGA":
+		if len(lis) < 10 {
+			return kind, false, fmt.Errorf("nmea: not enough fields: %q", line)
+		}
+		quality, _ := strconv.Atoi(lis[6])
+		fix.Quality = quality
+		fix.Satellites, _ = strconv.Atoi(lis[7])
+		if quality == 0 {
+			return kind, false, nil
+		}
+		err := fix.parseTime(lis[1])
+		if err != nil {
+			return kind, false, err
+		}
+		fix.Latitude, fix.Longitude, err = parseLatLon(lis[2], lis[3], lis[4], lis[5])
+		if err != nil {
+			return kind, false, err
+		}
+		fix.HDOP = parseOptional(lis[8])
+		fix.Altitude = parseOptional(lis[9])
+		return kind, true, nil
+	case "RMC":
+		if len(lis) < 10 {
+			return kind, false, fmt.Errorf("nmea: not enough fields: %q", line)
+		}
+		if lis[2] != "A" {
+			return kind, false, nil
+		}
+		date, err := time.Parse("020106", lis[9])
+		if err != nil {
+			return kind, false, fmt.Errorf("nmea: date: %q", lis[9])
+		}
+		fix.date = date.UnixNano() / 1000000
+		err = fix.parseTime(lis[1])
+		if err != nil {
+			return kind, false, err
+		}
+		fix.Latitude, fix.Longitude, err = parseLatLon(lis[3], lis[4], lis[5], lis[6])
+		if err != nil {
+			return kind, false, err
+		}
+		fix.Speed = parseOptional(lis[7]) * 1852.0 / 3600.0
+		fix.Course = parseOptional(lis[8])
+		return kind, true, nil
+	default:
+		return kind, false, nil
+	}
+}
+
+// parseTime sets Time by hhmmss.ss and the date of RMC
+func (f *GPSFix) parseTime(s string) error {
+	if len(s) < 6 {
+		return fmt.Errorf("nmea: time: %q", s)
+	}
+	h, err1 := strconv.Atoi(s[:2])
+	m, err2 := strconv.Atoi(s[2:4])
+	sec, err3 := strconv.ParseFloat(s[4:], 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return fmt.Errorf("nmea: time: %q", s)
+	}
+	f.Time = f.date + int64(h)*3600000 + int64(m)*60000 + int64(math.Round(sec*1000.0))
+	return nil
+}
+
+// parseLatLon parses ddmm.mmmm,N|S,dddmm.mmmm,E|W to degrees
+func parseLatLon(lat, ns, lon, ew string) (float64, float64, error) {
+	la, err1 := strconv.ParseFloat(lat, 64)
+	lo, err2 := strconv.ParseFloat(lon, 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, fmt.Errorf("nmea: position: %s,%s", lat, lon)
+	}
+	la = math.Floor(la/100.0) + math.Mod(la, 100.0)/60.0
+	lo = math.Floor(lo/100.0) + math.Mod(lo, 100.0)/60.0
+	if ns == "S" {
+		la = -la
+	}
+	if ew == "W" {
+		lo = -lo
+	}
+	return la, lo, nil
+}
+
+// parseOptional returns NaN for an empty field
+func parseOptional(s string) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return math.NaN()
+	}
+	return v
+}
+
+// gpsParser publishes the latest fix of an interval
+type gpsParser struct {
+	fix   GPSFix
+	stale int64
+	last  int64 // time of the last valid fix
+}
+
+func newGPSParser(in Instrument) (LineParser, error) {
+	return &gpsParser{stale: int64(in.Stale), last: math.MinInt64}, nil
+}
+
+func (p *gpsParser) Parse(time int64, line string) error {
+	_, ok, err := ParseNMEA(line, &p.fix)
+	if err != nil {
+		return err
+	}
+	if ok {
+		p.last = time
+	}
+	return nil
+}
+
+func (p *gpsParser) Flush(time int64) ([]byte, error) {
+	values := p.fix.Values()
+	if p.last == math.MinInt64 || time-p.last > p.stale {
+		// keep quality and satellites to tell why
+		for i := range values {
+			if i != 3 && i != 4 {
+				values[i] = math.NaN()
+			}
+		}
+		values[3] = 0
+	}
+	return EncodeValues(time, values)
+}
@@ -0,0 +1,73 @@
+package rz2
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// sentences of the examples of NMEA 0183 widely used in documents
+const (
+	testGGA = "$GPGGA,123519,4807.038,N,01131.000,E,1,08,0.9,545.4,M,46.9,M,,*47"
+	testRMC = "$GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A"
+)
+
+func TestParseNMEA(t *testing.T) {
+	var fix GPSFix
+	kind, ok, err := ParseNMEA(testGGA, &fix)
+	if kind != "GGA" || !ok || err != nil {
+		t.Fatalf("GGA: %s, %t, %v", kind, ok, err)
+	}
+	if math.Abs(fix.Latitude-(48+7.038/60)) > 1e-9 || math.Abs(fix.Longitude-(11+31.0/60)) > 1e-9 {
+		t.Errorf("GGA position: %g, %g", fix.Latitude, fix.Longitude)
+	}
+	if fix.Altitude != 545.4 || fix.Quality != 1 || fix.Satellites != 8 || fix.HDOP != 0.9 {
+		t.Errorf("GGA: %+v", fix)
+	}
+	// time of day until RMC gives the date
+	if fix.Time != (12*3600+35*60+19)*1000 {
+		t.Errorf("GGA time: %d", fix.Time)
+	}
+	kind, ok, err = ParseNMEA(testRMC+"\r\n", &fix)
+	if kind != "RMC" || !ok || err != nil {
+		t.Fatalf("RMC: %s, %t, %v", kind, ok, err)
+	}
+	want := time.Date(1994, 3, 23, 12, 35, 19, 0, time.UTC).UnixNano() / 1000000
+	if fix.Time != want {
+		t.Errorf("RMC time: %d, want %d", fix.Time, want)
+	}
+	if math.Abs(fix.Speed-22.4*1852.0/3600.0) > 1e-9 || fix.Course != 84.4 {
+		t.Errorf("RMC: speed %g, course %g", fix.Speed, fix.Course)
+	}
+	ParseNMEA(testGGA, &fix)
+	if fix.Time != want {
+		t.Errorf("GGA time after RMC: %d, want %d", fix.Time, want)
+	}
+}
+
+func TestParseNMEANoFix(t *testing.T) {
+	for _, line := range []string{
+		"$GPGGA,123519,,,,,0,00,,,M,,M,,*6B",
+		"$GPRMC,123519,V,,,,,,,230394,,*33",
+		"$GPGSV,1,1,00*79",
+	} {
+		var fix GPSFix
+		if _, ok, err := ParseNMEA(line, &fix); ok || err != nil {
+			t.Errorf("%q: %t, %v", line, ok, err)
+		}
+	}
+}
+
+func TestParseNMEAError(t *testing.T) {
+	for _, line := range []string{
+		testGGA[:len(testGGA)-2] + "48",
+		testRMC[:len(testRMC)-3],
+		"GPGGA,123519",
+		"$GPGGA,123519,4807.038,N,01131.000,E,1,08*77",
+	} {
+		var fix GPSFix
+		if _, ok, err := ParseNMEA(line, &fix); ok || err == nil {
+			t.Errorf("%q: %t, %v", line, ok, err)
+		}
+	}
+}
@@ -12,20 +12,174 @@ var (
 	pow24 int32 = 1 << 24
 )
 
+// factor of str01 = gauge factor * gain of the amplifier before HX711
+// ConvertStrain(b, 103, true) is of the default gauge factor 2.0 and gain 51.5
+const (
+	strainFactor      = 103.0
+	strainGaugeFactor = 2.0
+	strainGain        = strainFactor / strainGaugeFactor
+)
+
+// StrainGauge is the setting of a str01 channel given as [[device.strain]] in the config
+// Fields which are not given have the values of ConvertStrain(b, 103, true)
+type StrainGauge struct {
+	Channel     int     `toml:"channel"`
+	GaugeFactor float64 `toml:"gaugefactor"` // gauge factor of the gauges (default: 2.0)
+	Gain        float64 `toml:"gain"`        // gain of the amplifier between the bridge and HX711 (default: 51.5)
+	Bridge      string  `toml:"bridge"`      // "quarter", "half" or "full"
+	Polarity    int     `toml:"polarity"`    // 1 or -1
+	Offset      float64 `toml:"offset"`      // strain at zero [με]
+	// temperature compensation
+	Thermal   float64 `toml:"thermal"`   // apparent strain per temperature [με/'C] (0 if unknown)
+	Reference string  `toml:"reference"` // sht31 topic measuring temperature of the gauge
+	// fatigue assessment
+	Young   float64 `toml:"young"`   // Young's modulus [GPa] (default: 205)
+	SNCurve string  `toml:"sncurve"` // name of S-N curve ("EC3-80" or [[sncurve]])
+}
+
+// DefaultStrainGauge returns the setting used when a channel isn't configured
+func DefaultStrainGauge(channel int) StrainGauge {
+	g := StrainGauge{Channel: channel}
+	g.normalize()
+	return g
+}
+
+func (g *StrainGauge) normalize() {
+	if g.GaugeFactor == 0 {
+		g.GaugeFactor = strainGaugeFactor
+	}
+	if g.Gain == 0 {
+		g.Gain = strainGain
+	}
+	if g.Bridge == "" {
+		g.Bridge = "quarter"
+	}
+	if g.Polarity == 0 {
+		g.Polarity = 1
+	}
+	if g.Young == 0 {
+		g.Young = defaultYoung
+	}
+}
+
+// Validate checks the setting
+func (g StrainGauge) Validate() error {
+	if g.Channel < 0 || g.Channel > 99 {
+		return fmt.Errorf("invalid channel: %d", g.Channel)
+	}
+	if !(g.GaugeFactor > 0) || math.IsInf(g.GaugeFactor, 0) {
+		return fmt.Errorf("channel %02d: invalid gauge factor: %f", g.Channel, g.GaugeFactor)
+	}
+	if !(g.Gain > 0) || math.IsInf(g.Gain, 0) {
+		return fmt.Errorf("channel %02d: invalid gain: %f", g.Channel, g.Gain)
+	}
+	if g.Multiplier() == 0 {
+		return fmt.Errorf("channel %02d: unknown bridge: %s", g.Channel, g.Bridge)
+	}
+	if g.Polarity != 1 && g.Polarity != -1 {
+		return fmt.Errorf("channel %02d: invalid polarity: %d", g.Channel, g.Polarity)
+	}
+	if math.IsNaN(g.Offset) || math.IsInf(g.Offset, 0) {
+		return fmt.Errorf("channel %02d: invalid offset: %f", g.Channel, g.Offset)
+	}
+	if math.IsNaN(g.Thermal) || math.IsInf(g.Thermal, 0) {
+		return fmt.Errorf("channel %02d: invalid thermal coefficient: %f", g.Channel, g.Thermal)
+	}
+	if g.Reference != "" {
+		t, err := ParseTopic(g.Reference)
+		if err != nil {
+			return fmt.Errorf("channel %02d: %s", g.Channel, err)
+		}
+		if t.Extension != "sht31" {
+			return fmt.Errorf("channel %02d: reference is not sht31: %s", g.Channel, g.Reference)
+		}
+	}
+	if !(g.Young > 0) || math.IsInf(g.Young, 0) {
+		return fmt.Errorf("channel %02d: invalid young's modulus: %f", g.Channel, g.Young)
+	}
+	if g.SNCurve != "" {
+		if _, ok := LookupSNCurve(g.SNCurve); !ok {
+			return fmt.Errorf("channel %02d: unknown sncurve: %s", g.Channel, g.SNCurve)
+		}
+	}
+	return nil
+}
+
+// Multiplier returns the ratio of strain to the output of the bridge (0 for an unknown bridge)
+// Active gauges of a half and full bridge are 2 and 4, so that the output is 2 and 4 times of a quarter bridge
+func (g StrainGauge) Multiplier() float64 {
+	switch g.Bridge {
+	case "quarter":
+		return 4.0
+	case "half":
+		return 2.0
+	case "full":
+		return 1.0
+	default:
+		return 0.0
+	}
+}
+
+// Factor returns the factor of ConvertStrain: gauge factor times gain
+func (g StrainGauge) Factor() float64 {
+	return g.GaugeFactor * g.Gain
+}
+
+// Convert converts a raw 24-bit value to strain [με]
+// HX711 measures the output ratiometrically, so that excitation voltage doesn't matter
+func (g StrainGauge) Convert(raw float64) float64 {
+	lsb := 1.0 / 128.0 / math.Pow(2.0, 24)
+	return float64(g.Polarity)*(raw*lsb*g.Multiplier()/g.Factor()*1e6) - g.Offset
+}
+
+// Stress returns uniaxial stress of strain [MPa]
+func (g StrainGauge) Stress(strain float64) float64 {
+	return g.Young * 1e-3 * strain
+}
+
+// ConvertZero converts a raw value to strain from zero point z [με]
+// Offset is not used as z gives the zero
+func (g StrainGauge) ConvertZero(raw float64, z ZeroPoint) float64 {
+	lsb := 1.0 / 128.0 / math.Pow(2.0, 24)
+	return float64(g.Polarity) * ((raw - z.Raw) * lsb * g.Multiplier() / g.Factor() * 1e6)
+}
+
+// ThermalStrain returns apparent strain at temperature from the temperature of zero point z [με]
+// It is 0 when the coefficient or either temperature is unknown
+func (g StrainGauge) ThermalStrain(temperature float64, z ZeroPoint) float64 {
+	if g.Thermal == 0 || math.IsNaN(temperature) || math.IsNaN(z.Temperature) {
+		return 0.0
+	}
+	return g.Thermal * (temperature - z.Temperature)
+}
+
+// ConvertStrain returns times and values of str01 as strain [με] of a quarter bridge when convert is true
+// factor is the gauge factor times the gain of the amplifier (103 for the default)
 func ConvertStrain(b []byte, factor float64, convert bool) ([]int64, []float64, error) {
-	var send_time, start_time int64
-	var databytes int32
+	return ConvertStrainInto(nil, nil, b, factor, convert)
+}
 
-	buf := bytes.NewReader(b[:8])
-	binary.Read(buf, binary.BigEndian, &send_time)
-	buf = bytes.NewReader(b[8:12])
-	binary.Read(buf, binary.BigEndian, &databytes)
-	buf = bytes.NewReader(b[12:20])
-	binary.Read(buf, binary.BigEndian, &start_time)
+// ConvertStrainInto is ConvertStrain which decodes into mtime and strain
+// the buffers are reused from their start and grown if necessary, so that decoding a stream of messages doesn't allocate
+func ConvertStrainInto(mtime []int64, strain []float64, b []byte, factor float64, convert bool) ([]int64, []float64, error) {
+	mtime = mtime[:0]
+	strain = strain[:0]
+	send_time, databytes, err := readHeader("str01", b)
+	if err != nil {
+		return mtime, strain, err
+	}
+	if databytes < 8 {
+		return mtime, strain, &DataSizeError{Name: "str01", Size: int(databytes)}
+	}
+	err = checkCount("str01", b, 12, databytes, 1)
+	if err != nil {
+		return mtime, strain, err
+	}
+	start_time := int64(binary.BigEndian.Uint64(b[12:20]))
 
 	datacountmod := (databytes - 8) % 4
 	if datacountmod != 0 {
-		return nil, nil, fmt.Errorf("data size error: %d", databytes)
+		return mtime, strain, &DataSizeError{Name: "str01", Size: int(databytes)}
 	}
 
 	datacount := (databytes - 8) / 4
@@ -33,12 +187,8 @@ func ConvertStrain(b []byte, factor float64, convert bool) ([]int64, []float64,
 
 	lsb := 1.0 / 128.0 / math.Pow(2.0, 24)
 
-	mtime := make([]int64, 0)
-	strain := make([]float64, 0)
-	var value int32
 	for i := 0; i < int(datacount); i++ {
-		buf = bytes.NewReader(b[20+i*4 : 20+(i+1)*4])
-		binary.Read(buf, binary.BigEndian, &value)
+		value := int32(binary.BigEndian.Uint32(b[20+i*4:]))
 		value &= 0xffffff
 		mtime = append(mtime, start_time+int64(dt*float64(i)))
 		if value > pow23 {
@@ -53,3 +203,33 @@ func ConvertStrain(b []byte, factor float64, convert bool) ([]int64, []float64,
 
 	return mtime, strain, nil
 }
+
+// EncodeStrain converts strain data to binary data (str01)
+// strain is converted back to 24-bit values with factor when convert is true, as ConvertStrain does
+func EncodeStrain(send_time, start_time int64, strain []float64, factor float64, convert bool) ([]byte, error) {
+	lsb := 1.0 / 128.0 / math.Pow(2.0, 24)
+	buf := new(bytes.Buffer)
+	buf.Grow(20 + 4*len(strain))
+	err := writeHeader(buf, send_time, int32(8+4*len(strain)))
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, start_time)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range strain {
+		if convert {
+			v = v / 1e6 * factor / 4.0 / lsb
+		}
+		r := math.Round(v)
+		if !(r > -float64(pow23) && r < float64(pow23)) {
+			return nil, fmt.Errorf("str01: value overflow: %f", v)
+		}
+		err := binary.Write(buf, binary.BigEndian, int32(r)&0xffffff)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,67 @@
+package rz2
+
+import (
+	"math"
+	"testing"
+)
+
+// testStrainPayload builds a str01 payload of size values sampled in 200 ms
+func testStrainPayload(tb testing.TB, send_time int64, size int) []byte {
+	strain := make([]float64, size)
+	for i := 0; i < size; i++ {
+		strain[i] = 100 * math.Sin(2*math.Pi*float64(i)/25.0)
+	}
+	b, err := EncodeStrain(send_time, send_time-200, strain, 103, true)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+func BenchmarkConvertStrain(b *testing.B) {
+	payload := testStrainPayload(b, goldenTime, 25)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _, err := ConvertStrain(payload, 103, true)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConvertStrainInto(b *testing.B) {
+	payload := testStrainPayload(b, goldenTime, 25)
+	mtime := make([]int64, 0, 25)
+	strain := make([]float64, 0, 25)
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	var err error
+	for i := 0; i < b.N; i++ {
+		mtime, strain, err = ConvertStrainInto(mtime, strain, payload, 103, true)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDefaultStrainGauge(t *testing.T) {
+	g := DefaultStrainGauge(1)
+	if g.GaugeFactor != 2.0 || g.Factor() != 103 {
+		t.Fatalf("gauge factor: %g, factor: %g", g.GaugeFactor, g.Factor())
+	}
+	payload := testStrainPayload(t, goldenTime, 25)
+	_, raw, err := ConvertStrain(payload, 103, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, want, err := ConvertStrain(payload, 103, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range raw {
+		if got := g.Convert(raw[i]); math.Abs(got-want[i]) > 1e-9 {
+			t.Fatalf("value %d: %g != %g", i, got, want[i])
+		}
+	}
+}
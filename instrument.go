@@ -0,0 +1,326 @@
+package rz2
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	instrumentBaud     = 9600
+	instrumentInterval = 1000 // default publish interval [ms]
+)
+
+// Instrument is a serial instrument published by a gateway given as [[instrument]] in the config
+type Instrument struct {
+	Name      string `toml:"name"`
+	Port      string `toml:"port"`      // device path (a pseudo-terminal too), or "file:path" to read lines of a file
+	VID       string `toml:"vid"`       // USB vendor ID of the port when port is empty ("0403")
+	PID       string `toml:"pid"`       // USB product ID (any if empty)
+	Baud      int    `toml:"baud"`      // default: 9600
+	Framing   string `toml:"framing"`   // end of lines: "lf" (default, CRLF too), "cr" or "etx" (ETX and 2 checksum characters)
+	Parser    string `toml:"parser"`    // gill, nmea or csv
+	Extension string `toml:"extension"` // topic extension (default: that of the parser)
+	Channel   int    `toml:"channel"`   // channel of the topic (default: 1)
+	Interval  int    `toml:"interval"`  // publish interval [ms] (default: 1000)
+	Stale     int    `toml:"stale"`     // time without valid lines until the instrument is stale [ms] (default: 5 intervals)
+	Separator string `toml:"separator"` // csv: separator of fields (default: ",")
+	Columns   []int  `toml:"columns"`   // csv: columns to publish from 0 (default: all)
+}
+
+func (in *Instrument) normalize() {
+	if in.Baud == 0 {
+		in.Baud = instrumentBaud
+	}
+	if in.Framing == "" {
+		in.Framing = "lf"
+	}
+	if in.Extension == "" {
+		if p, ok := lookupLineParser(in.Parser); ok {
+			in.Extension = p.ext
+		}
+	}
+	if in.Channel == 0 {
+		in.Channel = 1
+	}
+	if in.Interval == 0 {
+		in.Interval = instrumentInterval
+	}
+	if in.Stale == 0 {
+		in.Stale = 5 * in.Interval
+	}
+	if in.Separator == "" {
+		in.Separator = ","
+	}
+}
+
+// Validate checks the settings
+func (in Instrument) Validate() error {
+	if in.Name == "" {
+		return fmt.Errorf("instrument: no name")
+	}
+	if in.Port == "" && in.VID == "" {
+		return fmt.Errorf("instrument %s: no port or vid", in.Name)
+	}
+	if _, ok := lookupLineParser(in.Parser); !ok {
+		return fmt.Errorf("instrument %s: unknown parser: %s", in.Name, in.Parser)
+	}
+	switch in.Framing {
+	case "lf", "cr", "etx":
+	default:
+		return fmt.Errorf("instrument %s: unknown framing: %s", in.Name, in.Framing)
+	}
+	err := validateExtension(in.Extension)
+	if err != nil {
+		return fmt.Errorf("instrument %s: %s", in.Name, err)
+	}
+	if in.Channel < 0 || in.Channel > 99 {
+		return fmt.Errorf("instrument %s: invalid channel: %d", in.Name, in.Channel)
+	}
+	if in.Baud <= 0 || in.Interval <= 0 || in.Stale <= 0 {
+		return fmt.Errorf("instrument %s: invalid baud/interval/stale: %d/%d/%d", in.Name, in.Baud, in.Interval, in.Stale)
+	}
+	for _, c := range in.Columns {
+		if c < 0 {
+			return fmt.Errorf("instrument %s: invalid column: %d", in.Name, c)
+		}
+	}
+	return nil
+}
+
+// File returns the path of a file source
+func (in Instrument) File() (string, bool) {
+	if strings.HasPrefix(in.Port, "file:") {
+		return in.Port[5:], true
+	}
+	return "", false
+}
+
+// SplitFunc returns the split function of the framing for bufio.Scanner
+func (in Instrument) SplitFunc() bufio.SplitFunc {
+	switch in.Framing {
+	case "cr":
+		return splitCR
+	case "etx":
+		return splitETX
+	default:
+		return bufio.ScanLines
+	}
+}
+
+func splitCR(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\r'); i >= 0 {
+		return i + 1, bytes.TrimLeft(data[:i], "\n"), nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), bytes.TrimLeft(data, "\n"), nil
+	}
+	return 0, nil, nil
+}
+
+func splitETX(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, '\x03'); i >= 0 && len(data) >= i+3 {
+		return i + 3, bytes.TrimLeft(data[:i+3], "\r\n"), nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), bytes.TrimLeft(data, "\r\n"), nil
+	}
+	return 0, nil, nil
+}
+
+// LineParser converts lines of an instrument to payloads
+type LineParser interface {
+	// Parse parses a line received at time [ms]
+	Parse(time int64, line string) error
+	// Flush returns the payload of the interval ending at time [ms]
+	Flush(time int64) ([]byte, error)
+}
+
+type lineParser struct {
+	ext string
+	fn  func(Instrument) (LineParser, error)
+}
+
+var (
+	lineparsers     = make(map[string]lineParser)
+	lineparserslock sync.RWMutex
+)
+
+// RegisterLineParser registers fn to create LineParser of name publishing ext by default
+func RegisterLineParser(name, ext string, fn func(in Instrument) (LineParser, error)) {
+	lineparserslock.Lock()
+	defer lineparserslock.Unlock()
+	lineparsers[name] = lineParser{ext: ext, fn: fn}
+}
+
+// lookupLineParser returns the parser registered as name
+func lookupLineParser(name string) (lineParser, bool) {
+	lineparserslock.RLock()
+	defer lineparserslock.RUnlock()
+	p, ok := lineparsers[name]
+	return p, ok
+}
+
+// LineParsers returns names of registered parsers
+func LineParsers() []string {
+	lineparserslock.RLock()
+	defer lineparserslock.RUnlock()
+	rtn := make([]string, 0, len(lineparsers))
+	for name := range lineparsers {
+		rtn = append(rtn, name)
+	}
+	sort.Strings(rtn)
+	return rtn
+}
+
+// NewParser returns LineParser of the instrument
+func (in Instrument) NewParser() (LineParser, error) {
+	in.normalize()
+	err := in.Validate()
+	if err != nil {
+		return nil, err
+	}
+	p, _ := lookupLineParser(in.Parser)
+	return p.fn(in)
+}
+
+// Topic returns the topic of the instrument connected to the unit of mac
+func (in Instrument) Topic(mac string) Topic {
+	return NewTopic(mac, in.Channel, in.Extension)
+}
+
+// ConvertValues returns float64 values of a payload (csv01, gps01)
+func ConvertValues(name string, b []byte) (int64, []float64, error) {
+	send_time, data_size, err := readHeader(name, b)
+	if err != nil {
+		return 0, nil, err
+	}
+	err = checkCount(name, b, 12, data_size, 8)
+	if err != nil {
+		return 0, nil, err
+	}
+	data := make([]float64, data_size)
+	for i := range data {
+		data[i] = math.Float64frombits(binary.BigEndian.Uint64(b[12+8*i : 20+8*i]))
+	}
+	return send_time, data, nil
+}
+
+// EncodeValues converts float64 values to binary data (csv01, gps01)
+func EncodeValues(send_time int64, values []float64) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Grow(12 + 8*len(values))
+	err := writeHeader(buf, send_time, int32(len(values)))
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, values)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type gillParser struct {
+	averager *GillAverager
+}
+
+func newGillParser(in Instrument) (LineParser, error) {
+	return &gillParser{averager: NewGillAverager(int64(in.Stale))}, nil
+}
+
+func (p *gillParser) Parse(time int64, line string) error {
+	r, err := ParseGill(line)
+	if err != nil {
+		p.averager.Error()
+		return err
+	}
+	p.averager.Add(time, r)
+	return nil
+}
+
+func (p *gillParser) Flush(time int64) ([]byte, error) {
+	angle, speed, h := p.averager.Flush(time)
+	return EncodeGillHealth(time, angle, speed, h)
+}
+
+// csvParser averages numeric columns in an interval
+// The payload is the number of averaged lines followed by the means of the columns
+type csvParser struct {
+	separator string
+	columns   []int
+	stale     int64
+	last      int64
+	count     int
+	sums      []float64
+	counts    []int
+}
+
+func newCSVParser(in Instrument) (LineParser, error) {
+	return &csvParser{separator: in.Separator, columns: in.Columns, stale: int64(in.Stale), last: math.MinInt64}, nil
+}
+
+func (p *csvParser) Parse(time int64, line string) error {
+	lis := strings.Split(strings.TrimSpace(line), p.separator)
+	columns := p.columns
+	if len(columns) == 0 {
+		columns = make([]int, len(lis))
+		for i := range columns {
+			columns[i] = i
+		}
+	}
+	values := make([]float64, len(columns))
+	for i, c := range columns {
+		if c >= len(lis) {
+			return fmt.Errorf("csv: not enough fields: %q", line)
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(lis[c]), 64)
+		if err != nil {
+			return fmt.Errorf("csv: column %d: %q", c, lis[c])
+		}
+		values[i] = v
+	}
+	if p.sums == nil || len(p.sums) != len(values) {
+		p.sums = make([]float64, len(values))
+		p.counts = make([]int, len(values))
+	}
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+		p.sums[i] += v
+		p.counts[i]++
+	}
+	p.count++
+	p.last = time
+	return nil
+}
+
+func (p *csvParser) Flush(time int64) ([]byte, error) {
+	stale := p.last == math.MinInt64 || time-p.last > p.stale
+	values := make([]float64, len(p.sums)+1)
+	if !stale {
+		values[0] = float64(p.count)
+	}
+	for i := range p.sums {
+		values[i+1] = math.NaN()
+		if !stale && p.counts[i] > 0 {
+			values[i+1] = p.sums[i] / float64(p.counts[i])
+		}
+		p.sums[i], p.counts[i] = 0, 0
+	}
+	p.count = 0
+	return EncodeValues(time, values)
+}
+
+func init() {
+	RegisterLineParser("gill", "gill01", newGillParser)
+	RegisterLineParser("nmea", "gps01", newGPSParser)
+	RegisterLineParser("csv", "csv01", newCSVParser)
+}
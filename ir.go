@@ -7,6 +7,10 @@ import (
 
 func ConvertIR(b []byte) (int64, int8, error) {
 	if len(b) != 13 {
+		err := checkLength("ir01", b, 1)
+		if err != nil {
+			return 0, 0, err
+		}
 		var data int8
 		buf := bytes.NewReader(b[0:1])
 		binary.Read(buf, binary.BigEndian, &data)
@@ -20,3 +24,18 @@ func ConvertIR(b []byte) (int64, int8, error) {
 	binary.Read(buf, binary.BigEndian, &data)
 	return send_time, data, nil
 }
+
+// EncodeIR converts IR sensor data to binary data (ir01)
+func EncodeIR(send_time int64, data int8) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Grow(13)
+	err := writeHeader(buf, send_time, 1)
+	if err != nil {
+		return nil, err
+	}
+	err = binary.Write(buf, binary.BigEndian, data)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,183 @@
+package rz2
+
+import (
+	"math"
+	"sort"
+)
+
+// Cycle is a cycle counted by rainflow
+type Cycle struct {
+	Time  int64   // time of the reversal which closes the cycle [ms]
+	Range float64 // peak to valley
+	Mean  float64
+	Count float64 // 1 for a full cycle and 0.5 for a half cycle
+}
+
+type reversal struct {
+	time  int64
+	value float64
+}
+
+// Rainflow counts cycles of a history by ASTM E1049 rainflow counting
+// Samples are added one by one so that a long history needs no more memory than its residue
+type Rainflow struct {
+	gate  float64 // changes smaller than gate are not reversals
+	fn    func(Cycle)
+	stack []reversal
+	cand  reversal // candidate of the next reversal
+	dir   int      // direction from the last reversal to cand (0 if not determined)
+}
+
+// NewRainflow returns a Rainflow calling fn for each counted cycle
+// Reversals are detected with hysteresis of gate to ignore noise
+func NewRainflow(gate float64, fn func(Cycle)) *Rainflow {
+	return &Rainflow{gate: math.Abs(gate), fn: fn}
+}
+
+// Add adds a sample at time [ms]
+func (r *Rainflow) Add(time int64, value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	if len(r.stack) == 0 {
+		r.push(reversal{time, value})
+		r.cand = reversal{time, value}
+		return
+	}
+	switch r.dir {
+	case 0:
+		last := r.stack[len(r.stack)-1].value
+		if value-last > r.gate {
+			r.dir = 1
+			r.cand = reversal{time, value}
+		} else if last-value > r.gate {
+			r.dir = -1
+			r.cand = reversal{time, value}
+		}
+	case 1:
+		if value >= r.cand.value {
+			r.cand = reversal{time, value}
+		} else if r.cand.value-value > r.gate {
+			r.push(r.cand)
+			r.dir = -1
+			r.cand = reversal{time, value}
+		}
+	case -1:
+		if value <= r.cand.value {
+			r.cand = reversal{time, value}
+		} else if value-r.cand.value > r.gate {
+			r.push(r.cand)
+			r.dir = 1
+			r.cand = reversal{time, value}
+		}
+	}
+}
+
+func (r *Rainflow) count(a, b reversal, count float64, time int64) {
+	if r.fn == nil {
+		return
+	}
+	r.fn(Cycle{
+		Time:  time,
+		Range: math.Abs(a.value - b.value),
+		Mean:  0.5 * (a.value + b.value),
+		Count: count,
+	})
+}
+
+func (r *Rainflow) push(p reversal) {
+	r.stack = append(r.stack, p)
+	for {
+		n := len(r.stack)
+		if n < 3 {
+			return
+		}
+		x := math.Abs(r.stack[n-1].value - r.stack[n-2].value)
+		y := math.Abs(r.stack[n-2].value - r.stack[n-3].value)
+		if x < y {
+			return
+		}
+		if n == 3 {
+			// y contains the starting point
+			r.count(r.stack[0], r.stack[1], 0.5, p.time)
+			r.stack = append(r.stack[:0], r.stack[1:]...)
+		} else {
+			r.count(r.stack[n-3], r.stack[n-2], 1.0, p.time)
+			r.stack = append(r.stack[:n-3], r.stack[n-1])
+		}
+	}
+}
+
+// Residue returns reversals which are not counted yet
+func (r *Rainflow) Residue() []float64 {
+	rtn := make([]float64, len(r.stack))
+	for i, p := range r.stack {
+		rtn[i] = p.value
+	}
+	return rtn
+}
+
+// Finish counts the last point and ranges of the residue as half cycles
+// The Rainflow is empty after Finish
+func (r *Rainflow) Finish() {
+	if r.dir != 0 {
+		r.push(r.cand)
+	}
+	for i := 1; i < len(r.stack); i++ {
+		r.count(r.stack[i-1], r.stack[i], 0.5, r.stack[len(r.stack)-1].time)
+	}
+	r.stack = r.stack[:0]
+	r.dir = 0
+}
+
+// HistogramBin is a bin of RainflowHistogram
+type HistogramBin struct {
+	Range float64 // center of the bin
+	Mean  float64 // center of the bin
+	Count float64
+}
+
+// RainflowHistogram is the range-mean histogram of cycles
+type RainflowHistogram struct {
+	RangeBin float64
+	MeanBin  float64
+	bins     map[[2]int]float64
+}
+
+// NewRainflowHistogram returns a RainflowHistogram with bin widths of range and mean
+func NewRainflowHistogram(rangebin, meanbin float64) *RainflowHistogram {
+	return &RainflowHistogram{
+		RangeBin: rangebin,
+		MeanBin:  meanbin,
+		bins:     make(map[[2]int]float64),
+	}
+}
+
+// Add adds a cycle
+func (h *RainflowHistogram) Add(c Cycle) {
+	key := [2]int{int(math.Floor(c.Range / h.RangeBin)), int(math.Floor(c.Mean / h.MeanBin))}
+	h.bins[key] += c.Count
+}
+
+// Bins returns bins with cycles sorted by range and mean
+func (h *RainflowHistogram) Bins() []HistogramBin {
+	keys := make([][2]int, 0, len(h.bins))
+	for k := range h.bins {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	rtn := make([]HistogramBin, len(keys))
+	for i, k := range keys {
+		rtn[i] = HistogramBin{
+			Range: (float64(k[0]) + 0.5) * h.RangeBin,
+			Mean:  (float64(k[1]) + 0.5) * h.MeanBin,
+			Count: h.bins[k],
+		}
+	}
+	return rtn
+}
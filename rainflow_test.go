@@ -0,0 +1,87 @@
+package rz2
+
+import (
+	"math"
+	"testing"
+)
+
+// countRainflow returns cycle counts by range of history
+func countRainflow(gate float64, history []float64) map[float64]float64 {
+	rtn := make(map[float64]float64)
+	r := NewRainflow(gate, func(c Cycle) {
+		rtn[c.Range] += c.Count
+	})
+	for i, v := range history {
+		r.Add(int64(i), v)
+	}
+	r.Finish()
+	return rtn
+}
+
+func checkCounts(t *testing.T, name string, got, want map[float64]float64) {
+	if len(got) != len(want) {
+		t.Errorf("%s: %v, want %v", name, got, want)
+		return
+	}
+	for rng, n := range want {
+		if got[rng] != n {
+			t.Errorf("%s: range %g: %g cycles, want %g", name, rng, got[rng], n)
+		}
+	}
+}
+
+// TestRainflowE1049 is the example of rainflow counting in ASTM E1049 (Fig. 6)
+func TestRainflowE1049(t *testing.T) {
+	history := []float64{-2, 1, -3, 5, -1, 3, -4, 4, -2}
+	want := map[float64]float64{3: 0.5, 4: 1.5, 6: 0.5, 8: 1.0, 9: 0.5}
+	checkCounts(t, "E1049", countRainflow(0, history), want)
+	// samples between reversals and NaN don't change the count
+	dense := []float64{-2, -0.5, 1, math.NaN(), -3, 0, 2, 5, -1, 3, 0, -4, 4, 1, -2}
+	checkCounts(t, "E1049 dense", countRainflow(0, dense), want)
+}
+
+func TestRainflowGate(t *testing.T) {
+	history := []float64{0, 10, 9.5, 10, 0}
+	checkCounts(t, "gate 0", countRainflow(0, history), map[float64]float64{0.5: 1.0, 10: 1.0})
+	// a wiggle smaller than the gate is not a reversal
+	checkCounts(t, "gate 1", countRainflow(1, history), map[float64]float64{10: 1.0})
+	checkCounts(t, "gate -1", countRainflow(-1, history), map[float64]float64{10: 1.0})
+	r := NewRainflow(1, nil)
+	for i, v := range []float64{0, 0.5, -0.5, 0.8} {
+		r.Add(int64(i), v)
+	}
+	if res := r.Residue(); len(res) != 1 || res[0] != 0 {
+		t.Errorf("residue within the gate: %v", res)
+	}
+}
+
+// TestEC3Curve checks the knees of EN 1993-1-9 Fig. 7.1
+// The constant amplitude fatigue limit is 0.737 and the cutoff 0.405 of the detail category
+func TestEC3Curve(t *testing.T) {
+	c := EC3Curve(71)
+	if math.Abs(c.Limit/71-0.737) > 5e-4 || math.Abs(c.Cutoff/71-0.405) > 5e-4 {
+		t.Errorf("limit: %g, cutoff: %g", c.Limit, c.Cutoff)
+	}
+	for _, k := range []struct {
+		s float64
+		n float64
+	}{
+		{71, 2e6},
+		{142, 2.5e5},
+		{c.Limit, 5e6},
+		{c.Cutoff, 1e8},
+	} {
+		if n := c.Life(k.s); math.Abs(n/k.n-1) > 1e-9 {
+			t.Errorf("life at %g MPa: %g, want %g", k.s, n, k.n)
+		}
+	}
+	if !math.IsInf(c.Life(c.Cutoff*0.99), 1) || !math.IsInf(c.Life(0), 1) {
+		t.Error("finite life below the cutoff")
+	}
+	if d := c.Damage(Cycle{Range: 71, Count: 0.5}); math.Abs(d-0.25e-6) > 1e-18 {
+		t.Errorf("damage of a half cycle at the category: %g", d)
+	}
+	if got, ok := LookupSNCurve("EC3-71"); !ok || got != c {
+		t.Errorf("EC3-71: %v", got)
+	}
+}
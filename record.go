@@ -20,6 +20,57 @@ func ConvertUnixtime(unixmilli int64) time.Time {
 	return time.Unix(sec, nsec)
 }
 
+// RecordFormat is the byte order of server time and data size in a recorder file
+// A file is a sequence of [server time: 8 bytes][topic][0][data size: 4 bytes][data]
+type RecordFormat struct {
+	Time binary.ByteOrder
+	Size binary.ByteOrder
+}
+
+// Formats of recorder files by the writer
+// The readers used to take server time in little endian and data size in big endian,
+// which matches neither writer: server times of rz2rec files were byte-swapped,
+// and data sizes of Recorder files were misread
+var (
+	// RecFormat is of files of rz2rec (binary.BigEndian for both since it was written) and WriteServerRecord
+	RecFormat = RecordFormat{Time: binary.BigEndian, Size: binary.BigEndian}
+	// RecorderFormat is of files of Recorder used by gramon and rz2recall,
+	// which wrote both in the little endian of acc02 samples
+	RecorderFormat = RecordFormat{Time: binary.LittleEndian, Size: binary.LittleEndian}
+)
+
+// ParseRecordFormat returns the format of the writer name: "rz2rec" or "recorder"
+func ParseRecordFormat(name string) (RecordFormat, error) {
+	switch name {
+	case "rz2rec":
+		return RecFormat, nil
+	case "recorder":
+		return RecorderFormat, nil
+	default:
+		return RecordFormat{}, fmt.Errorf("unknown record format: %s", name)
+	}
+}
+
+// readHeader reads send_time and data_size of b
+func readHeader(name string, b []byte) (int64, int32, error) {
+	err := checkLength(name, b, 12)
+	if err != nil {
+		return 0, 0, err
+	}
+	send_time := int64(binary.BigEndian.Uint64(b[:8]))
+	data_size := int32(binary.BigEndian.Uint32(b[8:12]))
+	return send_time, data_size, nil
+}
+
+// writeHeader writes send_time and data_size of a payload
+func writeHeader(buf *bytes.Buffer, send_time int64, data_size int32) error {
+	err := binary.Write(buf, binary.BigEndian, send_time)
+	if err != nil {
+		return err
+	}
+	return binary.Write(buf, binary.BigEndian, data_size)
+}
+
 type ClientRecord struct {
 	Time int64
 	Size int32
@@ -73,6 +124,9 @@ func ReadClientRecord(fn string) ([]ClientRecord, error) {
 		binary.Read(buf, binary.BigEndian, &send_time)
 		buf = bytes.NewReader(b[8:12])
 		binary.Read(buf, binary.BigEndian, &databytes)
+		if databytes < 0 {
+			return records, &DataSizeError{Name: fn, Size: int(databytes)}
+		}
 
 		bb := make([]byte, databytes)
 		n, err = f.Read(bb)
@@ -94,13 +148,40 @@ func ReadClientRecord(fn string) ([]ClientRecord, error) {
 	}
 }
 
+// WriteClientRecord writes r in the format read by ReadClientRecord
+func WriteClientRecord(w io.Writer, r ClientRecord) error {
+	buf := new(bytes.Buffer)
+	buf.Grow(12 + len(r.Data))
+	err := binary.Write(buf, binary.BigEndian, r.Time)
+	if err != nil {
+		return err
+	}
+	err = binary.Write(buf, binary.BigEndian, int32(len(r.Data)))
+	if err != nil {
+		return err
+	}
+	buf.Write(r.Data)
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// ServerRecord is a message recorded with server time
+// Site is the site of the broker which the message came through, empty for a recorder of a single broker
+// It is recorded as the prefix of Topic (see SiteTopic), and readers split it from Topic
 type ServerRecord struct {
 	ServerTime int64
+	Site       string
 	Topic      string
 	Content    []byte
 }
 
+// ReadServerRecord reads a file of rz2rec
 func ReadServerRecord(fn string) ([]ServerRecord, error) {
+	return ReadServerRecordFormat(fn, RecFormat)
+}
+
+// ReadServerRecordFormat reads a recorder file written in format
+func ReadServerRecordFormat(fn string, format RecordFormat) ([]ServerRecord, error) {
 	f, err := os.Open(fn)
 	if err != nil {
 		return nil, err
@@ -125,9 +206,7 @@ func ReadServerRecord(fn string) ([]ServerRecord, error) {
 		if n != 8 {
 			return records, fmt.Errorf("reading current time: %d != 8", n)
 		}
-		var ct int64
-		buf := bytes.NewReader(bufct)
-		binary.Read(buf, binary.LittleEndian, &ct)
+		ct := int64(format.Time.Uint64(bufct))
 
 		// Read topic
 		btopic := make([]byte, 0)
@@ -162,9 +241,10 @@ func ReadServerRecord(fn string) ([]ServerRecord, error) {
 		if n != 4 {
 			return records, fmt.Errorf("reading data size: %d != 4", n)
 		}
-		var size int32
-		buf = bytes.NewReader(bufsize)
-		binary.Read(buf, binary.BigEndian, &size)
+		size := int32(format.Size.Uint32(bufsize))
+		if size < 0 {
+			return records, &DataSizeError{Name: topic, Size: int(size)}
+		}
 
 		// fmt.Println(ct, topic, size)
 		// Read data
@@ -189,8 +269,10 @@ func ReadServerRecord(fn string) ([]ServerRecord, error) {
 		if sk > 0 {
 			return records, fmt.Errorf("reading data: %d != %d", n, size)
 		}
+		site, topic := SplitSite(topic)
 		r := ServerRecord{
 			ServerTime: ct,
+			Site:       site,
 			Topic:      topic,
 			Content:    data,
 		}
@@ -198,7 +280,13 @@ func ReadServerRecord(fn string) ([]ServerRecord, error) {
 	}
 }
 
+// ReadServerRecordChan sends records of a file of rz2rec to c and closes c
 func ReadServerRecordChan(fn string, c chan<- ServerRecord) {
+	ReadServerRecordChanFormat(fn, RecFormat, c)
+}
+
+// ReadServerRecordChanFormat sends records of a recorder file written in format to c and closes c
+func ReadServerRecordChanFormat(fn string, format RecordFormat, c chan<- ServerRecord) {
 	f, err := os.Open(fn)
 	if err != nil {
 		close(c)
@@ -225,9 +313,7 @@ func ReadServerRecordChan(fn string, c chan<- ServerRecord) {
 			close(c)
 			return
 		}
-		var ct int64
-		buf := bytes.NewReader(bufct)
-		binary.Read(buf, binary.LittleEndian, &ct)
+		ct := int64(format.Time.Uint64(bufct))
 
 		// Read topic
 		btopic := make([]byte, 0)
@@ -262,9 +348,11 @@ func ReadServerRecordChan(fn string, c chan<- ServerRecord) {
 		if n != 4 {
 			log.Fatal(fmt.Errorf("reading data size: %d != 4", n))
 		}
-		var size int32
-		buf = bytes.NewReader(bufsize)
-		binary.Read(buf, binary.BigEndian, &size)
+		size := int32(format.Size.Uint32(bufsize))
+		if size < 0 {
+			close(c)
+			return
+		}
 
 		// Read data
 		data := make([]byte, size)
@@ -282,8 +370,10 @@ func ReadServerRecordChan(fn string, c chan<- ServerRecord) {
 		if sk > 0 {
 			log.Fatal(fmt.Errorf("reading data: %d != %d", n, size))
 		}
+		site, topic := SplitSite(topic)
 		r := ServerRecord{
 			ServerTime: ct,
+			Site:       site,
 			Topic:      topic,
 			Content:    data,
 		}
@@ -333,7 +423,7 @@ func (r *Recorder) Record(msg mqtt.Message) error {
 	buf.Grow(8 + len([]byte(msg.Topic())) + 1 + 4 + len(msg.Payload()))
 	// Current Time [ms]: 8byte
 	ct := time.Now().UnixNano() / 1000000 // ms
-	err := binary.Write(buf, endian, ct)
+	err := binary.Write(buf, RecorderFormat.Time, ct)
 	if err != nil {
 		return err
 	}
@@ -347,7 +437,7 @@ func (r *Recorder) Record(msg mqtt.Message) error {
 		return err
 	}
 	// Data size: 4byte
-	err = binary.Write(buf, endian, int32(len(msg.Payload())))
+	err = binary.Write(buf, RecorderFormat.Size, int32(len(msg.Payload())))
 	if err != nil {
 		return err
 	}
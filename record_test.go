@@ -0,0 +1,153 @@
+package rz2
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testMessage is a mqtt.Message for Recorder
+type testMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m testMessage) Duplicate() bool   { return false }
+func (m testMessage) Qos() byte         { return 0 }
+func (m testMessage) Retained() bool    { return false }
+func (m testMessage) Topic() string     { return m.topic }
+func (m testMessage) MessageID() uint16 { return 0 }
+func (m testMessage) Payload() []byte   { return m.payload }
+func (m testMessage) Ack()              {}
+
+var testRecords = []ServerRecord{
+	{Topic: "b8:27:eb:00:00:01/01/acc02", Content: []byte{1, 2, 3}},
+	{Topic: "b8:27:eb:00:00:01/01/info", Content: []byte(`{"name":"rz2"}`)},
+	{Topic: "b8:27:eb:00:00:02/02/str01", Content: []byte{0}},
+}
+
+// readAll reads fn with all of the readers in format
+func readAll(t *testing.T, fn string, format RecordFormat) map[string][]ServerRecord {
+	rtn := make(map[string][]ServerRecord)
+	records, err := ReadServerRecordFormat(fn, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtn["ReadServerRecordFormat"] = records
+	c := make(chan ServerRecord)
+	go ReadServerRecordChanFormat(fn, format, c)
+	records = nil
+	for rec := range c {
+		records = append(records, rec)
+	}
+	rtn["ReadServerRecordChanFormat"] = records
+	records = nil
+	err = ScanServerRecordFormat(fn, format, 2, nil, func(rec ServerRecord, _ interface{}) error {
+		records = append(records, rec)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rtn["ScanServerRecordFormat"] = records
+	return rtn
+}
+
+func checkRecords(t *testing.T, name string, got []ServerRecord, start, end int64) {
+	if len(got) != len(testRecords) {
+		t.Fatalf("%s: %d records, want %d", name, len(got), len(testRecords))
+	}
+	for i, rec := range got {
+		want := testRecords[i]
+		if rec.Topic != want.Topic || !bytes.Equal(rec.Content, want.Content) {
+			t.Errorf("%s: record %d: %s %v, want %s %v", name, i, rec.Topic, rec.Content, want.Topic, want.Content)
+		}
+		if rec.ServerTime < start || rec.ServerTime > end {
+			t.Errorf("%s: record %d: server time %d not in [%d, %d]", name, i, rec.ServerTime, start, end)
+		}
+	}
+}
+
+func TestRecFormat(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "rz2rec.dat")
+	w := new(bytes.Buffer)
+	for i, rec := range testRecords {
+		rec.ServerTime = goldenTime + int64(i)
+		err := WriteServerRecord(w, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := ioutil.WriteFile(fn, w.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, records := range readAll(t, fn, RecFormat) {
+		checkRecords(t, name, records, goldenTime, goldenTime+2)
+	}
+	records, err := ReadServerRecord(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRecords(t, "ReadServerRecord", records, goldenTime, goldenTime+2)
+}
+
+func TestRecordSite(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "site.dat")
+	w := new(bytes.Buffer)
+	for i, rec := range testRecords {
+		rec.ServerTime = goldenTime + int64(i)
+		rec.Site = "site1"
+		err := WriteServerRecord(w, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := ioutil.WriteFile(fn, w.Bytes(), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, records := range readAll(t, fn, RecFormat) {
+		checkRecords(t, name, records, goldenTime, goldenTime+2)
+		for i, rec := range records {
+			if rec.Site != "site1" {
+				t.Errorf("%s: record %d: site %q", name, i, rec.Site)
+			}
+		}
+	}
+	if site, topic := SplitSite(testRecords[0].Topic); site != "" || topic != testRecords[0].Topic {
+		t.Errorf("site %q of a topic without site", site)
+	}
+}
+
+func TestRecorderFormat(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "recorder.dat")
+	f, err := os.Create(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRecorder(f)
+	start := time.Now().UnixNano() / 1000000
+	for _, rec := range testRecords {
+		err := r.Record(testMessage{topic: rec.Topic, payload: rec.Content})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	end := time.Now().UnixNano() / 1000000
+	err = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, records := range readAll(t, fn, RecorderFormat) {
+		checkRecords(t, name, records, start, end)
+	}
+	// sizes in little endian are too large in RecFormat
+	_, err = ReadServerRecord(fn)
+	if err == nil {
+		t.Errorf("files of Recorder are read in RecFormat")
+	}
+}
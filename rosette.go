@@ -0,0 +1,192 @@
+package rz2
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	rosetteTolerance = 500  // samples of the elements within rosetteTolerance are regarded as simultaneous [ms]
+	rosetteQueue     = 4096 // samples waiting for the other elements are discarded beyond rosetteQueue
+	defaultYoung     = 205.0
+	defaultPoisson   = 0.3
+)
+
+// Rosette is a 3-element strain rosette given as [[device.rosette]] in the config
+type Rosette struct {
+	Name     string  `toml:"name"`
+	Type     string  `toml:"type"`     // "rectangular" (0/45/90) or "delta" (0/60/120)
+	Channels [3]int  `toml:"channels"` // str01 channels of the elements in the order of angle
+	Young    float64 `toml:"young"`    // Young's modulus [GPa]
+	Poisson  float64 `toml:"poisson"`  // Poisson ratio
+}
+
+func (r *Rosette) normalize() {
+	if r.Type == "" {
+		r.Type = "rectangular"
+	}
+	if r.Channels == [3]int{} {
+		r.Channels = [3]int{1, 2, 3}
+	}
+	if r.Young == 0 {
+		r.Young = defaultYoung
+	}
+	if r.Poisson == 0 {
+		r.Poisson = defaultPoisson
+	}
+	if r.Name == "" {
+		r.Name = fmt.Sprintf("%02d-%02d-%02d", r.Channels[0], r.Channels[1], r.Channels[2])
+	}
+}
+
+// Angles returns the angles of the elements [deg]
+func (r Rosette) Angles() [3]float64 {
+	switch r.Type {
+	case "rectangular":
+		return [3]float64{0, 45, 90}
+	case "delta":
+		return [3]float64{0, 60, 120}
+	default:
+		return [3]float64{}
+	}
+}
+
+// Validate checks the setting
+func (r Rosette) Validate() error {
+	if r.Angles() == [3]float64{} {
+		return fmt.Errorf("rosette %s: unknown type: %s", r.Name, r.Type)
+	}
+	for i, ch := range r.Channels {
+		if ch < 0 || ch > 99 {
+			return fmt.Errorf("rosette %s: invalid channel: %d", r.Name, ch)
+		}
+		for _, ch2 := range r.Channels[:i] {
+			if ch == ch2 {
+				return fmt.Errorf("rosette %s: duplicated channel: %02d", r.Name, ch)
+			}
+		}
+	}
+	if !(r.Young > 0) || math.IsInf(r.Young, 0) {
+		return fmt.Errorf("rosette %s: invalid young's modulus: %f", r.Name, r.Young)
+	}
+	if !(r.Poisson >= 0 && r.Poisson < 0.5) {
+		return fmt.Errorf("rosette %s: invalid poisson ratio: %f", r.Name, r.Poisson)
+	}
+	return nil
+}
+
+// Element returns the index of the element measured by channel (-1 if none)
+func (r Rosette) Element(channel int) int {
+	for i, ch := range r.Channels {
+		if ch == channel {
+			return i
+		}
+	}
+	return -1
+}
+
+// RosetteResult is principal strains and stresses of a rosette
+type RosetteResult struct {
+	Time     int64   // [ms]
+	Max      float64 // maximum principal strain [με]
+	Min      float64 // minimum principal strain [με]
+	Angle    float64 // angle of the maximum principal strain from the first element, counterclockwise [deg]
+	Shear    float64 // maximum shear strain [με]
+	Stress1  float64 // maximum principal stress [MPa]
+	Stress2  float64 // minimum principal stress [MPa]
+	VonMises float64 // von Mises stress [MPa]
+}
+
+// Compute returns principal strains and stresses (plane stress) from strains of the elements [με]
+func (r Rosette) Compute(e [3]float64) RosetteResult {
+	// e_i = (ex+ey)/2 + (ex-ey)/2*cos(2θ_i) + γxy/2*sin(2θ_i)
+	var m [3][3]float64
+	for i, a := range r.Angles() {
+		th := 2.0 * a * math.Pi / 180.0
+		m[i] = [3]float64{1.0, math.Cos(th), math.Sin(th)}
+	}
+	inv, _ := inv3(m)
+	var c [3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			c[i] += inv[i][j] * e[j]
+		}
+	}
+	// c = ((ex+ey)/2, (ex-ey)/2, γxy/2)
+	radius := math.Hypot(c[1], c[2])
+	rtn := RosetteResult{
+		Max:   c[0] + radius,
+		Min:   c[0] - radius,
+		Angle: 0.5 * math.Atan2(c[2], c[1]) * 180.0 / math.Pi,
+		Shear: 2.0 * radius,
+	}
+	// [GPa]*[με] = 1e-3 [MPa]
+	k := r.Young * 1e-3 / (1.0 - r.Poisson*r.Poisson)
+	rtn.Stress1 = k * (rtn.Max + r.Poisson*rtn.Min)
+	rtn.Stress2 = k * (rtn.Min + r.Poisson*rtn.Max)
+	rtn.VonMises = math.Sqrt(rtn.Stress1*rtn.Stress1 - rtn.Stress1*rtn.Stress2 + rtn.Stress2*rtn.Stress2)
+	return rtn
+}
+
+type rosetteSample struct {
+	time   int64
+	strain float64
+}
+
+// RosetteStream combines samples of the elements sent in separate str01 messages
+type RosetteStream struct {
+	Rosette Rosette
+	queue   [3][]rosetteSample
+}
+
+// NewRosetteStream returns a RosetteStream of r
+func NewRosetteStream(r Rosette) *RosetteStream {
+	return &RosetteStream{Rosette: r}
+}
+
+// Add adds a decoded str01 message of channel
+// It returns results of samples of which all the elements have arrived
+func (s *RosetteStream) Add(channel int, se *Series) []RosetteResult {
+	ind := s.Rosette.Element(channel)
+	if ind < 0 {
+		return nil
+	}
+	col := se.Channel("strain")
+	if col < 0 {
+		col = 0
+	}
+	for _, smp := range se.Samples {
+		s.queue[ind] = append(s.queue[ind], rosetteSample{smp.Time, smp.Values[col]})
+	}
+	if n := len(s.queue[ind]); n > rosetteQueue {
+		s.queue[ind] = append(s.queue[ind][:0], s.queue[ind][n-rosetteQueue:]...)
+	}
+	var rtn []RosetteResult
+	for len(s.queue[0]) > 0 && len(s.queue[1]) > 0 && len(s.queue[2]) > 0 {
+		first, last := 0, 0
+		for i := 1; i < 3; i++ {
+			if s.queue[i][0].time < s.queue[first][0].time {
+				first = i
+			}
+			if s.queue[i][0].time > s.queue[last][0].time {
+				last = i
+			}
+		}
+		if s.queue[last][0].time-s.queue[first][0].time > rosetteTolerance {
+			// the element of the oldest sample has missed its partners
+			s.queue[first] = s.queue[first][1:]
+			continue
+		}
+		var e [3]float64
+		for i := 0; i < 3; i++ {
+			e[i] = s.queue[i][0].strain
+		}
+		res := s.Rosette.Compute(e)
+		res.Time = s.queue[0][0].time
+		rtn = append(rtn, res)
+		for i := 0; i < 3; i++ {
+			s.queue[i] = s.queue[i][1:]
+		}
+	}
+	return rtn
+}
@@ -0,0 +1,49 @@
+package rz2
+
+import (
+	"math"
+	"testing"
+)
+
+func checkRosette(t *testing.T, name string, got RosetteResult, max, min, angle float64) {
+	if math.Abs(got.Max-max) > 1e-9 || math.Abs(got.Min-min) > 1e-9 || math.Abs(got.Angle-angle) > 1e-9 {
+		t.Errorf("%s: %g, %g, %g deg, want %g, %g, %g deg", name, got.Max, got.Min, got.Angle, max, min, angle)
+	}
+	if math.Abs(got.Shear-(max-min)) > 1e-9 {
+		t.Errorf("%s: shear %g, want %g", name, got.Shear, max-min)
+	}
+}
+
+func TestRosetteRectangular(t *testing.T) {
+	r := Rosette{Type: "rectangular"}
+	r.normalize()
+	for _, e := range [][3]float64{{1000, 600, -200}, {-300, 200, 500}, {100, -400, 100}} {
+		center := 0.5 * (e[0] + e[2])
+		radius := math.Sqrt((e[0]-e[1])*(e[0]-e[1])+(e[1]-e[2])*(e[1]-e[2])) / math.Sqrt2
+		angle := 0.5 * math.Atan2(2*e[1]-e[0]-e[2], e[0]-e[2]) * 180.0 / math.Pi
+		checkRosette(t, "rectangular", r.Compute(e), center+radius, center-radius, angle)
+	}
+}
+
+func TestRosetteDelta(t *testing.T) {
+	r := Rosette{Type: "delta"}
+	r.normalize()
+	for _, e := range [][3]float64{{1000, 600, -200}, {-300, 200, 500}, {100, -400, 100}} {
+		center := (e[0] + e[1] + e[2]) / 3.0
+		radius := math.Sqrt2 / 3.0 * math.Sqrt((e[0]-e[1])*(e[0]-e[1])+(e[1]-e[2])*(e[1]-e[2])+(e[2]-e[0])*(e[2]-e[0]))
+		angle := 0.5 * math.Atan2(math.Sqrt(3)*(e[1]-e[2]), 2*e[0]-e[1]-e[2]) * 180.0 / math.Pi
+		checkRosette(t, "delta", r.Compute(e), center+radius, center-radius, angle)
+	}
+}
+
+// uniaxial stress along the first element gives the stress itself
+func TestRosetteUniaxial(t *testing.T) {
+	r := Rosette{Type: "rectangular"}
+	r.normalize()
+	ex := 100.0 / r.Young * 1e3
+	ey := -r.Poisson * ex
+	res := r.Compute([3]float64{ex, 0.5 * (ex + ey), ey})
+	if math.Abs(res.Stress1-100) > 1e-9 || math.Abs(res.Stress2) > 1e-9 || math.Abs(res.VonMises-100) > 1e-9 {
+		t.Errorf("stress: %g, %g, von mises: %g", res.Stress1, res.Stress2, res.VonMises)
+	}
+}
@@ -0,0 +1,180 @@
+package rz2
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+const scanChunk = 1024 // records per job
+
+// recordSpan is the position of a record in a mapped file
+type recordSpan struct {
+	start int // start of the record
+	topic int // end of topic (position of NUL)
+	data  int // start of data
+	end   int // end of data
+}
+
+// nextRecord finds the record starting at ind
+// ok is false at the end of b or when the record is truncated
+func nextRecord(b []byte, ind int, format RecordFormat) (span recordSpan, ok bool, err error) {
+	if ind >= len(b) {
+		return recordSpan{}, false, nil
+	}
+	if ind+8 > len(b) {
+		return recordSpan{}, false, fmt.Errorf("reading current time: %d != 8", len(b)-ind)
+	}
+	nul := bytes.IndexByte(b[ind+8:], 0)
+	if nul < 0 {
+		// same as ReadServerRecord which stops at EOF while reading topic
+		return recordSpan{}, false, nil
+	}
+	topic := ind + 8 + nul
+	if topic+5 > len(b) {
+		return recordSpan{}, false, fmt.Errorf("reading data size: %d != 4", len(b)-topic-1)
+	}
+	size := int(int32(format.Size.Uint32(b[topic+1 : topic+5])))
+	if size < 0 {
+		return recordSpan{}, false, &DataSizeError{Name: string(b[ind+8 : topic]), Size: size}
+	}
+	data := topic + 5
+	if data+size > len(b) {
+		return recordSpan{}, false, fmt.Errorf("reading data: %d != %d", len(b)-data, size)
+	}
+	return recordSpan{start: ind, topic: topic, data: data, end: data + size}, true, nil
+}
+
+// decodeRecord copies a record out of mapped memory
+func decodeRecord(b []byte, s recordSpan, format RecordFormat) ServerRecord {
+	content := make([]byte, s.end-s.data)
+	copy(content, b[s.data:s.end])
+	site, topic := SplitSite(string(b[s.start+8 : s.topic]))
+	return ServerRecord{
+		ServerTime: int64(format.Time.Uint64(b[s.start : s.start+8])),
+		Site:       site,
+		Topic:      topic,
+		Content:    content,
+	}
+}
+
+type scanJob struct {
+	spans   []recordSpan
+	records []ServerRecord
+	values  []interface{}
+	err     error
+	done    chan struct{}
+}
+
+// ScanServerRecord maps fn into memory and decodes its records with workers goroutines
+// decode is called in parallel and may be nil; out is called in file order with the record and the value returned by decode
+// workers <= 0 means runtime.NumCPU()
+func ScanServerRecord(fn string, workers int, decode func(ServerRecord) (interface{}, error), out func(ServerRecord, interface{}) error) error {
+	return ScanServerRecordFormat(fn, RecFormat, workers, decode, out)
+}
+
+// ScanServerRecordFormat is ScanServerRecord of a recorder file written in format
+func ScanServerRecordFormat(fn string, format RecordFormat, workers int, decode func(ServerRecord) (interface{}, error), out func(ServerRecord, interface{}) error) error {
+	b, unmap, err := mmapFile(fn)
+	if err != nil {
+		return err
+	}
+	defer unmap()
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	jobs := make(chan *scanJob, workers)
+	ordered := make(chan *scanJob, 2*workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				job.records = make([]ServerRecord, len(job.spans))
+				job.values = make([]interface{}, len(job.spans))
+				for j, s := range job.spans {
+					job.records[j] = decodeRecord(b, s, format)
+					if decode != nil && job.err == nil {
+						job.values[j], job.err = decode(job.records[j])
+					}
+				}
+				close(job.done)
+			}
+		}()
+	}
+
+	// find record boundaries sequentially and hand them to workers
+	var scanerr error
+	stop := make(chan struct{})
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		ind := 0
+		for {
+			spans := make([]recordSpan, 0, scanChunk)
+			for len(spans) < scanChunk {
+				s, ok, err := nextRecord(b, ind, format)
+				if err != nil {
+					scanerr = fmt.Errorf("offset %d: %s", ind, err)
+				}
+				if !ok {
+					break
+				}
+				spans = append(spans, s)
+				ind = s.end
+			}
+			if len(spans) == 0 {
+				return
+			}
+			job := &scanJob{spans: spans, done: make(chan struct{})}
+			select {
+			case ordered <- job:
+			case <-stop:
+				return
+			}
+			jobs <- job
+			if len(spans) < scanChunk {
+				return
+			}
+		}
+	}()
+
+	var rtnerr error
+	for job := range ordered {
+		if rtnerr != nil {
+			continue
+		}
+		<-job.done
+		if job.err != nil {
+			rtnerr = job.err
+			close(stop)
+			continue
+		}
+		for j, rec := range job.records {
+			err := out(rec, job.values[j])
+			if err != nil {
+				rtnerr = err
+				close(stop)
+				break
+			}
+		}
+	}
+	wg.Wait()
+	if rtnerr != nil {
+		return rtnerr
+	}
+	return scanerr
+}
+
+// ReadServerRecordParallel returns the same records as ReadServerRecord using ScanServerRecord
+func ReadServerRecordParallel(fn string) ([]ServerRecord, error) {
+	records := make([]ServerRecord, 0)
+	err := ScanServerRecord(fn, 0, nil, func(rec ServerRecord, _ interface{}) error {
+		records = append(records, rec)
+		return nil
+	})
+	return records, err
+}
@@ -0,0 +1,139 @@
+package rz2
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// benchSize returns the size of the file of the benchmarks [MB]
+// It is 16 by default; set RZ2_BENCH_MB=1024 for the comparison on a 1 GB file:
+//
+//	RZ2_BENCH_MB=1024 go test -run NONE -bench ServerRecord -benchtime 3x
+func benchSize(b *testing.B) int {
+	env := os.Getenv("RZ2_BENCH_MB")
+	if env == "" {
+		return 16
+	}
+	mb, err := strconv.Atoi(env)
+	if err != nil || mb <= 0 {
+		b.Fatalf("invalid RZ2_BENCH_MB: %s", env)
+	}
+	return mb
+}
+
+// testAccPayload builds an acc02 payload of size samples of 3 directions
+func testAccPayload(tb testing.TB, send_time int64, size int, n int) []byte {
+	acc := make([]float64, size)
+	for i := 0; i < size; i++ {
+		t := float64(n+i/3) / 125.0
+		acc[i] = 1000 * math.Sin(2*math.Pi*t+float64(i%3)) * 980.665 / 256000.0
+	}
+	b, err := EncodeAccPacket(send_time, acc, 0)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return b
+}
+
+// testRecordFile writes about mb megabytes of acc02 records of 8 devices and returns the file name and its size
+func testRecordFile(tb testing.TB, dir string, mb int) (string, int64) {
+	fn := filepath.Join(dir, "bench.dat")
+	f, err := os.Create(fn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	t0 := int64(1600000000000)
+	written := 0
+	n := 0
+	for written < mb<<20 {
+		for d := 0; d < 8; d++ {
+			topic := fmt.Sprintf("b8:27:eb:00:00:%02x/01/acc02", d)
+			payload := testAccPayload(tb, t0+int64(n)*8, 75, n)
+			err := WriteServerRecord(w, ServerRecord{ServerTime: t0 + int64(n)*8, Topic: topic, Content: payload})
+			if err != nil {
+				tb.Fatal(err)
+			}
+			written += 8 + len(topic) + 1 + 4 + len(payload)
+		}
+		n += 25
+	}
+	err = w.Flush()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return fn, int64(written)
+}
+
+func decodeTestAcc(rec ServerRecord) (interface{}, error) {
+	_, acc, _, err := ConvertAccPacketWithTime(rec.Content)
+	return len(acc), err
+}
+
+func TestReadServerRecordParallel(t *testing.T) {
+	fn, _ := testRecordFile(t, t.TempDir(), 1)
+	want, err := ReadServerRecord(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadServerRecordParallel(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("records: %d != %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ServerTime != want[i].ServerTime || got[i].Topic != want[i].Topic || string(got[i].Content) != string(want[i].Content) {
+			t.Fatalf("record %d: %v != %v", i, got[i], want[i])
+		}
+	}
+}
+
+// BenchmarkReadServerRecord is the sequential baseline of BenchmarkScanServerRecord
+func BenchmarkReadServerRecord(b *testing.B) {
+	fn, size := testRecordFile(b, b.TempDir(), benchSize(b))
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		records, err := ReadServerRecord(fn)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, rec := range records {
+			_, err := decodeTestAcc(rec)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkScanServerRecord(b *testing.B) {
+	fn, size := testRecordFile(b, b.TempDir(), benchSize(b))
+	for _, workers := range []int{1, 0} {
+		name := fmt.Sprintf("workers=%d", workers)
+		if workers == 0 {
+			name = "workers=NumCPU"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(size)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				err := ScanServerRecord(fn, workers, decodeTestAcc, func(ServerRecord, interface{}) error {
+					return nil
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -3,24 +3,29 @@ package rz2
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"math"
 )
 
 func ConvertSht(b []byte) (int64, []float64, []float64, error) {
-	// if len(b) != 13 {
-	// 	return 0, nil, fmt.Errorf("invalid data: %d", len(b))
-	// }
-	var send_time int64
-	var data_size int32
-	buf := bytes.NewReader(b[:8])
-	binary.Read(buf, binary.BigEndian, &send_time)
-	buf = bytes.NewReader(b[8:12])
-	binary.Read(buf, binary.BigEndian, &data_size)
+	send_time, data_size, err := readHeader("sht31", b)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	// temperature and humidity in turn
+	if data_size%2 != 0 {
+		return 0, nil, nil, &DataSizeError{Name: "sht31", Size: int(data_size)}
+	}
+	err = checkCount("sht31", b, 12, data_size, 4)
+	if err != nil {
+		return 0, nil, nil, err
+	}
 	tmp_data := make([]float64, data_size/2)
 	hum_data := make([]float64, data_size/2)
 	var d float32
 	tmp := true
 	for i := 0; i < int(data_size); i++ {
-		buf = bytes.NewReader(b[12+4*i:12+4*i+4])
+		buf := bytes.NewReader(b[12+4*i:12+4*i+4])
 		binary.Read(buf, binary.BigEndian, &d)
 		if tmp {
 			tmp_data[i/2] = float64(d)
@@ -32,3 +37,214 @@ func ConvertSht(b []byte) (int64, []float64, []float64, error) {
 	return send_time, tmp_data, hum_data, nil
 }
 
+// EncodeSht converts temperature and humidity data to binary data (sht31)
+func EncodeSht(send_time int64, tmp_data, hum_data []float64) ([]byte, error) {
+	if len(tmp_data) != len(hum_data) {
+		return nil, fmt.Errorf("sht31: data size mismatch: %d != %d", len(tmp_data), len(hum_data))
+	}
+	buf := new(bytes.Buffer)
+	buf.Grow(12 + 8*len(tmp_data))
+	err := writeHeader(buf, send_time, int32(2*len(tmp_data)))
+	if err != nil {
+		return nil, err
+	}
+	for i := range tmp_data {
+		err := binary.Write(buf, binary.BigEndian, []float32{float32(tmp_data[i]), float32(hum_data[i])})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Climate is temperature and humidity with quantities derived from them
+type Climate struct {
+	Temperature      float64 // ['C]
+	Humidity         float64 // relative humidity [%]
+	DewPoint         float64 // ['C]
+	AbsoluteHumidity float64 // [g/m³]
+	HeatIndex        float64 // ['C]
+	WBGT             float64 // indoor estimate without solar radiation ['C]
+}
+
+// NewClimate returns Climate of temperature ['C] and relative humidity [%]
+func NewClimate(temperature, humidity float64) Climate {
+	return Climate{
+		Temperature:      temperature,
+		Humidity:         humidity,
+		DewPoint:         DewPoint(temperature, humidity),
+		AbsoluteHumidity: AbsoluteHumidity(temperature, humidity),
+		HeatIndex:        HeatIndex(temperature, humidity),
+		WBGT:             WBGTIndoor(temperature, humidity),
+	}
+}
+
+// saturation vapour pressure by the Magnus formula [hPa]
+func saturationPressure(temperature float64) float64 {
+	return 6.112 * math.Exp(17.62*temperature/(243.12+temperature))
+}
+
+// DewPoint returns dew point temperature by the Magnus formula ['C]
+func DewPoint(temperature, humidity float64) float64 {
+	if !(humidity > 0) {
+		return math.NaN()
+	}
+	g := math.Log(humidity/100.0) + 17.62*temperature/(243.12+temperature)
+	return 243.12 * g / (17.62 - g)
+}
+
+// AbsoluteHumidity returns mass of water vapour per volume [g/m³]
+func AbsoluteHumidity(temperature, humidity float64) float64 {
+	return 216.7 * humidity / 100.0 * saturationPressure(temperature) / (273.15 + temperature)
+}
+
+// RelativeHumidity returns relative humidity at temperature of air whose dew point is dewpoint [%]
+func RelativeHumidity(temperature, dewpoint float64) float64 {
+	return 100.0 * saturationPressure(dewpoint) / saturationPressure(temperature)
+}
+
+// HeatIndex returns the heat index of the US National Weather Service ['C]
+func HeatIndex(temperature, humidity float64) float64 {
+	t := temperature*9.0/5.0 + 32.0
+	rh := humidity
+	hi := 0.5 * (t + 61.0 + (t-68.0)*1.2 + rh*0.094)
+	if (hi+t)/2.0 >= 80.0 {
+		hi = -42.379 + 2.04901523*t + 10.14333127*rh - 0.22475541*t*rh - 0.00683783*t*t - 0.05481717*rh*rh +
+			0.00122874*t*t*rh + 0.00085282*t*rh*rh - 0.00000199*t*t*rh*rh
+		if rh < 13.0 && t >= 80.0 && t <= 112.0 {
+			hi -= (13.0 - rh) / 4.0 * math.Sqrt((17.0-math.Abs(t-95.0))/17.0)
+		} else if rh > 85.0 && t >= 80.0 && t <= 87.0 {
+			hi += (rh - 85.0) / 10.0 * (87.0 - t) / 5.0
+		}
+	}
+	return (hi - 32.0) * 5.0 / 9.0
+}
+
+// WetBulb returns wet-bulb temperature by the formula of Stull (2011) ['C]
+// It is valid for humidity of 5-99 % and temperature of -20-50 'C
+func WetBulb(temperature, humidity float64) float64 {
+	t, rh := temperature, humidity
+	return t*math.Atan(0.151977*math.Sqrt(rh+8.313659)) + math.Atan(t+rh) - math.Atan(rh-1.676331) +
+		0.00391838*math.Pow(rh, 1.5)*math.Atan(0.023101*rh) - 4.686035
+}
+
+// WBGTIndoor returns WBGT estimated from temperature and humidity ['C]
+// Natural wet-bulb is regarded as wet-bulb and globe temperature as air temperature
+func WBGTIndoor(temperature, humidity float64) float64 {
+	return 0.7*WetBulb(temperature, humidity) + 0.3*temperature
+}
+
+// ClimateAlert is thresholds of alerts given as [device.climate] in the config
+// Thresholds which are not given (0) are those of Profile and NaN disables the check
+type ClimateAlert struct {
+	Profile        string  `toml:"profile"`        // "datacenter", "heritage" or "" (condensation, mould and heat only)
+	MinTemperature float64 `toml:"mintemperature"` // ['C]
+	MaxTemperature float64 `toml:"maxtemperature"` // ['C]
+	MinHumidity    float64 `toml:"minhumidity"`    // [%]
+	MaxHumidity    float64 `toml:"maxhumidity"`    // [%]
+	MinDewPoint    float64 `toml:"mindewpoint"`    // ['C]
+	MaxDewPoint    float64 `toml:"maxdewpoint"`    // ['C]
+	Surface        float64 `toml:"surface"`        // surface temperature minus air temperature of the coldest surface ['C]
+	Margin         float64 `toml:"margin"`         // condensation risk when the surface is less than margin above the dew point ['C]
+	Mould          float64 `toml:"mould"`          // mould risk above relative humidity at the surface [%]
+	MaxWBGT        float64 `toml:"maxwbgt"`        // ['C]
+	MaxHeatIndex   float64 `toml:"maxheatindex"`   // ['C]
+}
+
+// climateProfiles are thresholds of profiles
+// datacenter: ASHRAE recommended envelope, heritage: stable conditions for collections
+var climateProfiles = map[string]ClimateAlert{
+	"": {
+		MinTemperature: math.NaN(), MaxTemperature: math.NaN(),
+		MinHumidity: math.NaN(), MaxHumidity: math.NaN(),
+		MinDewPoint: math.NaN(), MaxDewPoint: math.NaN(),
+		Margin: 2.0, Mould: 80.0, MaxWBGT: 28.0, MaxHeatIndex: 32.0,
+	},
+	"datacenter": {
+		MinTemperature: 18.0, MaxTemperature: 27.0,
+		MinHumidity: 8.0, MaxHumidity: 60.0,
+		MinDewPoint: -9.0, MaxDewPoint: 15.0,
+		Margin: 2.0, Mould: 80.0, MaxWBGT: 28.0, MaxHeatIndex: 32.0,
+	},
+	"heritage": {
+		MinTemperature: 15.0, MaxTemperature: 25.0,
+		MinHumidity: 40.0, MaxHumidity: 60.0,
+		MinDewPoint: math.NaN(), MaxDewPoint: math.NaN(),
+		Margin: 3.0, Mould: 70.0, MaxWBGT: 28.0, MaxHeatIndex: 32.0,
+	},
+}
+
+// DefaultClimateAlert returns thresholds used when a device isn't configured
+func DefaultClimateAlert() ClimateAlert {
+	a := ClimateAlert{}
+	a.normalize()
+	return a
+}
+
+func (a *ClimateAlert) normalize() {
+	p, ok := climateProfiles[a.Profile]
+	if !ok {
+		return
+	}
+	for _, f := range []struct {
+		v *float64
+		p float64
+	}{
+		{&a.MinTemperature, p.MinTemperature},
+		{&a.MaxTemperature, p.MaxTemperature},
+		{&a.MinHumidity, p.MinHumidity},
+		{&a.MaxHumidity, p.MaxHumidity},
+		{&a.MinDewPoint, p.MinDewPoint},
+		{&a.MaxDewPoint, p.MaxDewPoint},
+		{&a.Margin, p.Margin},
+		{&a.Mould, p.Mould},
+		{&a.MaxWBGT, p.MaxWBGT},
+		{&a.MaxHeatIndex, p.MaxHeatIndex},
+	} {
+		if *f.v == 0 {
+			*f.v = f.p
+		}
+	}
+}
+
+// Validate checks the thresholds
+func (a ClimateAlert) Validate() error {
+	if _, ok := climateProfiles[a.Profile]; !ok {
+		return fmt.Errorf("climate: unknown profile: %s", a.Profile)
+	}
+	for _, r := range [][2]float64{
+		{a.MinTemperature, a.MaxTemperature},
+		{a.MinHumidity, a.MaxHumidity},
+		{a.MinDewPoint, a.MaxDewPoint},
+	} {
+		if r[0] > r[1] {
+			return fmt.Errorf("climate: min is larger than max: %g > %g", r[0], r[1])
+		}
+	}
+	if math.IsNaN(a.Surface) || math.IsInf(a.Surface, 0) {
+		return fmt.Errorf("climate: invalid surface: %g", a.Surface)
+	}
+	return nil
+}
+
+// Check returns names of the alerts raised by c
+// NaN thresholds are skipped as comparisons with NaN are false
+func (a ClimateAlert) Check(c Climate) []string {
+	rtn := make([]string, 0)
+	add := func(cond bool, name string) {
+		if cond {
+			rtn = append(rtn, name)
+		}
+	}
+	add(c.Temperature < a.MinTemperature, "cold")
+	add(c.Temperature > a.MaxTemperature, "hot")
+	add(c.Humidity < a.MinHumidity, "dry")
+	add(c.Humidity > a.MaxHumidity, "humid")
+	add(c.DewPoint < a.MinDewPoint || c.DewPoint > a.MaxDewPoint, "dewpoint")
+	surface := c.Temperature + a.Surface
+	add(surface-c.DewPoint < a.Margin, "condensation")
+	add(RelativeHumidity(surface, c.DewPoint) > a.Mould, "mould")
+	add(c.WBGT > a.MaxWBGT, "wbgt")
+	add(c.HeatIndex > a.MaxHeatIndex, "heatindex")
+	return rtn
+}
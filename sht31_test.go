@@ -0,0 +1,57 @@
+package rz2
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDewPoint(t *testing.T) {
+	for _, c := range []struct {
+		temperature, humidity, dewpoint float64
+	}{
+		{25, 60, 16.7},
+		{20, 50, 9.3},
+		{30, 80, 26.2},
+	} {
+		if got := DewPoint(c.temperature, c.humidity); math.Abs(got-c.dewpoint) > 0.05 {
+			t.Errorf("dew point at %g 'C, %g %%: %.2f, want %g", c.temperature, c.humidity, got, c.dewpoint)
+		}
+		if got := RelativeHumidity(c.temperature, DewPoint(c.temperature, c.humidity)); math.Abs(got-c.humidity) > 1e-9 {
+			t.Errorf("humidity at %g 'C: %g, want %g", c.temperature, got, c.humidity)
+		}
+	}
+	if got := DewPoint(20, 100); math.Abs(got-20) > 1e-9 {
+		t.Errorf("dew point of saturated air: %g", got)
+	}
+	if !math.IsNaN(DewPoint(20, 0)) {
+		t.Error("dew point of dry air")
+	}
+}
+
+// TestHeatIndex checks values of the heat index chart of the US National Weather Service [F]
+func TestHeatIndex(t *testing.T) {
+	for _, c := range []struct {
+		temperature, humidity, heatindex float64
+	}{
+		{80, 40, 80},
+		{90, 60, 100},
+		{90, 70, 106},
+		{86, 90, 105},
+		{100, 40, 109},
+	} {
+		got := HeatIndex((c.temperature-32.0)*5.0/9.0, c.humidity)*9.0/5.0 + 32.0
+		if math.Abs(got-c.heatindex) > 0.5 {
+			t.Errorf("heat index at %g F, %g %%: %.1f F, want %g F", c.temperature, c.humidity, got, c.heatindex)
+		}
+	}
+}
+
+// TestWetBulb checks the example of Stull (2011)
+func TestWetBulb(t *testing.T) {
+	if got := WetBulb(20, 50); math.Abs(got-13.7) > 0.05 {
+		t.Errorf("wet-bulb at 20 'C, 50 %%: %.2f, want 13.7", got)
+	}
+	if got := WBGTIndoor(20, 50); math.Abs(got-(0.7*WetBulb(20, 50)+6)) > 1e-9 {
+		t.Errorf("WBGT at 20 'C, 50 %%: %g", got)
+	}
+}
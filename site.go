@@ -0,0 +1,290 @@
+package rz2
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// Location represents a measurement point as site/building/floor/point
+// Empty trailing elements mean the whole site, building or floor
+type Location struct {
+	Site     string
+	Building string
+	Floor    string
+	Point    string
+}
+
+func ParseLocation(str string) (Location, error) {
+	lis := strings.Split(strings.Trim(str, "/"), "/")
+	if len(lis) > 4 || lis[0] == "" {
+		return Location{}, fmt.Errorf("invalid location: %s", str)
+	}
+	for len(lis) < 4 {
+		lis = append(lis, "")
+	}
+	return Location{
+		Site:     lis[0],
+		Building: lis[1],
+		Floor:    lis[2],
+		Point:    lis[3],
+	}, nil
+}
+
+func (l Location) elements() []string {
+	rtn := make([]string, 0, 4)
+	for _, e := range []string{l.Site, l.Building, l.Floor, l.Point} {
+		if e == "" {
+			break
+		}
+		rtn = append(rtn, e)
+	}
+	return rtn
+}
+
+func (l Location) String() string {
+	return strings.Join(l.elements(), "/")
+}
+
+// Dir returns the recorder directory of the location
+func (l Location) Dir(recdir string) string {
+	return filepath.Join(append([]string{recdir}, l.elements()...)...)
+}
+
+// Contains reports whether p is l itself or lies under l
+func (l Location) Contains(p Location) bool {
+	le := l.elements()
+	pe := p.elements()
+	if len(pe) < len(le) {
+		return false
+	}
+	for i := range le {
+		if le[i] != pe[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Assignment represents a device installed at a point during [Start, End)
+// Zero End means the device is still installed
+type Assignment struct {
+	MacAddress string    `toml:"macaddress"`
+	Start      time.Time `toml:"start"`
+	End        time.Time `toml:"end"`
+}
+
+func (a Assignment) Active(t time.Time) bool {
+	if t.Before(a.Start) {
+		return false
+	}
+	return a.End.IsZero() || t.Before(a.End)
+}
+
+type Point struct {
+	Name        string       `toml:"name"`
+	Assignments []Assignment `toml:"assign"`
+}
+
+type Floor struct {
+	Name   string  `toml:"name"`
+	Points []Point `toml:"point"`
+}
+
+type Building struct {
+	Name   string  `toml:"name"`
+	Floors []Floor `toml:"floor"`
+}
+
+type Site struct {
+	Name      string     `toml:"name"`
+	Buildings []Building `toml:"building"`
+}
+
+// Layout maps MAC addresses to locations over time
+type Layout struct {
+	Sites []Site `toml:"site"`
+}
+
+func ReadLayout(fn string) (*Layout, error) {
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return nil, err
+	}
+	l := &Layout{}
+	err = toml.Unmarshal(b, l)
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Layout) each(fn func(Location, Point)) {
+	for _, s := range l.Sites {
+		for _, b := range s.Buildings {
+			for _, f := range b.Floors {
+				for _, p := range f.Points {
+					fn(Location{Site: s.Name, Building: b.Name, Floor: f.Name, Point: p.Name}, p)
+				}
+			}
+		}
+	}
+}
+
+// Locations returns all points in the layout
+func (l *Layout) Locations() []Location {
+	rtn := make([]Location, 0)
+	l.each(func(loc Location, p Point) {
+		rtn = append(rtn, loc)
+	})
+	return rtn
+}
+
+// Locate returns the point where macaddress is installed at t
+// If site is not empty, only points in the site are searched
+func (l *Layout) Locate(site, macaddress string, t time.Time) (Location, bool) {
+	var rtn Location
+	found := false
+	l.each(func(loc Location, p Point) {
+		if found || (site != "" && loc.Site != site) {
+			return
+		}
+		for _, a := range p.Assignments {
+			if strings.EqualFold(a.MacAddress, macaddress) && a.Active(t) {
+				rtn = loc
+				found = true
+				return
+			}
+		}
+	})
+	return rtn, found
+}
+
+// Assignments returns devices installed at points under loc
+func (l *Layout) Assignments(loc Location) map[Location][]Assignment {
+	rtn := make(map[Location][]Assignment)
+	l.each(func(pl Location, p Point) {
+		if loc.Contains(pl) && len(p.Assignments) > 0 {
+			rtn[pl] = p.Assignments
+		}
+	})
+	return rtn
+}
+
+// DatFileTime returns the start time in a recorder file name: [site_]mac_2006-01-02-15-04-05.dat
+func DatFileTime(fn string) (time.Time, error) {
+	base := strings.TrimSuffix(filepath.Base(fn), ".dat")
+	if len(base) < 19 {
+		return time.Time{}, fmt.Errorf("unknown file name: %s", fn)
+	}
+	return time.ParseInLocation("2006-01-02-15-04-05", base[len(base)-19:], time.Local)
+}
+
+type datFile struct {
+	path  string
+	start time.Time
+}
+
+func listDatFiles(dir string, recursive bool) ([]datFile, error) {
+	rtn := make([]datFile, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if !recursive && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		t, err := DatFileTime(path)
+		if err != nil {
+			return nil
+		}
+		rtn = append(rtn, datFile{path: path, start: t})
+		return nil
+	})
+	return rtn, err
+}
+
+// selectDatFiles returns files which may contain data in [start, end)
+// Each file is assumed to last until the next file in the same directory starts
+func selectDatFiles(files []datFile, start, end time.Time) []datFile {
+	bydir := make(map[string][]datFile)
+	for _, f := range files {
+		d := filepath.Dir(f.path)
+		bydir[d] = append(bydir[d], f)
+	}
+	rtn := make([]datFile, 0)
+	for _, lis := range bydir {
+		sort.Slice(lis, func(i, j int) bool {
+			return lis[i].start.Before(lis[j].start)
+		})
+		for i, f := range lis {
+			if !f.start.Before(end) {
+				continue
+			}
+			if i < len(lis)-1 && !lis[i+1].start.After(start) {
+				continue
+			}
+			rtn = append(rtn, f)
+		}
+	}
+	return rtn
+}
+
+// Files returns recorder files under recdir which contain data of loc in [start, end)
+// Files recorded per MAC address before the layout was introduced are included for the periods the device was assigned to loc
+func (l *Layout) Files(recdir string, loc Location, start, end time.Time) ([]string, error) {
+	files, err := listDatFiles(loc.Dir(recdir), true)
+	if err != nil {
+		return nil, err
+	}
+	selected := selectDatFiles(files, start, end)
+	for pl, assigns := range l.Assignments(loc) {
+		for _, a := range assigns {
+			s := start
+			if a.Start.After(s) {
+				s = a.Start
+			}
+			e := end
+			if !a.End.IsZero() && a.End.Before(e) {
+				e = a.End
+			}
+			if !s.Before(e) {
+				continue
+			}
+			name := strings.Replace(a.MacAddress, ":", "_", -1)
+			macdirs := []string{filepath.Join(recdir, name), filepath.Join(recdir, pl.Site, name)}
+			for _, d := range macdirs {
+				files, err := listDatFiles(d, false)
+				if err != nil {
+					return nil, err
+				}
+				selected = append(selected, selectDatFiles(files, s, e)...)
+			}
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].start.Before(selected[j].start)
+	})
+	rtn := make([]string, 0, len(selected))
+	exists := make(map[string]bool)
+	for _, f := range selected {
+		if exists[f.path] {
+			continue
+		}
+		exists[f.path] = true
+		rtn = append(rtn, f.path)
+	}
+	return rtn, nil
+}
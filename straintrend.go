@@ -0,0 +1,146 @@
+package rz2
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// TrendPoint is the average of strain and temperature in an interval
+type TrendPoint struct {
+	Time        int64   // start of the interval [ms]
+	Strain      float64 // [με]
+	Temperature float64 // ['C] (NaN if unknown)
+	Thermal     float64 // apparent strain by temperature [με]
+	Structural  float64 // strain minus thermal strain [με]
+}
+
+type trendSum struct {
+	strain, temperature float64
+	nstrain, ntemp      int
+}
+
+// StrainTrend accumulates strain and temperature of a channel per interval
+type StrainTrend struct {
+	interval int64
+	sums     map[int64]*trendSum
+}
+
+// NewStrainTrend returns a StrainTrend of interval [ms]
+func NewStrainTrend(interval int64) *StrainTrend {
+	if interval <= 0 {
+		interval = 3600000
+	}
+	return &StrainTrend{
+		interval: interval,
+		sums:     make(map[int64]*trendSum),
+	}
+}
+
+func (t *StrainTrend) sum(time int64) *trendSum {
+	key := time - time%t.interval
+	if time < 0 && time%t.interval != 0 {
+		key -= t.interval
+	}
+	s, ok := t.sums[key]
+	if !ok {
+		s = &trendSum{}
+		t.sums[key] = s
+	}
+	return s
+}
+
+// AddStrain adds strain [με] at time [ms]
+func (t *StrainTrend) AddStrain(time int64, strain float64) {
+	s := t.sum(time)
+	s.strain += strain
+	s.nstrain++
+}
+
+// AddTemperature adds temperature ['C] at time [ms]
+func (t *StrainTrend) AddTemperature(time int64, temperature float64) {
+	s := t.sum(time)
+	s.temperature += temperature
+	s.ntemp++
+}
+
+// MergeTemperature adds temperature accumulated in o of the same interval
+// It is used when temperature of a reference sensor is accumulated separately
+func (t *StrainTrend) MergeTemperature(o *StrainTrend) error {
+	if o.interval != t.interval {
+		return fmt.Errorf("different intervals: %d != %d", o.interval, t.interval)
+	}
+	for k, os := range o.sums {
+		if os.ntemp == 0 {
+			continue
+		}
+		s, ok := t.sums[k]
+		if !ok {
+			s = &trendSum{}
+			t.sums[k] = s
+		}
+		s.temperature += os.temperature
+		s.ntemp += os.ntemp
+	}
+	return nil
+}
+
+// Points returns averages of intervals which have strain
+// Thermal and Structural are not set
+func (t *StrainTrend) Points() []TrendPoint {
+	keys := make([]int64, 0, len(t.sums))
+	for k, s := range t.sums {
+		if s.nstrain > 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	rtn := make([]TrendPoint, len(keys))
+	for i, k := range keys {
+		s := t.sums[k]
+		rtn[i] = TrendPoint{
+			Time:        k,
+			Strain:      s.strain / float64(s.nstrain),
+			Temperature: math.NaN(),
+		}
+		if s.ntemp > 0 {
+			rtn[i].Temperature = s.temperature / float64(s.ntemp)
+		}
+	}
+	return rtn
+}
+
+// EstimateThermal returns apparent strain per temperature [με/'C] by least squares of strain on temperature
+// Structural strain correlated with temperature is also regarded as thermal,
+// so that data over cycles of temperature (days or seasons) should be used
+func EstimateThermal(points []TrendPoint) (float64, error) {
+	var n, st, ss, stt, sts float64
+	for _, p := range points {
+		if math.IsNaN(p.Temperature) {
+			continue
+		}
+		n++
+		st += p.Temperature
+		ss += p.Strain
+		stt += p.Temperature * p.Temperature
+		sts += p.Temperature * p.Strain
+	}
+	den := n*stt - st*st
+	if n < 2 || den <= 1e-9*n*n {
+		return 0.0, fmt.Errorf("not enough variation of temperature")
+	}
+	return (n*sts - st*ss) / den, nil
+}
+
+// SeparateThermal sets Thermal and Structural of points with coefficient [με/'C] from reference temperature ['C]
+// Thermal is 0 for points whose temperature is unknown
+func SeparateThermal(points []TrendPoint, coefficient, reference float64) {
+	for i := range points {
+		if math.IsNaN(points[i].Temperature) || math.IsNaN(reference) {
+			points[i].Thermal = 0.0
+		} else {
+			points[i].Thermal = coefficient * (points[i].Temperature - reference)
+		}
+		points[i].Structural = points[i].Strain - points[i].Thermal
+	}
+}
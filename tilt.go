@@ -0,0 +1,145 @@
+package rz2
+
+import (
+	"math"
+)
+
+// GravityFilter estimates the gravity vector by a first order low-pass filter of acceleration
+type GravityFilter struct {
+	tau      float64 // time constant [s]
+	gravity  [3]float64
+	lasttime int64
+	count    int
+}
+
+// NewGravityFilter returns a GravityFilter with time constant tau [s]
+func NewGravityFilter(tau float64) *GravityFilter {
+	return &GravityFilter{
+		tau: tau,
+	}
+}
+
+// Add adds acceleration v at unix time t [ms]
+func (f *GravityFilter) Add(t int64, v [3]float64) {
+	if f.count == 0 {
+		f.gravity = v
+	} else {
+		dt := float64(t-f.lasttime) / 1000.0
+		if dt < 0 {
+			dt = 0
+		}
+		alpha := 1.0
+		if f.tau > 0 {
+			alpha = 1.0 - math.Exp(-dt/f.tau)
+		}
+		for i := 0; i < 3; i++ {
+			f.gravity[i] += alpha * (v[i] - f.gravity[i])
+		}
+	}
+	f.lasttime = t
+	f.count++
+}
+
+// Gravity returns the filtered gravity vector [gal]
+func (f *GravityFilter) Gravity() [3]float64 {
+	return f.gravity
+}
+
+// Count returns the number of added values
+func (f *GravityFilter) Count() int {
+	return f.count
+}
+
+// Tilt is the inclination of a sensor at a time
+type Tilt struct {
+	Time    int64 // unix time [ms]
+	Gravity [3]float64
+	Roll    float64 // rotation around x axis [°]
+	Pitch   float64 // rotation around y axis [°]
+}
+
+// NewTilt returns Tilt of gravity vector g
+// Roll and Pitch are 0 when z axis points upward
+func NewTilt(t int64, g [3]float64) Tilt {
+	roll := math.Atan2(g[1], g[2]) * 180.0 / math.Pi
+	pitch := math.Atan2(-g[0], math.Hypot(g[1], g[2])) * 180.0 / math.Pi
+	return Tilt{
+		Time:    t,
+		Gravity: g,
+		Roll:    roll,
+		Pitch:   pitch,
+	}
+}
+
+// Angle returns the angle between z axis and the vertical [°]
+func (t Tilt) Angle() float64 {
+	norm := math.Sqrt(t.Gravity[0]*t.Gravity[0] + t.Gravity[1]*t.Gravity[1] + t.Gravity[2]*t.Gravity[2])
+	if norm == 0 {
+		return 0.0
+	}
+	return math.Acos(t.Gravity[2]/norm) * 180.0 / math.Pi
+}
+
+// TiltDrift returns drift of roll and pitch [°/day] by least squares
+func TiltDrift(tilts []Tilt) (float64, float64) {
+	if len(tilts) < 2 {
+		return 0.0, 0.0
+	}
+	t0 := tilts[0].Time
+	var st, sr, sp, stt, str, stp float64
+	for _, t := range tilts {
+		d := float64(t.Time-t0) / 86400000.0
+		st += d
+		sr += t.Roll
+		sp += t.Pitch
+		stt += d * d
+		str += d * t.Roll
+		stp += d * t.Pitch
+	}
+	n := float64(len(tilts))
+	den := n*stt - st*st
+	if den == 0 {
+		return 0.0, 0.0
+	}
+	return (n*str - st*sr) / den, (n*stp - st*sp) / den
+}
+
+// AxisMapping is the mapping of sensor axes to ns/ew/ud directions as indices of AccSensor
+type AxisMapping struct {
+	NS   int
+	EW   int
+	UD   int
+	Sign [3]float64 // sign of ns, ew and ud
+}
+
+// SuggestAxes returns the mapping which makes the axis closest to gravity ud (upward positive)
+// The horizontal axes keep their order and one of them is reversed when needed to keep the axes right-handed
+// Their direction to the building grid can't be known from gravity
+func SuggestAxes(g [3]float64) AxisMapping {
+	ud := 0
+	for i := 1; i < 3; i++ {
+		if math.Abs(g[i]) > math.Abs(g[ud]) {
+			ud = i
+		}
+	}
+	m := AxisMapping{
+		NS:   (ud + 1) % 3,
+		EW:   (ud + 2) % 3,
+		UD:   ud,
+		Sign: [3]float64{1, 1, 1},
+	}
+	if g[ud] < 0 {
+		m.Sign[1] = -1
+		m.Sign[2] = -1
+	}
+	return m
+}
+
+// Rotation returns the matrix of the mapping to be used for Calibration
+func (m AxisMapping) Rotation() [3][3]float64 {
+	var rtn [3][3]float64
+	rtn[0][m.NS] = m.Sign[0]
+	rtn[1][m.EW] = m.Sign[1]
+	rtn[2][m.UD] = m.Sign[2]
+	return rtn
+}
@@ -0,0 +1,176 @@
+package rz2
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Topic is a MQTT topic of a sensor (macaddress/channel/extension)
+type Topic struct {
+	MacAddress string
+	Channel    int
+	Extension  string
+}
+
+// NewTopic returns a topic of the sensor
+func NewTopic(mac string, channel int, ext string) Topic {
+	return Topic{
+		MacAddress: mac,
+		Channel:    channel,
+		Extension:  ext,
+	}
+}
+
+// InfoTopic returns the topic of info messages of the unit
+func InfoTopic(mac string) Topic {
+	return NewTopic(mac, 1, "info")
+}
+
+// ParseTopic parses and validates topic
+func ParseTopic(topic string) (Topic, error) {
+	lis := strings.Split(topic, "/")
+	if len(lis) != 3 {
+		return Topic{}, fmt.Errorf("invalid topic: %s", topic)
+	}
+	err := ValidateMacAddress(lis[0])
+	if err != nil {
+		return Topic{}, err
+	}
+	ch, err := ParseChannel(lis[1])
+	if err != nil {
+		return Topic{}, err
+	}
+	err = validateExtension(lis[2])
+	if err != nil {
+		return Topic{}, err
+	}
+	return NewTopic(lis[0], ch, lis[2]), nil
+}
+
+// ParseTopicLenient parses topic as monitors did before ParseTopic
+// The mac address is kept as it is (without colons too), and Channel is -1 when it is not a number
+// Use it for display and playback only; records must be checked by ParseTopic
+func ParseTopicLenient(topic string) (Topic, error) {
+	lis := strings.Split(topic, "/")
+	if len(lis) < 3 {
+		return Topic{}, fmt.Errorf("invalid topic: %s", topic)
+	}
+	ch, err := strconv.Atoi(lis[1])
+	if err != nil || ch < 0 {
+		ch = -1
+	}
+	return NewTopic(lis[0], ch, lis[2]), nil
+}
+
+// String returns the topic in the form of "b8:27:eb:00:00:00/01/acc02"
+func (t Topic) String() string {
+	return fmt.Sprintf("%s/%02d/%s", t.MacAddress, t.Channel, t.Extension)
+}
+
+// Validate checks the mac address, channel number and extension
+func (t Topic) Validate() error {
+	err := ValidateMacAddress(t.MacAddress)
+	if err != nil {
+		return err
+	}
+	if t.Channel < 0 || t.Channel > 99 {
+		return fmt.Errorf("invalid channel: %d", t.Channel)
+	}
+	return validateExtension(t.Extension)
+}
+
+// Match reports whether t matches MQTT subscription pattern
+func (t Topic) Match(pattern string) bool {
+	return MatchTopic(pattern, t.String())
+}
+
+// ValidateMacAddress checks that mac is a MAC-48 address separated by colons
+func ValidateMacAddress(mac string) error {
+	hw, err := net.ParseMAC(mac)
+	if err != nil || len(hw) != 6 || strings.Count(mac, ":") != 5 {
+		return fmt.Errorf("invalid mac address: %s", mac)
+	}
+	return nil
+}
+
+// ParseChannel parses a channel number of two digits ("01")
+func ParseChannel(ch string) (int, error) {
+	if len(ch) != 2 {
+		return 0, fmt.Errorf("invalid channel: %s", ch)
+	}
+	rtn, err := strconv.ParseUint(ch, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid channel: %s", ch)
+	}
+	return int(rtn), nil
+}
+
+func validateExtension(ext string) error {
+	if ext == "" || strings.ContainsAny(ext, "/+#") {
+		return fmt.Errorf("invalid extension: %s", ext)
+	}
+	return nil
+}
+
+// SiteTopic returns topic prefixed with site ("site/b8:27:eb:00:00:00/01/acc02"), which is recorded by rz2rec
+// topic is returned as it is when site is empty
+func SiteTopic(site, topic string) string {
+	if site == "" {
+		return topic
+	}
+	return site + "/" + topic
+}
+
+// SplitSite splits a recorded topic into the site and the topic of the sensor
+// site is empty when topic is not prefixed by SiteTopic
+func SplitSite(topic string) (string, string) {
+	if strings.Count(topic, "/") != 3 {
+		return "", topic
+	}
+	i := strings.Index(topic, "/")
+	return topic[:i], topic[i+1:]
+}
+
+// ValidateSite checks that site can be a prefix of topics and a directory name
+func ValidateSite(site string) error {
+	if strings.ContainsAny(site, "/+#\x00") || site == "." || site == ".." {
+		return fmt.Errorf("invalid site: %s", site)
+	}
+	return nil
+}
+
+// TopicPattern returns a subscription pattern
+// mac and ext are "+" when empty, and channel is "+" when negative
+func TopicPattern(mac string, channel int, ext string) string {
+	if mac == "" {
+		mac = "+"
+	}
+	ch := "+"
+	if channel >= 0 {
+		ch = fmt.Sprintf("%02d", channel)
+	}
+	if ext == "" {
+		ext = "+"
+	}
+	return fmt.Sprintf("%s/%s/%s", mac, ch, ext)
+}
+
+// MatchTopic reports whether topic matches MQTT subscription pattern with "+" and "#" wildcards
+func MatchTopic(pattern, topic string) bool {
+	plis := strings.Split(pattern, "/")
+	tlis := strings.Split(topic, "/")
+	for i, p := range plis {
+		if p == "#" {
+			return true
+		}
+		if i >= len(tlis) {
+			return false
+		}
+		if p != "+" && p != tlis[i] {
+			return false
+		}
+	}
+	return len(plis) == len(tlis)
+}
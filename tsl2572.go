@@ -3,24 +3,238 @@ package rz2
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
 )
 
 func ConvertIll(b []byte) (int64, []int, error) {
-	// if len(b) != 13 {
-	// 	return 0, nil, fmt.Errorf("invalid data: %d", len(b))
-	// }
-	var send_time int64
-	var data_size int32
-	buf := bytes.NewReader(b[:8])
-	binary.Read(buf, binary.BigEndian, &send_time)
-	buf = bytes.NewReader(b[8:12])
-	binary.Read(buf, binary.BigEndian, &data_size)
+	send_time, data_size, err := readHeader("ill01", b)
+	if err != nil {
+		return 0, nil, err
+	}
+	err = checkCount("ill01", b, 12, data_size, 2)
+	if err != nil {
+		return 0, nil, err
+	}
 	data := make([]int, data_size)
 	var d int16
 	for i := 0; i < int(data_size); i++ {
-		buf = bytes.NewReader(b[12+2*i:12+2*i+2])
+		buf := bytes.NewReader(b[12+2*i:12+2*i+2])
 		binary.Read(buf, binary.BigEndian, &d)
 		data[i] = int(d)
 	}
 	return send_time, data, nil
 }
+
+// EncodeIll converts illuminance data to binary data (ill01)
+func EncodeIll(send_time int64, data []int) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	buf.Grow(12 + 2*len(data))
+	err := writeHeader(buf, send_time, int32(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range data {
+		if d < math.MinInt16 || d > math.MaxInt16 {
+			return nil, fmt.Errorf("ill01: value overflow: %d", d)
+		}
+		err := binary.Write(buf, binary.BigEndian, int16(d))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+const (
+	tslCycle   = 2.73   // integration time of an ATIME cycle [ms]
+	luxToPPFD  = 0.0185 // photosynthetic photon flux density per lux of sunlight [µmol/m²/s/lx]
+	lightGap   = 600000 // samples further apart than lightGap are not integrated [ms]
+	lightOnOff = 0.5    // lights turn off below lightOnOff of the threshold
+)
+
+// LightSensor is the setting of TSL2572 given as [device.light] in the config
+type LightSensor struct {
+	Gain        float64 `toml:"gain"`        // AGAIN: 1, 8, 16 or 120 (0.16 or 1.28 with AGL) (default: 1)
+	Integration float64 `toml:"integration"` // integration time [ms] (default: 101)
+	Glass       float64 `toml:"glass"`       // glass attenuation factor GA (default: 1)
+	Threshold   float64 `toml:"threshold"`   // illuminance regarded as lit [lx] (default: 50)
+}
+
+// DefaultLightSensor returns the setting used when a device isn't configured
+func DefaultLightSensor() LightSensor {
+	s := LightSensor{}
+	s.normalize()
+	return s
+}
+
+func (s *LightSensor) normalize() {
+	if s.Gain == 0 {
+		s.Gain = 1.0
+	}
+	if s.Integration == 0 {
+		s.Integration = 101.0
+	}
+	if s.Glass == 0 {
+		s.Glass = 1.0
+	}
+	if s.Threshold == 0 {
+		s.Threshold = 50.0
+	}
+}
+
+// Validate checks the setting
+func (s LightSensor) Validate() error {
+	switch s.Gain {
+	case 0.16, 1, 1.28, 8, 16, 120:
+	default:
+		return fmt.Errorf("light: invalid gain: %g", s.Gain)
+	}
+	if !(s.Integration >= tslCycle && s.Integration <= 256*tslCycle) {
+		return fmt.Errorf("light: invalid integration time: %g", s.Integration)
+	}
+	if !(s.Glass > 0) || math.IsInf(s.Glass, 0) {
+		return fmt.Errorf("light: invalid glass attenuation: %g", s.Glass)
+	}
+	if !(s.Threshold > 0) || math.IsInf(s.Threshold, 0) {
+		return fmt.Errorf("light: invalid threshold: %g", s.Threshold)
+	}
+	return nil
+}
+
+// Saturation returns the maximum count of CH0 at the integration time
+func (s LightSensor) Saturation() float64 {
+	return math.Min(65535.0, 1024.0*math.Round(s.Integration/tslCycle))
+}
+
+// Lux returns illuminance [lx] of CH0 and CH1 counts by the formula of the datasheet
+// It is NaN when CH0 is saturated
+func (s LightSensor) Lux(ch0, ch1 float64) float64 {
+	if ch0 >= s.Saturation() {
+		return math.NaN()
+	}
+	cpl := s.Integration * s.Gain / (s.Glass * 60.0)
+	lux1 := (ch0 - 1.87*ch1) / cpl
+	lux2 := (0.63*ch0 - ch1) / cpl
+	return math.Max(math.Max(lux1, lux2), 0.0)
+}
+
+// ConvertLux converts ill01 data of CH0/CH1 pairs to counts and illuminance [lx]
+func ConvertLux(b []byte, s LightSensor) (int64, []float64, []float64, []float64, error) {
+	send_time, data, err := ConvertIll(b)
+	if err != nil {
+		return 0, nil, nil, nil, err
+	}
+	if len(data)%2 != 0 {
+		return 0, nil, nil, nil, &DataSizeError{Name: "ill01", Size: len(data)}
+	}
+	n := len(data) / 2
+	ch0 := make([]float64, n)
+	ch1 := make([]float64, n)
+	lux := make([]float64, n)
+	for i := 0; i < n; i++ {
+		// counts are unsigned
+		ch0[i] = float64(uint16(data[2*i]))
+		ch1[i] = float64(uint16(data[2*i+1]))
+		lux[i] = s.Lux(ch0[i], ch1[i])
+	}
+	return send_time, ch0, ch1, lux, nil
+}
+
+// LightEvent is a change of lighting
+type LightEvent struct {
+	Time   int64 // [ms]
+	On     bool
+	Lux    float64
+	Source string // "lights" for a step within a sample and "daylight" for a gradual change
+}
+
+// LightDay is the light received in a day
+type LightDay struct {
+	Date     string  // "2006-01-02" in local time
+	LuxHours float64 // [lx·h]
+	Lit      float64 // hours above the threshold [h]
+	Events   int     // number of on/off events
+}
+
+// DLI returns daily light integral approximated for sunlight [mol/m²/d]
+func (d LightDay) DLI() float64 {
+	return d.LuxHours * 3600.0 * luxToPPFD * 1e-6
+}
+
+// LightMonitor integrates illuminance per day and detects lights on/off
+type LightMonitor struct {
+	threshold float64
+	on        bool
+	last      int64
+	lastlux   float64
+	started   bool
+	days      map[string]*LightDay
+}
+
+// NewLightMonitor returns a LightMonitor with threshold [lx]
+// Lights turn on above threshold and off below lightOnOff of threshold
+func NewLightMonitor(threshold float64) *LightMonitor {
+	return &LightMonitor{
+		threshold: threshold,
+		days:      make(map[string]*LightDay),
+	}
+}
+
+func (m *LightMonitor) day(t int64) *LightDay {
+	date := ConvertUnixtime(t).Format("2006-01-02")
+	d, ok := m.days[date]
+	if !ok {
+		d = &LightDay{Date: date}
+		m.days[date] = d
+	}
+	return d
+}
+
+// Add adds illuminance [lx] at time [ms] and returns the event if lighting changes
+func (m *LightMonitor) Add(t int64, lux float64) *LightEvent {
+	if math.IsNaN(lux) {
+		return nil
+	}
+	if !m.started {
+		m.started = true
+		m.last, m.lastlux = t, lux
+		m.on = lux > m.threshold
+		return nil
+	}
+	dt := t - m.last
+	if dt > 0 && dt <= lightGap {
+		// trapezoid in the day of the sample
+		d := m.day(t)
+		d.LuxHours += 0.5 * (lux + m.lastlux) * float64(dt) / 3600000.0
+		if m.on {
+			d.Lit += float64(dt) / 3600000.0
+		}
+	}
+	var ev *LightEvent
+	if (!m.on && lux > m.threshold) || (m.on && lux < lightOnOff*m.threshold) {
+		m.on = !m.on
+		ev = &LightEvent{Time: t, On: m.on, Lux: lux, Source: "daylight"}
+		if math.Abs(lux-m.lastlux) >= lightOnOff*m.threshold {
+			ev.Source = "lights"
+		}
+		m.day(t).Events++
+	}
+	if t >= m.last {
+		m.last, m.lastlux = t, lux
+	}
+	return ev
+}
+
+// Days returns light of days sorted by date
+func (m *LightMonitor) Days() []LightDay {
+	rtn := make([]LightDay, 0, len(m.days))
+	for _, d := range m.days {
+		rtn = append(rtn, *d)
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		return rtn[i].Date < rtn[j].Date
+	})
+	return rtn
+}
@@ -0,0 +1,291 @@
+package rz2
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+)
+
+const (
+	windPeriod = 600000 // averaging period of wind statistics [ms]
+	gustWindow = 3000   // duration of the running mean of gust speed [ms]
+)
+
+// WindStats is the statistics of wind in a period
+type WindStats struct {
+	Start        int64   // start of the period [ms]
+	End          int64   // end of the period [ms]
+	Count        int     // number of samples
+	MeanSpeed    float64 // scalar mean of speed [m/s]
+	VectorSpeed  float64 // speed of the vector mean [m/s]
+	Direction    float64 // direction of the vector mean [deg]
+	DirectionStd float64 // standard deviation of direction by Yamartino [deg]
+	StdSpeed     float64 // standard deviation of speed [m/s]
+	MaxSpeed     float64 // maximum of samples [m/s]
+	Gust         float64 // maximum of the running mean over gustWindow [m/s]
+	GustFactor   float64 // Gust / MeanSpeed
+	Turbulence   float64 // StdSpeed / MeanSpeed
+}
+
+type windSample struct {
+	time  int64
+	speed float64
+}
+
+// WindAccumulator computes WindStats of consecutive periods
+type WindAccumulator struct {
+	period int64
+	window int64
+	start  int64
+	count  int
+	// sums of the period
+	speed, speed2, su, sv, ss, sc float64
+	max, gust                     float64
+	// samples in the gust window
+	queue []windSample
+	sum   float64
+}
+
+// NewWindAccumulator returns a WindAccumulator of period and gust window [ms] (0 for defaults)
+// Periods are aligned to multiples of period
+func NewWindAccumulator(period, window int64) *WindAccumulator {
+	if period <= 0 {
+		period = windPeriod
+	}
+	if window <= 0 {
+		window = gustWindow
+	}
+	return &WindAccumulator{period: period, window: window, start: math.MinInt64}
+}
+
+// Add adds direction [deg] and speed [m/s] at time [ms]
+// It returns the statistics of the previous period when the sample is in a new period
+func (w *WindAccumulator) Add(time int64, direction, speed float64) *WindStats {
+	if math.IsNaN(direction) || math.IsNaN(speed) {
+		return nil
+	}
+	start := time - time%w.period
+	if time < 0 && time%w.period != 0 {
+		start -= w.period
+	}
+	var rtn *WindStats
+	if start != w.start {
+		if w.count > 0 {
+			rtn = w.stats()
+		}
+		w.reset(start)
+	}
+	// running mean over the gust window
+	w.queue = append(w.queue, windSample{time, speed})
+	w.sum += speed
+	i := 0
+	for i < len(w.queue) && w.queue[i].time <= time-w.window {
+		w.sum -= w.queue[i].speed
+		i++
+	}
+	if i > 0 {
+		w.queue = append(w.queue[:0], w.queue[i:]...)
+	}
+	if g := w.sum / float64(len(w.queue)); g > w.gust {
+		w.gust = g
+	}
+	rad := direction * math.Pi / 180.0
+	w.count++
+	w.speed += speed
+	w.speed2 += speed * speed
+	w.su += speed * math.Sin(rad)
+	w.sv += speed * math.Cos(rad)
+	w.ss += math.Sin(rad)
+	w.sc += math.Cos(rad)
+	if speed > w.max {
+		w.max = speed
+	}
+	return rtn
+}
+
+func (w *WindAccumulator) reset(start int64) {
+	w.start = start
+	w.count = 0
+	w.speed, w.speed2, w.su, w.sv, w.ss, w.sc = 0, 0, 0, 0, 0, 0
+	w.max, w.gust = 0, 0
+}
+
+// Flush returns the statistics of the current period (nil if empty)
+func (w *WindAccumulator) Flush() *WindStats {
+	if w.count == 0 {
+		return nil
+	}
+	rtn := w.stats()
+	w.reset(w.start)
+	return rtn
+}
+
+func (w *WindAccumulator) stats() *WindStats {
+	n := float64(w.count)
+	rtn := &WindStats{
+		Start:     w.start,
+		End:       w.start + w.period,
+		Count:     w.count,
+		MeanSpeed: w.speed / n,
+		MaxSpeed:  w.max,
+		Gust:      w.gust,
+	}
+	rtn.StdSpeed = math.Sqrt(math.Max(w.speed2/n-rtn.MeanSpeed*rtn.MeanSpeed, 0.0))
+	rtn.VectorSpeed = math.Hypot(w.su, w.sv) / n
+	rtn.Direction = math.Mod(math.Atan2(w.su, w.sv)*180.0/math.Pi+360.0, 360.0)
+	s, c := w.ss/n, w.sc/n
+	eps := math.Sqrt(math.Max(1.0-(s*s+c*c), 0.0))
+	rtn.DirectionStd = math.Asin(eps) * (1.0 + 0.1547*eps*eps*eps) * 180.0 / math.Pi
+	if rtn.MeanSpeed > 0 {
+		rtn.GustFactor = rtn.Gust / rtn.MeanSpeed
+		rtn.Turbulence = rtn.StdSpeed / rtn.MeanSpeed
+	}
+	return rtn
+}
+
+// WindRose is the histogram of direction sectors and speed classes
+type WindRose struct {
+	Sectors int       // number of direction sectors centered at north
+	Bins    []float64 // upper bounds of speed classes [m/s] (the last class has no upper bound)
+	Counts  [][]float64
+	total   float64
+}
+
+// NewWindRose returns a WindRose of sectors and speed classes separated at bins [m/s]
+func NewWindRose(sectors int, bins []float64) (*WindRose, error) {
+	if sectors <= 0 || sectors > 360 {
+		return nil, fmt.Errorf("windrose: invalid sectors: %d", sectors)
+	}
+	for i := 1; i < len(bins); i++ {
+		if !(bins[i] > bins[i-1]) {
+			return nil, fmt.Errorf("windrose: bins must increase: %v", bins)
+		}
+	}
+	counts := make([][]float64, sectors)
+	for i := range counts {
+		counts[i] = make([]float64, len(bins)+1)
+	}
+	return &WindRose{Sectors: sectors, Bins: bins, Counts: counts}, nil
+}
+
+// Add adds a sample of direction [deg] and speed [m/s]
+func (r *WindRose) Add(direction, speed float64) {
+	if math.IsNaN(direction) || math.IsNaN(speed) {
+		return
+	}
+	width := 360.0 / float64(r.Sectors)
+	d := math.Mod(math.Mod(direction+0.5*width, 360.0)+360.0, 360.0)
+	sector := int(d/width) % r.Sectors
+	class := len(r.Bins)
+	for i, b := range r.Bins {
+		if speed < b {
+			class = i
+			break
+		}
+	}
+	r.Counts[sector][class]++
+	r.total++
+}
+
+// Total returns the number of samples
+func (r *WindRose) Total() float64 {
+	return r.total
+}
+
+// Frequency returns the fraction of samples in the sector and the class
+func (r *WindRose) Frequency(sector, class int) float64 {
+	if r.total == 0 {
+		return 0.0
+	}
+	return r.Counts[sector][class] / r.total
+}
+
+// ClassName returns the label of speed class
+func (r *WindRose) ClassName(class int) string {
+	switch {
+	case len(r.Bins) == 0:
+		return "all"
+	case class == 0:
+		return fmt.Sprintf("< %g m/s", r.Bins[0])
+	case class == len(r.Bins):
+		return fmt.Sprintf(">= %g m/s", r.Bins[len(r.Bins)-1])
+	default:
+		return fmt.Sprintf("%g - %g m/s", r.Bins[class-1], r.Bins[class])
+	}
+}
+
+var windRoseColors = []string{"#2c7bb6", "#00a6ca", "#00ccbc", "#90eb9d", "#ffff8c", "#f9d057", "#f29e2e", "#e76818", "#d7191c"}
+
+// WriteSVG renders the wind rose of size [px] with stacked speed classes
+func (r *WindRose) WriteSVG(w io.Writer, title string, size int) error {
+	c := float64(size) / 2.0
+	radius := c * 0.75
+	// the longest sector is at the outer ring
+	max := 0.0
+	for s := range r.Counts {
+		f := 0.0
+		for k := range r.Counts[s] {
+			f += r.Frequency(s, k)
+		}
+		max = math.Max(max, f)
+	}
+	if max == 0 {
+		max = 1.0
+	}
+	step := math.Pow(10.0, math.Floor(math.Log10(max/4.0)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if max/(m*step) <= 5 {
+			step *= m
+			break
+		}
+	}
+	rings := int(math.Ceil(max / step))
+	scale := radius / (float64(rings) * step)
+	point := func(f, deg float64) (float64, float64) {
+		rad := deg * math.Pi / 180.0
+		return c + f*scale*math.Sin(rad), c - f*scale*math.Cos(rad)
+	}
+
+	fmt.Fprintf(w, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"sans-serif\" font-size=\"%d\">\n", size+size/3, size, size+size/3, size, size/40)
+	fmt.Fprintf(w, "<rect width=\"100%%\" height=\"100%%\" fill=\"white\"/>\n")
+	fmt.Fprintf(w, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\">%s</text>\n", c, float64(size)/20.0, html.EscapeString(title))
+	for i := 1; i <= rings; i++ {
+		fmt.Fprintf(w, "<circle cx=\"%.1f\" cy=\"%.1f\" r=\"%.1f\" fill=\"none\" stroke=\"#cccccc\"/>\n", c, c, float64(i)*step*scale)
+		x, y := point(float64(i)*step, 22.5)
+		fmt.Fprintf(w, "<text x=\"%.1f\" y=\"%.1f\" fill=\"#888888\">%g%%</text>\n", x, y, float64(i)*step*100.0)
+	}
+	for i, label := range []string{"N", "E", "S", "W"} {
+		x, y := point(float64(rings)*step*1.1, float64(i)*90.0)
+		fmt.Fprintf(w, "<text x=\"%.1f\" y=\"%.1f\" text-anchor=\"middle\" dominant-baseline=\"middle\">%s</text>\n", x, y, label)
+	}
+	width := 360.0 / float64(r.Sectors)
+	for s := range r.Counts {
+		inner := 0.0
+		a0 := float64(s)*width - 0.45*width
+		a1 := float64(s)*width + 0.45*width
+		for k := range r.Counts[s] {
+			f := r.Frequency(s, k)
+			if f == 0 {
+				continue
+			}
+			outer := inner + f
+			x0, y0 := point(inner, a0)
+			x1, y1 := point(outer, a0)
+			x2, y2 := point(outer, a1)
+			x3, y3 := point(inner, a1)
+			fmt.Fprintf(w, "<path d=\"M %.1f %.1f L %.1f %.1f A %.1f %.1f 0 0 1 %.1f %.1f L %.1f %.1f A %.1f %.1f 0 0 0 %.1f %.1f Z\" fill=\"%s\" stroke=\"white\" stroke-width=\"0.5\"/>\n",
+				x0, y0, x1, y1, outer*scale, outer*scale, x2, y2, x3, y3, inner*scale, inner*scale, x0, y0, windRoseColors[k%len(windRoseColors)])
+			inner = outer
+		}
+	}
+	// legend
+	lx := float64(size) * 1.02
+	for k := 0; k <= len(r.Bins); k++ {
+		y := float64(size)/10.0 + float64(k)*float64(size)/25.0
+		fmt.Fprintf(w, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%d\" height=\"%d\" fill=\"%s\"/>\n", lx, y-float64(size)/50.0, size/50, size/50, windRoseColors[k%len(windRoseColors)])
+		fmt.Fprintf(w, "<text x=\"%.1f\" y=\"%.1f\">%s</text>\n", lx+float64(size)/35.0, y, html.EscapeString(r.ClassName(k)))
+	}
+	_, err := fmt.Fprintf(w, "<text x=\"%.1f\" y=\"%.1f\">n= %.0f</text>\n</svg>\n", lx, float64(size)*0.95, r.total)
+	return err
+}
@@ -0,0 +1,202 @@
+package rz2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// ZeroPoint is the raw value of a str01 channel at zero strain
+type ZeroPoint struct {
+	MacAddress  string  `toml:"macaddress"`
+	Channel     int     `toml:"channel"`
+	Time        int64   `toml:"time"` // unix time from which the zero point is used [ms]
+	Raw         float64 `toml:"raw"`
+	Temperature float64 `toml:"temperature"` // temperature at the zero point ['C] (NaN if unknown)
+}
+
+// Validate checks the zero point
+func (z ZeroPoint) Validate() error {
+	err := NewTopic(z.MacAddress, z.Channel, "str01").Validate()
+	if err != nil {
+		return err
+	}
+	if math.IsNaN(z.Raw) || math.IsInf(z.Raw, 0) || math.Abs(z.Raw) >= float64(pow23) {
+		return fmt.Errorf("invalid zero point: %f", z.Raw)
+	}
+	return nil
+}
+
+// CaptureZero returns the zero point of a channel as the average of raw values
+func CaptureZero(mac string, channel int, t int64, raw []float64, temperature float64) (ZeroPoint, error) {
+	if len(raw) == 0 {
+		return ZeroPoint{}, fmt.Errorf("%s/%02d: no data", mac, channel)
+	}
+	sum := 0.0
+	for _, v := range raw {
+		sum += v
+	}
+	z := ZeroPoint{
+		MacAddress:  mac,
+		Channel:     channel,
+		Time:        t,
+		Raw:         sum / float64(len(raw)),
+		Temperature: temperature,
+	}
+	return z, z.Validate()
+}
+
+// ZeroControlTopic returns the topic of messages which make receivers re-zero the channel
+func ZeroControlTopic(mac string, channel int) Topic {
+	return NewTopic(mac, channel, "zero")
+}
+
+// ZeroControl is the payload of a zero control message (JSON)
+// Receivers capture the zero point from the latest data when Raw is not given
+type ZeroControl struct {
+	Time        int64    `json:"time"`
+	Raw         *float64 `json:"raw,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+}
+
+// ParseZeroControl parses the payload of a zero control message
+func ParseZeroControl(payload []byte) (ZeroControl, error) {
+	var c ZeroControl
+	if len(payload) == 0 {
+		return c, nil
+	}
+	err := json.Unmarshal(payload, &c)
+	return c, err
+}
+
+// ZeroStore is the history of zero points saved in a file
+type ZeroStore struct {
+	lock  sync.RWMutex
+	path  string
+	Zeros []ZeroPoint `toml:"zero"`
+}
+
+// LoadZeroStore reads zero points from fn
+// An empty store is returned when fn doesn't exist
+func LoadZeroStore(fn string) (*ZeroStore, error) {
+	z := &ZeroStore{path: fn}
+	b, err := ioutil.ReadFile(fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return z, nil
+		}
+		return nil, err
+	}
+	err = toml.Unmarshal(b, z)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fn, err)
+	}
+	for _, zp := range z.Zeros {
+		err := zp.Validate()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", fn, err)
+		}
+	}
+	z.sort()
+	return z, nil
+}
+
+func (z *ZeroStore) sort() {
+	sort.SliceStable(z.Zeros, func(i, j int) bool {
+		a, b := z.Zeros[i], z.Zeros[j]
+		if a.MacAddress != b.MacAddress {
+			return a.MacAddress < b.MacAddress
+		}
+		if a.Channel != b.Channel {
+			return a.Channel < b.Channel
+		}
+		return a.Time < b.Time
+	})
+}
+
+// Save writes zero points to the file of the store
+func (z *ZeroStore) Save() error {
+	z.lock.RLock()
+	b, err := toml.Marshal(z)
+	z.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp := z.path + ".tmp"
+	err = ioutil.WriteFile(tmp, b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, z.path)
+}
+
+// Add adds a zero point to the history
+func (z *ZeroStore) Add(zp ZeroPoint) error {
+	err := zp.Validate()
+	if err != nil {
+		return err
+	}
+	z.lock.Lock()
+	defer z.lock.Unlock()
+	z.Zeros = append(z.Zeros, zp)
+	z.sort()
+	return nil
+}
+
+// Lookup returns the zero point of the channel used at t
+func (z *ZeroStore) Lookup(mac string, channel int, t int64) (ZeroPoint, bool) {
+	if z == nil {
+		return ZeroPoint{}, false
+	}
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	var rtn ZeroPoint
+	found := false
+	for _, zp := range z.Zeros {
+		if zp.MacAddress == mac && zp.Channel == channel && zp.Time <= t {
+			rtn = zp
+			found = true
+		}
+	}
+	return rtn, found
+}
+
+// History returns zero points of the channel
+func (z *ZeroStore) History(mac string, channel int) []ZeroPoint {
+	if z == nil {
+		return []ZeroPoint{}
+	}
+	z.lock.RLock()
+	defer z.lock.RUnlock()
+	rtn := make([]ZeroPoint, 0)
+	for _, zp := range z.Zeros {
+		if zp.MacAddress == mac && zp.Channel == channel {
+			rtn = append(rtn, zp)
+		}
+	}
+	return rtn
+}
+
+var (
+	zerostore     *ZeroStore
+	zerostorelock sync.RWMutex
+)
+
+// RegisterZeroStore makes the str01 decoder use zero points of z (nil for none)
+func RegisterZeroStore(z *ZeroStore) {
+	zerostorelock.Lock()
+	defer zerostorelock.Unlock()
+	zerostore = z
+}
+
+func lookupZero(mac string, channel int, t int64) (ZeroPoint, bool) {
+	zerostorelock.RLock()
+	defer zerostorelock.RUnlock()
+	return zerostore.Lookup(mac, channel, t)
+}
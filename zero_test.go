@@ -0,0 +1,16 @@
+package rz2
+
+import (
+	"testing"
+)
+
+// valmon and rz2fatigue run with a nil store without -zero
+func TestZeroStoreNil(t *testing.T) {
+	var z *ZeroStore
+	if _, ok := z.Lookup("b8:27:eb:00:00:01", 1, goldenTime); ok {
+		t.Error("zero point found in nil store")
+	}
+	if h := z.History("b8:27:eb:00:00:01", 1); len(h) != 0 {
+		t.Errorf("history of nil store: %v", h)
+	}
+}